@@ -2,227 +2,144 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
 	"net"
 	"os"
-	"sync"
+	"strings"
 	"time"
 
-	"github.com/eikarna/SecureFlow/internal/crypto"
-	"github.com/eikarna/SecureFlow/internal/protocol"
-	"lukechampine.com/blake3"
+	"github.com/eikarna/SecureFlow"
 )
 
-// --- Konfigurasi (Tidak Berubah) ---
-type PortHoppingConfig struct {
-	Enabled bool `json:"enabled"`
-	Start   int  `json:"start"`
-	End     int  `json:"end"`
-}
-type Config struct {
-	ClientTargetAddress string            `json:"client_target_address"`
-	HandshakePort       int               `json:"handshake_port"`
-	AuthKey             string            `json:"auth_key"`
-	PortHopping         PortHoppingConfig `json:"port_hopping"`
-}
+// --- Konfigurasi ---
 
-// --- Sesi Klien & Retransmisi (Diperbarui) ---
-type RetransmissionInfo struct {
-	Packet      []byte
-	SentTime    time.Time
-	Retries     int
+// Config menambahkan alamat server CLI ke konfigurasi library.
+type Config struct {
+	secureflow.Config
+	ClientTargetAddress string `json:"client_target_address"`
+	HandshakePort       int    `json:"handshake_port"`
 }
 
-type ClientSession struct {
-	sync.Mutex
-	SessionID             string
-	SharedKey             [crypto.KeySize]byte
-	
-	// State untuk Mengirim ke Server
-	CurrentPort           int
-	Sequence              uint64
-	LastSentHash          [protocol.HashSize]byte
-	PendingRetransmission map[uint64]*RetransmissionInfo // Antrean untuk paket yang menunggu ACK
+// dialTimeout adalah batas waktu handshake dengan server.
+const dialTimeout = 10 * time.Second
 
-	// State untuk Menerima dari Server
-	ServerLastReceivedHash [protocol.HashSize]byte
-	ServerExpectedSeq      uint64
-}
-
-// (loadConfig, PortSelector tidak berubah)
 func loadConfig(path string) (*Config, error) { file, err := os.Open(path); if err != nil { return nil, err }; defer file.Close(); config := &Config{}; decoder := json.NewDecoder(file); err = decoder.Decode(config); return config, err }
-type PortSelector struct{ start, end int }
-func NewPortSelector(start, end int) *PortSelector { return &PortSelector{start: start, end: end} }
-func (ps *PortSelector) GetNextPort() uint16 { return uint16(rand.Intn(ps.end-ps.start+1) + ps.start) }
 
+// --- Perintah ---
 
-// listenForAcks sekarang memverifikasi rantai hash server dan menghapus dari antrean retransmisi
-func listenForAcks(conn *net.UDPConn, session *ClientSession) {
-	log.Printf("Listener ACK berjalan di %s", conn.LocalAddr().String())
-	buffer := make([]byte, 2048)
+// receiveMessages mencetak pesan dari server dan menghentikan klien jika sesi diputus.
+func receiveMessages(conn *secureflow.Conn) {
 	for {
-		n, _, err := conn.ReadFromUDP(buffer)
-		if err != nil { continue }
-		
-		packetBytes := buffer[:n]
-		packet, err := protocol.Deserialize(packetBytes)
-		if err != nil { continue }
-		
-		plaintext, err := crypto.Decrypt(session.SharedKey, packet.Nonce, packet.Payload)
-		if err != nil { continue }
-		
-		msg, err := protocol.DecodeDataMessage(plaintext)
-		if err != nil { continue }
-
-		session.Lock()
-
-		// Verifikasi rantai hash dari server
-		if !bytes.Equal(packet.Header.PrevHash[:], session.ServerLastReceivedHash[:]) {
-			log.Printf("⚠️  Rantai hash dari server putus! Paket balasan ditolak.")
-			session.Unlock()
-			continue
+		message, err := conn.ReadMessage()
+		if errors.Is(err, net.ErrClosed) {
+			return
 		}
-		if msg.Seq != session.ServerExpectedSeq {
-			log.Printf("⚠️  Nomor urut dari server salah! Paket balasan ditolak.")
-			session.Unlock()
-			continue
+		if err != nil {
+			log.Fatalf("❌ Sesi %s diputus: %v", conn.SessionID(), err)
 		}
-		
-		// Perbarui state penerimaan dari server
-		session.ServerLastReceivedHash = blake3.Sum256(packetBytes)
-		session.ServerExpectedSeq++
+		fmt.Printf("Pesan dari server: %s", string(message))
+	}
+}
 
-		// Cek apakah ini adalah ACK untuk salah satu paket kita
-		if _, ok := session.PendingRetransmission[msg.AckSeq]; ok {
-			log.Printf("✅ Diterima: ACK untuk pesan #%d", msg.AckSeq)
-			delete(session.PendingRetransmission, msg.AckSeq) // Hapus dari antrean
-		}
-		session.Unlock()
+// streamMessage mengirim message lewat stream baru, menutupnya, lalu mencetak echo dari
+// server sampai server menutup stream.
+func streamMessage(conn *secureflow.Conn, message []byte) {
+	stream, err := conn.OpenStream()
+	if err != nil {
+		log.Printf("Gagal membuka stream: %v", err)
+		return
+	}
+	if _, err := stream.Write(message); err != nil {
+		log.Printf("Gagal menulis ke stream %d: %v", stream.ID(), err)
+		return
+	}
+	stream.Close()
+	echo, err := io.ReadAll(stream)
+	if err != nil {
+		log.Printf("Stream %d berakhir: %v", stream.ID(), err)
+		return
 	}
+	fmt.Printf("Echo stream %d: %s", stream.ID(), string(echo))
 }
 
-// retransmissionChecker memeriksa paket yang belum di-ACK
-func retransmissionChecker(session *ClientSession) {
-	ticker := time.NewTicker(10 * time.Second) // Cek setiap 10 detik
-	defer ticker.Stop()
+// printDatagrams mencetak setiap datagram dari server.
+func printDatagrams(conn *secureflow.Conn) {
+	for {
+		data, err := conn.ReceiveDatagram()
+		if err != nil {
+			return
+		}
+		fmt.Printf("Echo datagram: %s", string(data))
+	}
+}
 
-	for range ticker.C {
-		session.Lock()
-		if len(session.PendingRetransmission) > 0 {
-			log.Printf("⚠️  Pengecekan Retransmisi: %d paket menunggu ACK.", len(session.PendingRetransmission))
-			for seq, info := range session.PendingRetransmission {
-				if time.Since(info.SentTime) > 15*time.Second { // Timeout 15 detik
-					log.Printf("❌ Paket #%d (retries: %d) dianggap hilang. Belum ada ACK setelah 15 detik.", seq, info.Retries)
-					info.Retries++
-					// Di sinilah logika pengiriman ulang yang sebenarnya akan ditempatkan.
-					// Karena kompleksitas dengan port hopping, untuk saat ini kita hanya mencatatnya.
-				}
-			}
+// handleInput menjalankan satu baris input: perintah atau pesan biasa.
+func handleInput(conn *secureflow.Conn, line string) {
+	if strings.TrimSpace(line) == "/stats" {
+		log.Printf("📊 %s", conn.Stats())
+		return
+	}
+	if text, ok := strings.CutPrefix(line, "/stream "); ok {
+		go streamMessage(conn, []byte(text))
+		return
+	}
+	if text, ok := strings.CutPrefix(line, "/dgram "); ok {
+		if err := conn.SendDatagram([]byte(text)); err != nil {
+			log.Printf("Gagal mengirim datagram: %v", err)
+		}
+		return
+	}
+	payload := []byte(line)
+	if path, ok := strings.CutPrefix(strings.TrimSpace(line), "/file "); ok {
+		var err error
+		if payload, err = os.ReadFile(path); err != nil {
+			log.Printf("Gagal membaca file: %v", err)
+			return
 		}
-		session.Unlock()
 	}
+	if err := conn.WriteMessage(payload); err != nil {
+		log.Printf("Gagal mengirim pesan: %v", err)
+		return
+	}
+	log.Printf("Pesan %d byte terkirim.", len(payload))
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-	log.Println("Memulai SecureFlow Client (Full State)...")
+	log.Println("Memulai SecureFlow Client...")
 	config, err := loadConfig("configs/config.json")
 	if err != nil { log.Fatalf("Gagal memuat konfigurasi: %v", err) }
 
-	// --- 1. Membuat Listener ACK ---
-	ackAddr, _ := net.ResolveUDPAddr("udp", "0.0.0.0:0")
-	ackConn, _ := net.ListenUDP("udp", ackAddr)
-	defer ackConn.Close()
-	finalAckAddr := ackConn.LocalAddr().String()
-
-	// --- 2. Handshake ---
+	// --- 1. Handshake ---
 	handshakeAddrStr := fmt.Sprintf("%s:%d", config.ClientTargetAddress, config.HandshakePort)
-	serverAddr, _ := net.ResolveUDPAddr("udp", handshakeAddrStr)
-	conn, _ := net.DialUDP("udp", nil, serverAddr)
-	privKey, pubKey, _ := crypto.GenerateKeys()
-	initialHash := [protocol.HashSize]byte{}
-	handshakePacket := &protocol.SecurePacket{ Header: protocol.PacketHeader{Version: protocol.ProtocolVersion, Type: protocol.HandshakeMsgType, PrevHash: initialHash}, Payload: pubKey[:] }
-	packetBytes, _ := handshakePacket.Serialize()
-	conn.Write(packetBytes)
-	buffer := make([]byte, 2048)
-	n, _ := conn.Read(buffer)
-	conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	netConn, err := secureflow.Dial(ctx, handshakeAddrStr, &config.Config)
+	cancel()
+	if err != nil { log.Fatalf("Gagal terhubung: %v", err) }
+	conn := netConn.(*secureflow.Conn)
+	log.Printf("Handshake berhasil. SessionID: %s, Congestion control: %s", conn.SessionID(), conn.Stats().Algorithm)
 
-	// --- 3. Inisialisasi Sesi ---
-	responsePacket, _ := protocol.Deserialize(buffer[:n])
-	var serverPubKey [crypto.KeySize]byte
-	copy(serverPubKey[:], responsePacket.Payload[:crypto.KeySize])
-	sharedKey, _ := crypto.SharedSecret(privKey, serverPubKey)
-	
-	session := &ClientSession{
-		SessionID:             string(responsePacket.Payload[crypto.KeySize+2:]),
-		SharedKey:             sharedKey,
-		CurrentPort:           int(binary.BigEndian.Uint16(responsePacket.Payload[crypto.KeySize : crypto.KeySize+2])),
-		Sequence:              0,
-		LastSentHash:          initialHash,
-		PendingRetransmission: make(map[uint64]*RetransmissionInfo),
-		ServerLastReceivedHash: initialHash, // Rantai hash server juga dimulai dengan nol
-		ServerExpectedSeq:      0,
-	}
+	go receiveMessages(conn)
+	go printDatagrams(conn)
 
-	go listenForAcks(ackConn, session)
-	go retransmissionChecker(session)
-	log.Printf("Handshake berhasil. SessionID: %s, Port Pertama: %d", session.SessionID, session.CurrentPort)
-
-	// --- 4. Loop Pengiriman Pesan ---
-	portSelector := NewPortSelector(config.PortHopping.Start, config.PortHopping.End)
+	// --- 2. Loop Pengiriman Pesan ---
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Ketik pesan dan tekan Enter untuk mengirim:")
+	fmt.Println("Ketik pesan dan tekan Enter untuk mengirim (/stats untuk statistik koneksi, /file <path> untuk mengirim file, /stream <pesan> untuk mengirim lewat stream baru, /dgram <pesan> untuk mengirim datagram tak andal):")
 	for {
 		fmt.Print("> ")
-		message, _ := reader.ReadString('\n')
-		if len(message) == 0 { continue }
-
-		session.Lock()
-		currentSeq := session.Sequence
-		dataMsg := &protocol.DataMessage{
-			SessionID:  session.SessionID,
-			Message:    []byte(message),
-			NextPort:   portSelector.GetNextPort(),
-			Seq:        currentSeq,
-			AckSeq:     session.ServerExpectedSeq - 1, // Meng-ACK pesan terakhir dari server
-			ReturnAddr: finalAckAddr,
-		}
-		plaintext, _ := protocol.EncodeDataMessage(dataMsg)
-		encryptedPayload, nonce, _ := crypto.Encrypt(session.SharedKey, plaintext)
-		dataPacket := &protocol.SecurePacket{
-			Header: protocol.PacketHeader{ Version: protocol.ProtocolVersion, Type: protocol.DataMsgType, PrevHash: session.LastSentHash },
-			Nonce:   nonce,
-			Payload: encryptedPayload,
-		}
-		finalPacketBytes, _ := dataPacket.Serialize()
-
-		session.PendingRetransmission[currentSeq] = &RetransmissionInfo{
-			Packet:   finalPacketBytes,
-			SentTime: time.Now(),
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			handleInput(conn, line)
 		}
-
-		targetAddrStr := fmt.Sprintf("%s:%d", config.ClientTargetAddress, session.CurrentPort)
-		targetAddr, _ := net.ResolveUDPAddr("udp", targetAddrStr)
-		sendConn, _ := net.DialUDP("udp", nil, targetAddr)
-		_, err = sendConn.Write(finalPacketBytes)
-		sendConn.Close()
+		// Akhir input (EOF atau error) mengakhiri klien, bukan diulang terus-menerus
 		if err != nil {
-			log.Printf("Gagal mengirim data: %v", err)
-			delete(session.PendingRetransmission, currentSeq)
-			session.Unlock()
-			continue
+			break
 		}
-		log.Printf("Pesan (seq #%d) terkirim. Menunggu ACK...", currentSeq)
-
-		session.LastSentHash = blake3.Sum256(finalPacketBytes)
-		session.CurrentPort = int(dataMsg.NextPort)
-		session.Sequence++
-		session.Unlock()
 	}
+	log.Println("Input selesai, menutup sesi...")
+	conn.Close()
 }
@@ -0,0 +1,198 @@
+package secureflow
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+const (
+	// tickInterval adalah jeda antar pemeriksaan timer retransmisi dan probe PMTU.
+	tickInterval = 50 * time.Millisecond
+	// closeLinger adalah waktu maksimum Close menunggu data yang belum di-ACK.
+	closeLinger = 3 * time.Second
+)
+
+// Stream adalah aliran byte dua arah yang andal di dalam satu Conn. Stream dibuka klien
+// bernomor genap dan stream dibuka server bernomor ganjil.
+type Stream = protocol.Stream
+
+// Stats adalah statistik congestion control dan MTU satu Conn.
+type Stats = protocol.SessionStats
+
+// Conn adalah satu sesi SecureFlow yang sudah melewati handshake. Read dan Write memakai
+// aliran pesan andal dan berurutan milik sesi sebagai aliran byte; batas pesan tersedia lewat
+// ReadMessage dan WriteMessage. Stream dan datagram tak andal berjalan di sesi yang sama.
+type Conn struct {
+	session       *protocol.Session
+	local, remote net.Addr
+
+	cleanup     func() // Melepas sumber daya transport milik Dial atau Listener
+	releaseOnce sync.Once
+	closeOnce   sync.Once
+
+	readMu  sync.Mutex
+	pending []byte // Sisa pesan yang belum habis dibaca Read
+}
+
+// Read membaca byte berikutnya dari aliran pesan. io.EOF dikembalikan setelah peer menutup sesi.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for len(c.pending) == 0 {
+		message, err := c.session.ReceiveMessage()
+		if err != nil {
+			return 0, readError(err)
+		}
+		c.pending = message
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write mengirim p secara andal dan berurutan. Write kembali setelah semua byte masuk ke
+// jendela kongesti, bukan setelah di-ACK.
+func (c *Conn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := min(len(p)-written, protocol.MaxMessageSize)
+		if err := c.session.SendMessage(p[written : written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// ReadMessage mengembalikan pesan utuh berikutnya yang dikirim peer dengan WriteMessage
+// atau Write. Jangan dicampur dengan Read pada Conn yang sama.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	message, err := c.session.ReceiveMessage()
+	return message, readError(err)
+}
+
+// WriteMessage mengirim message sebagai satu pesan utuh (hingga protocol.MaxMessageSize).
+func (c *Conn) WriteMessage(message []byte) error {
+	return c.session.SendMessage(message)
+}
+
+// OpenStream membuka stream baru ke peer.
+func (c *Conn) OpenStream() (*Stream, error) {
+	return c.session.OpenStream()
+}
+
+// AcceptStream menunggu stream berikutnya yang dibuka peer.
+func (c *Conn) AcceptStream() (*Stream, error) {
+	st, err := c.session.AcceptStream()
+	return st, readError(err)
+}
+
+// SendDatagram mengirim data sebagai datagram tak andal yang tidak pernah dikirim ulang.
+func (c *Conn) SendDatagram(data []byte) error {
+	return c.session.SendDatagram(data)
+}
+
+// ReceiveDatagram menunggu datagram berikutnya dari peer.
+func (c *Conn) ReceiveDatagram() ([]byte, error) {
+	data, err := c.session.ReceiveDatagram()
+	return data, readError(err)
+}
+
+// MaxDatagramSize mengembalikan ukuran data terbesar yang saat ini muat di SendDatagram.
+func (c *Conn) MaxDatagramSize() int {
+	return c.session.MaxDatagramSize()
+}
+
+// SessionID mengembalikan ID sesi yang diberikan server saat handshake.
+func (c *Conn) SessionID() string {
+	return c.session.ID()
+}
+
+// Stats mengembalikan statistik congestion control dan MTU jalur.
+func (c *Conn) Stats() Stats {
+	return c.session.Stats()
+}
+
+// LocalAddr mengembalikan alamat socket lokal yang menerima paket sesi.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr mengembalikan alamat handshake peer. Paket data sendiri berpindah-pindah port.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline mengatur batas waktu baca dan tulis sekaligus.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.session.SetReadDeadline(t)
+	c.session.SetWriteDeadline(t)
+	return nil
+}
+
+// SetReadDeadline mengatur batas waktu Read, ReadMessage, AcceptStream, dan ReceiveDatagram.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.session.SetReadDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline mengatur batas waktu Write, WriteMessage, dan SendDatagram.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.session.SetWriteDeadline(t)
+	return nil
+}
+
+// Close menunggu data yang belum di-ACK paling lama closeLinger, memberi tahu peer, lalu
+// melepas socket dan goroutine sesi. Operasi yang sedang menunggu mengembalikan
+// net.ErrClosed.
+func (c *Conn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		c.session.Drain(time.Now().Add(closeLinger))
+		c.release()
+		err = nil
+	})
+	return err
+}
+
+// release menutup sesi dan sumber daya transportnya tanpa menunggu data yang belum di-ACK.
+func (c *Conn) release() {
+	c.releaseOnce.Do(func() {
+		c.session.Close()
+		c.cleanup()
+	})
+}
+
+// tick menjalankan timer retransmisi dan probe PMTU sampai done ditutup atau sesi diputus.
+func (c *Conn) tick(done <-chan struct{}) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if err := c.session.Tick(now); err != nil {
+				if !errors.Is(err, net.ErrClosed) && !errors.Is(err, protocol.ErrPeerClosed) {
+					log.Printf("[Session %s] Sesi diputus: %v", c.session.ID(), err)
+				}
+				c.release()
+				return
+			}
+		}
+	}
+}
+
+// readError menerjemahkan penutupan oleh peer menjadi io.EOF seperti net.Conn lainnya.
+func readError(err error) error {
+	if errors.Is(err, protocol.ErrPeerClosed) {
+		return io.EOF
+	}
+	return err
+}
@@ -0,0 +1,212 @@
+package secureflow
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+// Dial melakukan handshake dengan server SecureFlow di addr (alamat port handshake) dan
+// mengembalikan *Conn. ctx hanya membatasi handshake; setelah Dial kembali, ctx tidak lagi
+// memengaruhi koneksi.
+func Dial(ctx context.Context, addr string, config *Config) (net.Conn, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	serverAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	transport := config.transport()
+	hopRange := config.PortHopping
+	// Paket server diterima di sekumpulan port; setiap port juga dipakai untuk mengirim
+	// selama slotnya berjalan sehingga kedua arah berpindah 5-tuple bersama
+	recvConns := make([]PacketConn, 0, hopRange.returnPorts())
+	closeAll := func() {
+		for _, conn := range recvConns {
+			conn.Close()
+		}
+	}
+	returnPorts := make([]uint16, 0, hopRange.returnPorts())
+	for range hopRange.returnPorts() {
+		conn, err := transport.Listen(&net.UDPAddr{})
+		if err == nil {
+			err = protocol.DontFragment(conn)
+			recvConns = append(recvConns, conn)
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		returnPorts = append(returnPorts, uint16(conn.LocalAddr().(*net.UDPAddr).Port))
+	}
+
+	result, err := clientHandshake(ctx, transport, serverAddr, addr, config)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	cc, _ := protocol.NewCongestionController(config.CongestionControl)
+	obfs, _ := config.obfuscation()
+	epoch := time.Now()
+	hops := protocol.NewHopSchedule(result.Keys.HopSeed, hopRange.Start, hopRange.End, hopRange.interval(), epoch)
+	returnHops := protocol.NewHopSchedule(result.Keys.ReturnHopSeed, 0, len(recvConns)-1, hopRange.interval(), epoch)
+	returnPortsAcked := false // Dijaga kunci Session (hanya diakses dari hook)
+	session := protocol.NewSession(result.SessionID, result.Keys, true, cc, config.ReceiveWindow, obfs, protocol.SessionHooks{
+		// Setiap paket, termasuk retransmisi, dikirim dari port balasan slot ini ke port hop
+		// server slot ini
+		Output: func(packet []byte) error {
+			now := time.Now()
+			to := &net.UDPAddr{IP: serverAddr.IP, Port: hops.Current(now), Zone: serverAddr.Zone}
+			_, err := recvConns[returnHops.Current(now)].WriteToUDP(packet, to)
+			return err
+		},
+		Prepare: func(msg *protocol.DataMessage, reliable bool) {
+			// Daftar port balasan hanya dikirim sampai server membalas, bukan di setiap paket
+			if !returnPortsAcked {
+				msg.ReturnPorts = returnPorts
+			}
+		},
+		OnReceive: func(msg *protocol.DataMessage, from net.Addr) {
+			returnPortsAcked = true
+		},
+	})
+
+	done := make(chan struct{})
+	c := &Conn{
+		session: session,
+		local:   recvConns[0].LocalAddr(),
+		remote:  serverAddr,
+		cleanup: func() {
+			close(done)
+			closeAll()
+		},
+	}
+	for i, conn := range recvConns {
+		go receiveFromServer(conn, i, returnHops, session)
+	}
+	go c.tick(done)
+	return c, nil
+}
+
+// clientHandshake menjalankan handshake hibrida ke port handshake server. Pembatalan ctx
+// memutus handshake yang sedang menunggu balasan.
+func clientHandshake(ctx context.Context, transport Transport, serverAddr *net.UDPAddr, host string, config *Config) (*protocol.HandshakeResult, error) {
+	conn, err := transport.Listen(&net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var firstUse bool
+	result, err := protocol.HandleClientHandshake(ctx, conn, serverAddr, crypto.DerivePSK(config.AuthKey), serverKeyVerifier(config, host, &firstUse))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("handshake gagal: %w", err)
+	}
+	// Kunci host baru disimpan hanya setelah ServerHello terbukti dibuat oleh pemilik kunci
+	// privatnya, agar ServerHello palsu tidak bisa menanamkan kunci penyerang ke known_hosts
+	if firstUse {
+		if err := crypto.AddKnownHost(config.KnownHostsFile, host, result.ServerStatic); err != nil {
+			return nil, err
+		}
+		log.Printf("⚠️  Server %s belum dikenal, kunci %s disimpan ke %s", host, hex.EncodeToString(result.ServerStatic[:]), config.KnownHostsFile)
+	}
+	return result, nil
+}
+
+// serverKeyVerifier memeriksa kunci statis server terhadap kunci yang di-pin di konfigurasi,
+// atau terhadap file known_hosts (trust-on-first-use) jika tidak ada pin. firstUse diisi true
+// jika host belum ada di known_hosts; pemanggil menyimpannya setelah handshake berhasil.
+func serverKeyVerifier(config *Config, host string, firstUse *bool) protocol.HostKeyVerifier {
+	return func(serverStatic [crypto.KeySize]byte) error {
+		if config.ServerPublicKey != "" {
+			pinned, err := crypto.ParseKey(config.ServerPublicKey)
+			if err != nil {
+				return fmt.Errorf("server_public_key tidak valid: %w", err)
+			}
+			if pinned != serverStatic {
+				return crypto.ErrHostKeyMismatch
+			}
+			return nil
+		}
+		if config.KnownHostsFile == "" {
+			return fmt.Errorf("server_public_key atau known_hosts_file harus diatur")
+		}
+		known, err := crypto.LookupKnownHost(config.KnownHostsFile, host, serverStatic)
+		if err != nil {
+			return err
+		}
+		*firstUse = !known
+		return nil
+	}
+}
+
+// receiveFromServer meneruskan setiap paket dari server yang tiba di port balasan ke-index
+// sesuai jadwal ke sesi sampai socket ditutup.
+func receiveFromServer(conn PacketConn, index int, returnHops *protocol.HopSchedule, session *protocol.Session) {
+	buffer := make([]byte, protocol.MaxPacketSize)
+	var backoff readBackoff
+	for {
+		n, remoteAddr, err := conn.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			if backoff.wait() {
+				log.Printf("[Session %s] Gagal membaca port balasan %d: %v", session.ID(), index, err)
+			}
+			continue
+		}
+		backoff.reset()
+		now := time.Now()
+		if !returnHops.Accepts(index, now) {
+			continue
+		}
+		packet, err := protocol.Deserialize(buffer[:n])
+		if err != nil {
+			continue
+		}
+		err = session.HandlePacket(packet, buffer[:n], remoteAddr, now)
+		// Error yang menutup sesi dilaporkan oleh Conn.tick
+		if err != nil && session.Err() == nil && !errors.Is(err, protocol.ErrUnknownConnID) && !errors.Is(err, protocol.ErrDuplicatePacket) {
+			log.Printf("[Session %s] ⚠️  Paket dari server ditolak: %v", session.ID(), err)
+		}
+	}
+}
+
+// Jeda pembacaan ulang setelah socket gagal dibaca.
+const (
+	readRetryMin = 5 * time.Millisecond
+	readRetryMax = time.Second
+)
+
+// readBackoff menunda pembacaan berikutnya setelah socket gagal dibaca, agar error yang terus
+// berulang tidak membuat goroutine pembaca berputar tanpa henti.
+type readBackoff struct {
+	delay time.Duration
+}
+
+// wait tidur sebelum pembacaan berikutnya dan menggandakan jedanya hingga readRetryMax.
+// Mengembalikan true pada kegagalan pertama dari rangkaian kegagalan berturut-turut, sehingga
+// pemanggil cukup mencatatnya sekali.
+func (b *readBackoff) wait() bool {
+	first := b.delay == 0
+	b.delay = min(max(2*b.delay, readRetryMin), readRetryMax)
+	time.Sleep(b.delay)
+	return first
+}
+
+// reset mengembalikan jeda ke awal setelah pembacaan berhasil.
+func (b *readBackoff) reset() {
+	b.delay = 0
+}
@@ -0,0 +1,270 @@
+package secureflow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+// countingTransport menghitung datagram yang dibaca di setiap port lokal.
+type countingTransport struct {
+	Transport
+	mu       sync.Mutex
+	received map[int]int
+}
+
+type countingConn struct {
+	PacketConn
+	transport *countingTransport
+}
+
+func (t *countingTransport) Listen(addr *net.UDPAddr) (PacketConn, error) {
+	conn, err := t.Transport.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{PacketConn: conn, transport: t}, nil
+}
+
+func (c countingConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	n, addr, err := c.PacketConn.ReadFromUDP(b)
+	if err == nil {
+		c.transport.mu.Lock()
+		c.transport.received[c.LocalAddr().(*net.UDPAddr).Port]++
+		c.transport.mu.Unlock()
+	}
+	return n, addr, err
+}
+
+func TestServerRepliesHopAcrossReturnPorts(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	server, client := testConfig(t), testConfig(t)
+	server.PortHopping.IntervalMS, client.PortHopping.IntervalMS = 20, 20
+	ln := listen(t, network, server)
+
+	counter := &countingTransport{Transport: network.Host(clientIP), received: make(map[int]int)}
+	client.Transport = counter
+	dialed, accepted := dial(t, network, ln, clientIP, client)
+
+	// Port handshake sudah ditutup; datagram berikutnya hanya tiba di port balasan
+	counter.mu.Lock()
+	clear(counter.received)
+	counter.mu.Unlock()
+	for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); {
+		exchange(t, dialed, accepted)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if len(counter.received) < 2 || len(counter.received) > client.PortHopping.ReturnPorts {
+		t.Errorf("paket server tiba di %d port balasan, diharapkan 2-%d: %v", len(counter.received), client.PortHopping.ReturnPorts, counter.received)
+	}
+}
+
+func TestDialRetransmitsLostHandshake(t *testing.T) {
+	// Dengan seed ini ServerHello pertama hilang, sehingga klien mengirim ulang ClientHello
+	// dan server harus menjawab ulang tanpa membuat sesi kedua. Keputusan loss diambil
+	// berurutan dan tidak ada lalu lintas lain selama handshake, jadi urutannya deterministik.
+	network := NewMemoryNetwork(12, LinkConditions{Loss: 0.5})
+	serverTransport := &capturingTransport{Transport: network.Host(serverIP)}
+	serverConfig := testConfig(t)
+	serverConfig.Transport = serverTransport
+	ln, err := Listen("10.0.0.1:5000", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	clientTransport := &capturingTransport{Transport: network.Host(clientIP)}
+	clientConfig := testConfig(t)
+	clientConfig.Transport = clientTransport
+	clientConfig.ServerPublicKey = ln.(*Listener).PublicKey()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dialed, err := Dial(ctx, "10.0.0.1:5000", clientConfig)
+	if err != nil {
+		t.Fatalf("Dial gagal di jaringan yang kehilangan paket: %v", err)
+	}
+	defer dialed.Close()
+	hellos, replies := len(clientTransport.take()), len(serverTransport.take())
+	network.SetConditions(LinkConditions{})
+	if hellos < 2 || replies < 2 {
+		t.Fatalf("%d ClientHello dan %d ServerHello terkirim, diharapkan keduanya dikirim ulang", hellos, replies)
+	}
+
+	accepted, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accepted.Close()
+	exchange(t, dialed.(*Conn), accepted.(*Conn))
+	if n := len(ln.(*Listener).accept); n != 0 {
+		t.Errorf("ServerHello yang dikirim ulang membuat %d sesi tambahan", n)
+	}
+}
+
+// failingConn gagal pada setiap pembacaan sampai ditutup.
+type failingConn struct {
+	PacketConn
+	reads  atomic.Int64
+	closed atomic.Bool
+}
+
+func (c *failingConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	c.reads.Add(1)
+	if c.closed.Load() {
+		return 0, nil, net.ErrClosed
+	}
+	return 0, nil, errors.New("socket rusak")
+}
+
+func TestReceiveFromServerBacksOffOnReadErrors(t *testing.T) {
+	conn := &failingConn{}
+	session := protocol.NewSession("uji", &crypto.KeySchedule{}, true, protocol.NewBBR(), 0, protocol.Obfuscation{}, protocol.SessionHooks{Output: func([]byte) error { return nil }})
+	defer session.Close()
+	done := make(chan struct{})
+	go func() {
+		receiveFromServer(conn, 0, nil, session)
+		close(done)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	// Jeda 5, 10, 20, 40, 80 ms berarti hanya sekitar enam pembacaan dalam 200 ms
+	if reads := conn.reads.Load(); reads > 10 {
+		t.Errorf("%d pembacaan dalam 200 ms, socket yang rusak dibaca tanpa jeda", reads)
+	}
+	conn.closed.Store(true)
+	select {
+	case <-done:
+	case <-time.After(2 * readRetryMax):
+		t.Fatal("receiveFromServer tidak berhenti setelah socket ditutup")
+	}
+}
+
+func TestDialVerifiesServerKey(t *testing.T) {
+	attacker := make([]byte, crypto.KeySize)
+	for i := range attacker {
+		attacker[i] = 0x42
+	}
+	attackerKey := hex.EncodeToString(attacker)
+
+	// forgeServerHello menjawab ClientHello pertama di port handshake dengan ServerHello yang
+	// membawa kunci statis penyerang tetapi tanpa bukti kepemilikan kunci privatnya
+	forgeServerHello := func(t *testing.T, network *MemoryNetwork, config *Config) {
+		conn, err := (&Config{AuthKey: config.AuthKey, Transport: network.Host(serverIP)}).transport().Listen(&net.UDPAddr{IP: serverIP, Port: 5000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		go func() {
+			buffer := make([]byte, protocol.MaxPacketSize)
+			_, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			forged := make([]byte, crypto.HybridCiphertextSize, crypto.HybridCiphertextSize+crypto.KeySize+protocol.NonceSize+32)
+			rand.Read(forged)
+			forged = append(forged, attacker...)
+			forged = append(forged, make([]byte, protocol.NonceSize+32)...)
+			protocol.SendHandshake(conn, from, protocol.HandshakeMsgType, forged)
+		}()
+	}
+
+	tests := []struct {
+		name       string
+		pin        func(ln *Listener) string
+		knownHosts func(ln *Listener) string // Isi awal known_hosts; kosong berarti file belum ada
+		forged     bool
+		err        error
+		want       func(ln *Listener) string // Isi known_hosts setelah Dial; kosong berarti file tidak ada
+	}{
+		{
+			name: "pin cocok",
+			pin:  func(ln *Listener) string { return ln.PublicKey() },
+		},
+		{
+			name: "pin tidak cocok",
+			pin:  func(*Listener) string { return attackerKey },
+			err:  crypto.ErrHostKeyMismatch,
+		},
+		{
+			name: "TOFU pertama kali",
+			want: func(ln *Listener) string { return "10.0.0.1:5000 " + ln.PublicKey() + "\n" },
+		},
+		{
+			name:       "TOFU host dikenal",
+			knownHosts: func(ln *Listener) string { return "10.0.0.1:5000 " + ln.PublicKey() + "\n" },
+			want:       func(ln *Listener) string { return "10.0.0.1:5000 " + ln.PublicKey() + "\n" },
+		},
+		{
+			name:       "TOFU kunci berubah",
+			knownHosts: func(*Listener) string { return "10.0.0.1:5000 " + attackerKey + "\n" },
+			err:        crypto.ErrHostKeyMismatch,
+			want:       func(*Listener) string { return "10.0.0.1:5000 " + attackerKey + "\n" },
+		},
+		{
+			name:   "ServerHello palsu",
+			forged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := NewMemoryNetwork(1, LinkConditions{})
+			var ln *Listener
+			if tt.forged {
+				forgeServerHello(t, network, testConfig(t))
+			} else {
+				ln = listen(t, network, testConfig(t))
+			}
+			config := testConfig(t)
+			config.Transport = network.Host(clientIP)
+			if tt.pin != nil {
+				config.ServerPublicKey = tt.pin(ln)
+			} else {
+				config.KnownHostsFile = filepath.Join(t.TempDir(), "known_hosts")
+				if tt.knownHosts != nil {
+					if err := os.WriteFile(config.KnownHostsFile, []byte(tt.knownHosts(ln)), 0600); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			dialed, err := Dial(ctx, "10.0.0.1:5000", config)
+			if err == nil {
+				dialed.Close()
+			}
+			switch {
+			case tt.forged && err == nil:
+				t.Fatal("Dial berhasil dengan ServerHello palsu")
+			case !tt.forged && !errors.Is(err, tt.err):
+				t.Fatalf("Dial: %v, diharapkan %v", err, tt.err)
+			}
+			if config.KnownHostsFile == "" {
+				return
+			}
+			data, err := os.ReadFile(config.KnownHostsFile)
+			if tt.want == nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("known_hosts ditulis: %q, %v", data, err)
+				}
+				return
+			}
+			if err != nil || string(data) != tt.want(ln) {
+				t.Errorf("known_hosts berisi %q, %v; diharapkan %q", data, err, tt.want(ln))
+			}
+		})
+	}
+}
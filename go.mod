@@ -2,10 +2,12 @@ module github.com/eikarna/SecureFlow
 
 go 1.24.2
 
-require golang.org/x/crypto v0.40.0
+require (
+	golang.org/x/crypto v0.40.0
+	lukechampine.com/blake3 v1.4.1
+)
 
 require (
 	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
 	golang.org/x/sys v0.34.0 // indirect
-	lukechampine.com/blake3 v1.4.1 // indirect
 )
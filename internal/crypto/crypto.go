@@ -1,15 +1,40 @@
 package crypto
 
 import (
+	"crypto/mlkem"
 	"crypto/rand"
 	"fmt"
 
 	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/curve25519"
+	"lukechampine.com/blake3"
 )
 
 const (
 	KeySize = 32 // 32 bytes for X25519 keys
+
+	// Ukuran material kunci ML-KEM-768 (FIPS 203).
+	MLKEMPublicKeySize  = mlkem.EncapsulationKeySize768
+	MLKEMCiphertextSize = mlkem.CiphertextSize768
+
+	// HybridPublicKeySize adalah ukuran kunci publik hibrida klien: representative X25519 ||
+	// ML-KEM-768.
+	HybridPublicKeySize = KeySize + MLKEMPublicKeySize
+	// HybridCiphertextSize adalah ukuran balasan hibrida server: representative X25519 ||
+	// ciphertext ML-KEM-768.
+	HybridCiphertextSize = KeySize + MLKEMCiphertextSize
+
+	hybridCombinerContext = "SecureFlow v1 hybrid X25519+ML-KEM-768 combiner"
+	mixKeyContext         = "SecureFlow v1 mix key"
+	pskContext            = "SecureFlow v1 pre-shared key"
+	handshakeMACContext   = "SecureFlow v1 handshake mac"
+	datagramMaskContext   = "SecureFlow v1 datagram mask"
+
+	// HandshakeMACSize adalah panjang MAC PSK pada pesan handshake pertama.
+	HandshakeMACSize = 16
+
+	// AEADOverhead adalah panjang tag autentikasi yang ditambahkan Encrypt.
+	AEADOverhead = chacha20poly1305.Overhead
 )
 
 // GenerateKeys membuat pasangan kunci privat dan publik untuk X25519.
@@ -32,7 +57,11 @@ func GenerateKeys() ([KeySize]byte, [KeySize]byte, error) {
 // SharedSecret menghitung shared secret menggunakan kunci privat lokal dan kunci publik dari peer.
 func SharedSecret(privateKey, peerPublicKey [KeySize]byte) ([KeySize]byte, error) {
 	var sharedKey [KeySize]byte
-	curve25519.ScalarMult(&sharedKey, &privateKey, &peerPublicKey)
+	out, err := curve25519.X25519(privateKey[:], peerPublicKey[:])
+	if err != nil {
+		return [KeySize]byte{}, fmt.Errorf("gagal menghitung shared secret: %w", err)
+	}
+	copy(sharedKey[:], out)
 	return sharedKey, nil
 }
 
@@ -72,6 +101,138 @@ func Decrypt(key [KeySize]byte, nonce, ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
-// TODO: Implementasi Hybrid Key Exchange
-// func GenerateHybridKeys() (*PQCKeys, error) { ... }
-// func HybridSharedSecret(...) ([]byte, error) { ... }
+// PQCKeys adalah pasangan kunci hibrida (X25519 + ML-KEM-768) milik inisiator handshake.
+type PQCKeys struct {
+	X25519Private        [KeySize]byte
+	X25519Public         [KeySize]byte
+	X25519Representative [KeySize]byte // Representative Elligator2 yang dikirim di jalur
+	MLKEM                *mlkem.DecapsulationKey768
+}
+
+// GenerateHybridKeys membuat pasangan kunci X25519 yang punya representative Elligator2 dan
+// pasangan kunci ML-KEM-768 baru.
+func GenerateHybridKeys() (*PQCKeys, error) {
+	priv, pub, representative, err := GenerateRepresentableKeys()
+	if err != nil {
+		return nil, err
+	}
+	dk, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, fmt.Errorf("gagal membuat kunci ML-KEM: %w", err)
+	}
+	return &PQCKeys{X25519Private: priv, X25519Public: pub, X25519Representative: representative, MLKEM: dk}, nil
+}
+
+// PublicBytes mengembalikan kunci publik hibrida yang dikirim ke server: representative
+// X25519 || ML-KEM-768.
+func (k *PQCKeys) PublicBytes() []byte {
+	out := make([]byte, 0, HybridPublicKeySize)
+	out = append(out, k.X25519Representative[:]...)
+	return append(out, k.MLKEM.EncapsulationKey().Bytes()...)
+}
+
+// HybridEncapsulate dijalankan oleh server. Fungsi ini menerima kunci publik hibrida klien,
+// melakukan X25519 dengan kunci efemeral baru dan enkapsulasi ML-KEM, lalu mengembalikan
+// balasan (representative X25519 || ciphertext ML-KEM) beserta shared secret gabungan.
+// Kunci X25519 kedua arah dikirim sebagai representative Elligator2, sehingga tampak
+// seperti byte acak seragam.
+func HybridEncapsulate(peerPublic []byte) ([]byte, [KeySize]byte, error) {
+	if len(peerPublic) != HybridPublicKeySize {
+		return nil, [KeySize]byte{}, fmt.Errorf("panjang kunci publik hibrida salah: %d", len(peerPublic))
+	}
+	peerX25519 := RepresentativeToPublic([KeySize]byte(peerPublic[:KeySize]))
+	ek, err := mlkem.NewEncapsulationKey768(peerPublic[KeySize:])
+	if err != nil {
+		return nil, [KeySize]byte{}, fmt.Errorf("kunci enkapsulasi ML-KEM tidak valid: %w", err)
+	}
+
+	priv, pub, representative, err := GenerateRepresentableKeys()
+	if err != nil {
+		return nil, [KeySize]byte{}, err
+	}
+	classical, err := SharedSecret(priv, peerX25519)
+	if err != nil {
+		return nil, [KeySize]byte{}, err
+	}
+	pqSecret, ciphertext := ek.Encapsulate()
+
+	response := make([]byte, 0, HybridCiphertextSize)
+	response = append(response, representative[:]...)
+	response = append(response, ciphertext...)
+	return response, combineSecrets(classical, pqSecret, pub, peerX25519), nil
+}
+
+// HybridSharedSecret dijalankan oleh klien. Fungsi ini menggabungkan hasil X25519 dan
+// dekapsulasi ML-KEM dari balasan server menjadi satu shared secret.
+func HybridSharedSecret(keys *PQCKeys, response []byte) ([KeySize]byte, error) {
+	if len(response) != HybridCiphertextSize {
+		return [KeySize]byte{}, fmt.Errorf("panjang balasan hibrida salah: %d", len(response))
+	}
+	peerX25519 := RepresentativeToPublic([KeySize]byte(response[:KeySize]))
+	classical, err := SharedSecret(keys.X25519Private, peerX25519)
+	if err != nil {
+		return [KeySize]byte{}, err
+	}
+	pqSecret, err := keys.MLKEM.Decapsulate(response[KeySize:])
+	if err != nil {
+		return [KeySize]byte{}, fmt.Errorf("gagal dekapsulasi ML-KEM: %w", err)
+	}
+	return combineSecrets(classical, pqSecret, peerX25519, keys.X25519Public), nil
+}
+
+// combineSecrets menurunkan satu kunci dari kedua shared secret, sehingga kunci sesi
+// tetap aman selama salah satu dari X25519 atau ML-KEM-768 belum dipecahkan.
+// Kunci publik X25519 ikut diikat ke dalam kunci, mengikuti combiner X-Wing.
+func combineSecrets(classical [KeySize]byte, pqSecret []byte, serverX25519, clientX25519 [KeySize]byte) [KeySize]byte {
+	material := make([]byte, 0, len(pqSecret)+3*KeySize)
+	material = append(material, pqSecret...)
+	material = append(material, classical[:]...)
+	material = append(material, serverX25519[:]...)
+	material = append(material, clientX25519[:]...)
+
+	var out [KeySize]byte
+	blake3.DeriveKey(out[:], hybridCombinerContext, material)
+	return out
+}
+
+// MixKey mencampurkan material kunci tambahan (misalnya hasil DH statis) ke dalam
+// secret yang sudah ada, mirip operasi MixKey pada Noise Protocol Framework.
+// Hasilnya hanya bisa dihitung oleh pihak yang mengetahui kedua input.
+func MixKey(secret [KeySize]byte, input []byte) [KeySize]byte {
+	material := make([]byte, 0, KeySize+len(input))
+	material = append(material, secret[:]...)
+	material = append(material, input...)
+
+	var out [KeySize]byte
+	blake3.DeriveKey(out[:], mixKeyContext, material)
+	return out
+}
+
+// DerivePSK mengubah auth_key dari konfigurasi (string bebas) menjadi pre-shared key 32 byte.
+func DerivePSK(authKey string) [KeySize]byte {
+	var psk [KeySize]byte
+	blake3.DeriveKey(psk[:], pskContext, []byte(authKey))
+	return psk
+}
+
+// DeriveMaskKey menurunkan kunci penyamaran datagram dari PSK. Kunci ini hanya menyamarkan
+// byte di jalur dan tidak menggantikan AEAD maupun MAC handshake.
+func DeriveMaskKey(psk [KeySize]byte) [KeySize]byte {
+	var key [KeySize]byte
+	blake3.DeriveKey(key[:], datagramMaskContext, psk[:])
+	return key
+}
+
+// HandshakeMAC menghitung MAC berkunci PSK atas pesan handshake. MAC ini murah untuk
+// diperiksa sehingga server bisa membuang handshake tanpa PSK sebelum melakukan
+// operasi kunci publik atau mengalokasikan sesi.
+func HandshakeMAC(psk [KeySize]byte, message []byte) [HandshakeMACSize]byte {
+	var macKey [KeySize]byte
+	blake3.DeriveKey(macKey[:], handshakeMACContext, psk[:])
+	h := blake3.New(HandshakeMACSize, macKey[:])
+	h.Write(message)
+
+	var mac [HandshakeMACSize]byte
+	copy(mac[:], h.Sum(nil))
+	return mac
+}
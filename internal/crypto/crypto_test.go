@@ -0,0 +1,60 @@
+package crypto
+
+import "testing"
+
+func TestHybridRoundTrip(t *testing.T) {
+	client, err := GenerateHybridKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := client.PublicBytes()
+	if len(public) != HybridPublicKeySize {
+		t.Fatalf("kunci publik hibrida %d byte, diharapkan %d", len(public), HybridPublicKeySize)
+	}
+	response, serverSecret, err := HybridEncapsulate(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response) != HybridCiphertextSize {
+		t.Fatalf("balasan hibrida %d byte, diharapkan %d", len(response), HybridCiphertextSize)
+	}
+	clientSecret, err := HybridSharedSecret(client, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientSecret != serverSecret {
+		t.Fatalf("shared secret berbeda: klien %x, server %x", clientSecret, serverSecret)
+	}
+
+	// Enkapsulasi kedua ke kunci yang sama menghasilkan secret baru
+	_, again, err := HybridEncapsulate(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == serverSecret {
+		t.Error("dua enkapsulasi menghasilkan shared secret yang sama")
+	}
+
+	// Ciphertext ML-KEM yang diubah didekapsulasi secara implisit ke secret lain
+	tampered := append([]byte(nil), response...)
+	tampered[len(tampered)-1] ^= 1
+	if secret, err := HybridSharedSecret(client, tampered); err != nil || secret == serverSecret {
+		t.Errorf("ciphertext yang diubah menghasilkan secret %x, %v", secret, err)
+	}
+
+	// Klien lain tidak bisa menurunkan secret yang sama dari balasan ini
+	other, err := GenerateHybridKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := HybridSharedSecret(other, response); err != nil || secret == serverSecret {
+		t.Errorf("klien lain menurunkan secret %x, %v", secret, err)
+	}
+
+	if _, _, err := HybridEncapsulate(public[:len(public)-1]); err == nil {
+		t.Error("kunci publik hibrida yang terpotong diterima")
+	}
+	if _, err := HybridSharedSecret(client, response[:len(response)-1]); err == nil {
+		t.Error("balasan hibrida yang terpotong diterima")
+	}
+}
@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// Elligator2 untuk Curve25519 (Bernstein dkk., "Elligator: Elliptic-curve points
+// indistinguishable from uniform random strings"), dengan non-square u = 2. Aritmetika
+// memakai math/big dan hanya menyentuh nilai publik: perkalian skalar dengan kunci privat
+// tetap dilakukan curve25519 yang waktu eksekusinya konstan.
+
+var (
+	fieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	curveA     = big.NewInt(486662)
+	// representativeMask menyisakan 254 bit representative; dua bit teratas diisi acak.
+	representativeMask = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 254), big.NewInt(1))
+	// halfPrime adalah (p-1)/2, batas atas representative kanonis.
+	halfPrime = new(big.Int).Rsh(fieldPrime, 1)
+	// lowOrderPoints adalah kelipatan titik berorde 8 di Curve25519, indeks k berisi k·T.
+	lowOrderPoints = newLowOrderPoints("39382357235489614581723060781553021112529911719440698176882885853963445705823")
+)
+
+// montgomeryPoint adalah titik afin di kurva Montgomery v² = u³ + Au² + u.
+type montgomeryPoint struct {
+	u, v     *big.Int
+	infinity bool
+}
+
+// newLowOrderPoints membangun tabel k·T untuk k = 0..7 dari koordinat u titik T berorde 8.
+func newLowOrderPoints(u string) [8]montgomeryPoint {
+	t := montgomeryPoint{u: mustParseInt(u)}
+	t.v = new(big.Int).ModSqrt(curveRHS(t.u), fieldPrime)
+	var points [8]montgomeryPoint
+	points[0] = montgomeryPoint{infinity: true}
+	for k := 1; k < 8; k++ {
+		points[k] = addPoints(points[k-1], t)
+	}
+	if !addPoints(points[7], t).infinity {
+		panic("crypto: titik low-order Elligator tidak berorde 8")
+	}
+	return points
+}
+
+func mustParseInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("crypto: konstanta tidak valid: " + s)
+	}
+	return n
+}
+
+// curveRHS menghitung u³ + Au² + u mod p.
+func curveRHS(u *big.Int) *big.Int {
+	out := new(big.Int).Add(u, curveA)
+	out.Mul(out, u)
+	out.Add(out, big.NewInt(1))
+	out.Mul(out, u)
+	return out.Mod(out, fieldPrime)
+}
+
+// addPoints menjumlahkan dua titik afin dengan rumus penjumlahan Montgomery.
+func addPoints(p, q montgomeryPoint) montgomeryPoint {
+	switch {
+	case p.infinity:
+		return q
+	case q.infinity:
+		return p
+	}
+	var slope *big.Int
+	if p.u.Cmp(q.u) == 0 {
+		sumV := new(big.Int).Add(p.v, q.v)
+		if sumV.Mod(sumV, fieldPrime).Sign() == 0 {
+			return montgomeryPoint{infinity: true}
+		}
+		// Penggandaan: λ = (3u² + 2Au + 1) / 2v
+		num := new(big.Int).Mul(big.NewInt(3), p.u)
+		num.Add(num, new(big.Int).Lsh(curveA, 1))
+		num.Mul(num, p.u)
+		num.Add(num, big.NewInt(1))
+		den := new(big.Int).Lsh(p.v, 1)
+		slope = num.Mul(num, den.ModInverse(den, fieldPrime))
+	} else {
+		// λ = (v₂ - v₁) / (u₂ - u₁)
+		num := new(big.Int).Sub(q.v, p.v)
+		den := new(big.Int).Sub(q.u, p.u)
+		den.Mod(den, fieldPrime)
+		slope = num.Mul(num, den.ModInverse(den, fieldPrime))
+	}
+	slope.Mod(slope, fieldPrime)
+	// u₃ = λ² - A - u₁ - u₂, v₃ = λ(u₁ - u₃) - v₁
+	u := new(big.Int).Mul(slope, slope)
+	u.Sub(u, curveA)
+	u.Sub(u, p.u)
+	u.Sub(u, q.u)
+	u.Mod(u, fieldPrime)
+	v := new(big.Int).Sub(p.u, u)
+	v.Mul(v, slope)
+	v.Sub(v, p.v)
+	v.Mod(v, fieldPrime)
+	return montgomeryPoint{u: u, v: v}
+}
+
+// GenerateRepresentableKeys membuat pasangan kunci X25519 efemeral beserta representative
+// Elligator2-nya, seperti obfs4: kunci dibuat ulang sampai koordinat u-nya punya
+// representative (kira-kira separuh kunci). Kunci publik diberi komponen titik low-order
+// acak agar representative tidak bisa dibedakan dari acak lewat uji subgrup prima; komponen
+// itu tidak mengubah shared secret karena skalar X25519 peer selalu kelipatan 8.
+// Representative berupa 32 byte seragam dan harus diubah kembali dengan
+// RepresentativeToPublic sebelum dipakai.
+func GenerateRepresentableKeys() (privateKey, publicKey, representative [KeySize]byte, err error) {
+	var lowOrder [1]byte
+	for {
+		privateKey, publicKey, err = GenerateKeys()
+		if err != nil {
+			return
+		}
+		if _, err = rand.Read(lowOrder[:]); err != nil {
+			return privateKey, publicKey, representative, fmt.Errorf("gagal membuat komponen low-order: %w", err)
+		}
+		u, v, ok := dirtyPublicKey(publicKey, int(lowOrder[0]&7))
+		if !ok {
+			continue
+		}
+		r, ok := elligatorRepresentative(u, v)
+		if !ok {
+			continue
+		}
+		publicKey = fieldToBytes(u)
+		representative = fieldToBytes(r)
+		if _, err = rand.Read(lowOrder[:]); err != nil {
+			return privateKey, publicKey, representative, fmt.Errorf("gagal membuat bit acak representative: %w", err)
+		}
+		// Representative kanonis hanya 254 bit; dua bit teratas diisi acak
+		representative[KeySize-1] |= lowOrder[0] & 0xc0
+		return privateKey, publicKey, representative, nil
+	}
+}
+
+// dirtyPublicKey menambahkan k·T ke titik dengan koordinat u publicKey dan mengembalikan
+// koordinat u dan v hasilnya. Akar v yang dipilih untuk publicKey tidak penting karena
+// X25519 hanya memakai koordinat u; tanda v hasil penjumlahan menentukan cabang
+// representative.
+func dirtyPublicKey(publicKey [KeySize]byte, k int) (u, v *big.Int, ok bool) {
+	u = fieldFromBytes(publicKey)
+	v = new(big.Int).ModSqrt(curveRHS(u), fieldPrime)
+	if v == nil {
+		return nil, nil, false
+	}
+	sum := addPoints(montgomeryPoint{u: u, v: v}, lowOrderPoints[k])
+	if sum.infinity {
+		return nil, nil, false
+	}
+	return sum.u, sum.v, true
+}
+
+// elligatorRepresentative menghitung representative r ≤ (p-1)/2 untuk titik (u, v), atau
+// false jika u tidak punya representative. Seperti obfs4, tanda v memilih cabang pemetaan:
+// r² = -(u + A) / (2u) dipetakan balik lewat cabang w = u, sedangkan r² = -u / (2(u + A))
+// lewat cabang w = -u - A. Memakai satu cabang saja membuat setiap representative lolos uji
+// kuadrat di RepresentativeToPublic, sehingga bisa dibedakan dari 32 byte acak.
+func elligatorRepresentative(u, v *big.Int) (*big.Int, bool) {
+	uPlusA := new(big.Int).Add(u, curveA)
+	uPlusA.Mod(uPlusA, fieldPrime)
+	if u.Sign() == 0 || uPlusA.Sign() == 0 {
+		return nil, false
+	}
+	num, den := new(big.Int).Set(uPlusA), new(big.Int).Lsh(u, 1)
+	if v.Cmp(halfPrime) > 0 {
+		num, den = new(big.Int).Set(u), new(big.Int).Lsh(uPlusA, 1)
+	}
+	den.ModInverse(den, fieldPrime)
+	square := num.Neg(num)
+	square.Mul(square, den)
+	square.Mod(square, fieldPrime)
+	r := new(big.Int).ModSqrt(square, fieldPrime)
+	if r == nil {
+		return nil, false
+	}
+	if r.Cmp(halfPrime) > 0 {
+		r.Sub(fieldPrime, r)
+	}
+	return r, true
+}
+
+// RepresentativeToPublic memetakan representative Elligator2 kembali ke kunci publik X25519.
+// Setiap 32 byte menghasilkan koordinat u yang valid, sehingga fungsi ini tidak pernah gagal.
+func RepresentativeToPublic(representative [KeySize]byte) [KeySize]byte {
+	r := fieldFromBytes(representative)
+	r.And(r, representativeMask)
+	u, _ := elligatorMap(r)
+	return fieldToBytes(u)
+}
+
+// elligatorMap memetakan r ke koordinat u dan melaporkan apakah u = w, yaitu cabang yang
+// dipakai saat w³ + Aw² + w kuadrat.
+func elligatorMap(r *big.Int) (*big.Int, bool) {
+	// w = -A / (1 + 2r²); 1 + 2r² tidak pernah nol karena -1/2 bukan kuadrat
+	den := new(big.Int).Mul(r, r)
+	den.Lsh(den, 1)
+	den.Add(den, big.NewInt(1))
+	den.Mod(den, fieldPrime)
+	w := new(big.Int).Neg(curveA)
+	w.Mul(w, den.ModInverse(den, fieldPrime))
+	w.Mod(w, fieldPrime)
+	// u = w jika w³ + Aw² + w kuadrat, selain itu u = -w - A
+	if big.Jacobi(curveRHS(w), fieldPrime) == -1 {
+		w.Add(w, curveA)
+		w.Neg(w)
+		w.Mod(w, fieldPrime)
+		return w, false
+	}
+	return w, true
+}
+
+// fieldFromBytes membaca elemen field little-endian seperti kunci publik X25519.
+func fieldFromBytes(b [KeySize]byte) *big.Int {
+	be := slices.Clone(b[:])
+	slices.Reverse(be)
+	return new(big.Int).SetBytes(be)
+}
+
+// fieldToBytes menulis elemen field sebagai 32 byte little-endian.
+func fieldToBytes(n *big.Int) [KeySize]byte {
+	var out [KeySize]byte
+	n.FillBytes(out[:])
+	slices.Reverse(out[:])
+	return out
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestElligatorRepresentative(t *testing.T) {
+	const samples = 256
+	direct := 0
+	for range samples {
+		priv, pub, representative, err := GenerateRepresentableKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := RepresentativeToPublic(representative); got != pub {
+			t.Fatalf("RepresentativeToPublic(%x) = %x, diharapkan %x", representative, got, pub)
+		}
+		r := fieldFromBytes(representative)
+		r.And(r, representativeMask)
+		if r.Cmp(halfPrime) > 0 {
+			t.Fatalf("representative %x melebihi (p-1)/2", representative)
+		}
+		if _, onCurve := elligatorMap(r); onCurve {
+			direct++
+		}
+
+		// Komponen low-order tidak mengubah shared secret dengan kunci peer mana pun
+		peerPriv, peerPub, err := GenerateKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ours, err := SharedSecret(priv, peerPub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		theirs, err := SharedSecret(peerPriv, pub)
+		if err != nil || theirs != ours {
+			t.Fatalf("shared secret berbeda: %x dan %x, %v", ours, theirs, err)
+		}
+	}
+	// Representative acak memakai kedua cabang pemetaan kira-kira separuh-separuh; cabang
+	// yang selalu sama membedakan representative dari byte acak
+	if direct < samples/4 || direct > samples*3/4 {
+		t.Errorf("%d dari %d representative memakai cabang u = w", direct, samples)
+	}
+}
+
+func TestElligatorRepresentativeBranches(t *testing.T) {
+	// Titik dan negasinya memakai cabang berbeda, dan keduanya kembali ke u yang sama
+	for range 32 {
+		_, pub, err := GenerateKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := fieldFromBytes(pub)
+		v := new(big.Int).ModSqrt(curveRHS(u), fieldPrime)
+		if v == nil {
+			t.Fatalf("kunci publik %x tidak ada di kurva", pub)
+		}
+		negV := new(big.Int).Sub(fieldPrime, v)
+		r1, ok1 := elligatorRepresentative(u, v)
+		r2, ok2 := elligatorRepresentative(u, negV)
+		if ok1 != ok2 {
+			t.Fatalf("u %x punya representative hanya untuk satu tanda v", pub)
+		}
+		if !ok1 {
+			continue
+		}
+		got1, direct1 := elligatorMap(r1)
+		got2, direct2 := elligatorMap(r2)
+		if got1.Cmp(u) != 0 || got2.Cmp(u) != 0 {
+			t.Fatalf("u %x dipetakan balik ke %x dan %x", pub, fieldToBytes(got1), fieldToBytes(got2))
+		}
+		if direct1 == direct2 {
+			t.Errorf("kedua tanda v untuk u %x memakai cabang yang sama", pub)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// ErrHostKeyMismatch dikembalikan jika kunci statis server tidak sama dengan kunci yang dipercaya.
+var ErrHostKeyMismatch = errors.New("kunci publik server tidak cocok dengan kunci yang dipercaya")
+
+// StaticKeyPair adalah kunci X25519 jangka panjang yang menjadi identitas server.
+type StaticKeyPair struct {
+	Private [KeySize]byte
+	Public  [KeySize]byte
+}
+
+// LoadOrCreateStaticKey membaca kunci privat statis (hex) dari path. Jika file belum ada,
+// kunci baru dibuat dan disimpan dengan izin 0600.
+func LoadOrCreateStaticKey(path string) (*StaticKeyPair, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		priv, pub, err := GenerateKeys()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(priv[:])+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("gagal menyimpan kunci statis: %w", err)
+		}
+		return &StaticKeyPair{Private: priv, Public: pub}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca kunci statis: %w", err)
+	}
+
+	priv, err := ParseKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("file kunci statis %s tidak valid: %w", path, err)
+	}
+	pub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("gagal menghitung kunci publik statis: %w", err)
+	}
+	pair := &StaticKeyPair{Private: priv}
+	copy(pair.Public[:], pub)
+	return pair, nil
+}
+
+// ParseKey mengubah string hex 64 karakter menjadi kunci 32 byte.
+func ParseKey(s string) ([KeySize]byte, error) {
+	var key [KeySize]byte
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return key, fmt.Errorf("kunci bukan hex yang valid: %w", err)
+	}
+	if len(raw) != KeySize {
+		return key, fmt.Errorf("panjang kunci salah: %d byte", len(raw))
+	}
+	copy(key[:], raw)
+	return key, nil
+}
+
+// LookupKnownHost memeriksa kunci statis server terhadap file known_hosts (trust-on-first-use).
+// Setiap baris berformat "<host> <kunci hex>". Mengembalikan true jika host dikenal dengan kunci
+// yang sama, false jika host belum dikenal, dan ErrHostKeyMismatch jika host dikenal dengan
+// kunci berbeda. File tidak pernah diubah; host baru disimpan dengan AddKnownHost setelah
+// server membuktikan kepemilikan kuncinya.
+func LookupKnownHost(path, host string, key [KeySize]byte) (bool, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("gagal membuka known_hosts: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != host {
+			continue
+		}
+		known, err := ParseKey(fields[1])
+		if err != nil {
+			return false, fmt.Errorf("entri known_hosts untuk %s rusak: %w", host, err)
+		}
+		if known != key {
+			return false, ErrHostKeyMismatch
+		}
+		return true, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("gagal membaca known_hosts: %w", err)
+	}
+	return false, nil
+}
+
+// AddKnownHost menambahkan kunci statis host ke file known_hosts, membuat file jika belum ada.
+func AddKnownHost(path, host string, key [KeySize]byte) error {
+	out, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("gagal menulis known_hosts: %w", err)
+	}
+	defer out.Close()
+	if _, err := fmt.Fprintf(out, "%s %s\n", host, hex.EncodeToString(key[:])); err != nil {
+		return fmt.Errorf("gagal menulis known_hosts: %w", err)
+	}
+	return nil
+}
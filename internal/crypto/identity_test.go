@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKnownHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key, other := [KeySize]byte{1}, [KeySize]byte{2}
+
+	// Lookup host yang belum dikenal tidak membuat atau mengubah file
+	if known, err := LookupKnownHost(path, "server:5000", key); known || err != nil {
+		t.Fatalf("host baru: known %v, %v", known, err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LookupKnownHost membuat known_hosts: %v", err)
+	}
+
+	if err := AddKnownHost(path, "server:5000", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddKnownHost(path, "lain:5000", other); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		host  string
+		key   [KeySize]byte
+		known bool
+		err   error
+	}{
+		{"kunci sama", "server:5000", key, true, nil},
+		{"kunci berbeda", "server:5000", other, false, ErrHostKeyMismatch},
+		{"host lain", "lain:5000", other, true, nil},
+		{"host belum dikenal", "baru:5000", key, false, nil},
+	}
+	for _, tt := range tests {
+		known, err := LookupKnownHost(path, tt.host, tt.key)
+		if known != tt.known || !errors.Is(err, tt.err) {
+			t.Errorf("%s: known %v, %v; diharapkan %v, %v", tt.name, known, err, tt.known, tt.err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("server:5000 bukan-hex\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupKnownHost(path, "server:5000", key); err == nil {
+		t.Error("entri known_hosts yang rusak diterima")
+	}
+}
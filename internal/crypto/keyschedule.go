@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"lukechampine.com/blake3"
+)
+
+// Label HKDF-Expand untuk setiap kunci turunan. Mengubah label berarti mengubah protokol.
+const (
+	labelClientToServer = "secureflow v1 c2s traffic"
+	labelServerToClient = "secureflow v1 s2c traffic"
+	labelClientHeader   = "secureflow v1 c2s header"
+	labelServerHeader   = "secureflow v1 s2c header"
+	labelClientConnID   = "secureflow v1 c2s conn id"
+	labelServerConnID   = "secureflow v1 s2c conn id"
+	labelHopSeed        = "secureflow v1 hop seed"
+	labelReturnHopSeed  = "secureflow v1 s2c hop seed"
+)
+
+// KeySchedule berisi semua kunci sesi yang diturunkan dari hasil handshake.
+// Setiap arah memiliki kunci trafik dan kunci header-protection sendiri, sehingga
+// nonce dan keystream tidak pernah dipakai bersama oleh klien dan server.
+type KeySchedule struct {
+	ClientToServer [KeySize]byte // Kunci AEAD untuk paket klien→server
+	ServerToClient [KeySize]byte // Kunci AEAD untuk paket server→klien
+	ClientHeader   [KeySize]byte // Kunci header-protection klien→server
+	ServerHeader   [KeySize]byte // Kunci header-protection server→klien
+	ClientConnID   [KeySize]byte // Kunci PRF connection ID klien→server
+	ServerConnID   [KeySize]byte // Kunci PRF connection ID server→klien
+	HopSeed        [KeySize]byte // Seed bersama untuk jadwal port hopping klien→server
+	ReturnHopSeed  [KeySize]byte // Seed bersama untuk jadwal port balasan server→klien
+}
+
+// NewKeySchedule menurunkan KeySchedule dengan HKDF-SHA256. Shared secret dari
+// handshake menjadi input keying material, sedangkan hash BLAKE3 dari transkrip
+// handshake (seluruh pesan handshake, sesuai urutan) menjadi salt. Dengan begitu
+// setiap kunci terikat pada handshake yang benar-benar terjadi.
+func NewKeySchedule(sharedSecret [KeySize]byte, transcript ...[]byte) (*KeySchedule, error) {
+	transcriptHash := TranscriptHash(transcript...)
+	prk, err := hkdf.Extract(sha256.New, sharedSecret[:], transcriptHash[:])
+	if err != nil {
+		return nil, fmt.Errorf("gagal HKDF-Extract: %w", err)
+	}
+
+	ks := &KeySchedule{}
+	outputs := []struct {
+		label string
+		dst   *[KeySize]byte
+	}{
+		{labelClientToServer, &ks.ClientToServer},
+		{labelServerToClient, &ks.ServerToClient},
+		{labelClientHeader, &ks.ClientHeader},
+		{labelServerHeader, &ks.ServerHeader},
+		{labelClientConnID, &ks.ClientConnID},
+		{labelServerConnID, &ks.ServerConnID},
+		{labelHopSeed, &ks.HopSeed},
+		{labelReturnHopSeed, &ks.ReturnHopSeed},
+	}
+	for _, out := range outputs {
+		key, err := hkdf.Expand(sha256.New, prk, out.label, KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("gagal HKDF-Expand %q: %w", out.label, err)
+		}
+		copy(out.dst[:], key)
+	}
+	return ks, nil
+}
+
+// TrafficKeys mengembalikan kunci kirim dan kunci terima untuk satu sisi sesi.
+func (ks *KeySchedule) TrafficKeys(isClient bool) (send, recv [KeySize]byte) {
+	if isClient {
+		return ks.ClientToServer, ks.ServerToClient
+	}
+	return ks.ServerToClient, ks.ClientToServer
+}
+
+// ConnIDKeys mengembalikan kunci connection ID untuk paket yang dikirim dan diterima satu sisi sesi.
+func (ks *KeySchedule) ConnIDKeys(isClient bool) (send, recv [KeySize]byte) {
+	if isClient {
+		return ks.ClientConnID, ks.ServerConnID
+	}
+	return ks.ServerConnID, ks.ClientConnID
+}
+
+// HeaderKeys mengembalikan kunci header-protection untuk paket yang dikirim dan diterima satu sisi sesi.
+func (ks *KeySchedule) HeaderKeys(isClient bool) (send, recv [KeySize]byte) {
+	if isClient {
+		return ks.ClientHeader, ks.ServerHeader
+	}
+	return ks.ServerHeader, ks.ClientHeader
+}
+
+// TranscriptHash menghitung hash BLAKE3 atas pesan-pesan handshake. Setiap bagian
+// diawali panjangnya agar batas antar pesan tidak ambigu.
+func TranscriptHash(parts ...[]byte) [KeySize]byte {
+	h := blake3.New(KeySize, nil)
+	var lenBuf [4]byte
+	for _, part := range parts {
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(part)))
+		h.Write(lenBuf[:])
+		h.Write(part)
+	}
+	var out [KeySize]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
@@ -0,0 +1,56 @@
+package crypto
+
+import "testing"
+
+func TestNewKeySchedule(t *testing.T) {
+	secret := [KeySize]byte{1, 2, 3}
+	hello, response := []byte("client hello"), []byte("server hello")
+	client, err := NewKeySchedule(secret, hello, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewKeySchedule(secret, hello, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *client != *server {
+		t.Fatal("klien dan server menurunkan kunci berbeda dari secret dan transkrip yang sama")
+	}
+
+	// Setiap kunci turunan berbeda satu sama lain
+	keys := [][KeySize]byte{client.ClientToServer, client.ServerToClient, client.ClientHeader, client.ServerHeader, client.ClientConnID, client.ServerConnID, client.HopSeed, client.ReturnHopSeed}
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if keys[i] == keys[j] {
+				t.Errorf("kunci turunan %d dan %d sama", i, j)
+			}
+		}
+	}
+	clientSend, clientRecv := client.TrafficKeys(true)
+	serverSend, serverRecv := server.TrafficKeys(false)
+	if clientSend != serverRecv || clientRecv != serverSend {
+		t.Error("kunci trafik klien dan server tidak berpasangan")
+	}
+
+	tests := []struct {
+		name       string
+		secret     [KeySize]byte
+		transcript [][]byte
+	}{
+		{"secret lain", [KeySize]byte{1, 2, 4}, [][]byte{hello, response}},
+		{"ClientHello lain", secret, [][]byte{[]byte("client hellO"), response}},
+		{"ServerHello lain", secret, [][]byte{hello, []byte("server hellO")}},
+		{"urutan pesan tertukar", secret, [][]byte{response, hello}},
+		// Batas antarpesan ikut di-hash, jadi memindahkan byte antarpesan mengubah kunci
+		{"batas pesan bergeser", secret, [][]byte{[]byte("client hellos"), []byte("erver hello")}},
+	}
+	for _, tt := range tests {
+		ks, err := NewKeySchedule(tt.secret, tt.transcript...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ks.ClientToServer == client.ClientToServer || ks.ServerToClient == client.ServerToClient || ks.HopSeed == client.HopSeed {
+			t.Errorf("%s: kunci sama dengan transkrip asli", tt.name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package protocol
+
+import (
+	"slices"
+	"sort"
+)
+
+// MaxAckRanges adalah jumlah maksimum rentang SACK yang dibawa satu pesan.
+const MaxAckRanges = 16
+
+// AckRange adalah rentang nomor urut yang sudah diterima, inklusif di kedua ujung.
+type AckRange struct {
+	Start uint64
+	End   uint64
+}
+
+// Contains mengembalikan true jika seq berada di dalam rentang.
+func (r AckRange) Contains(seq uint64) bool {
+	return seq >= r.Start && seq <= r.End
+}
+
+// AckTracker mencatat nomor urut yang sudah diterima dan menghasilkan rentang
+// selective acknowledgement (SACK). Hanya MaxAckRanges rentang tertinggi yang
+// disimpan; rentang yang lebih lama dianggap sudah diketahui pengirim. Nomor urut yang
+// lebih tua dari semua rentang tersimpan, misalnya retransmisi paket yang ACK-nya hilang
+// saat ada lebih dari MaxAckRanges celah, dilaporkan sekali di Ranges berikutnya.
+type AckTracker struct {
+	ranges []AckRange // Terurut naik, tidak tumpang tindih
+	late   []uint64   // Nomor urut lama yang belum dilaporkan
+}
+
+// Add mencatat seq sebagai sudah diterima. Mengembalikan false jika seq sudah pernah dicatat
+// atau lebih tua dari semua rentang yang masih disimpan.
+func (t *AckTracker) Add(seq uint64) bool {
+	i := sort.Search(len(t.ranges), func(i int) bool { return t.ranges[i].End >= seq })
+	if i < len(t.ranges) && t.ranges[i].Contains(seq) {
+		return false
+	}
+	if len(t.ranges) > 0 && i == 0 && seq < t.ranges[0].Start && len(t.ranges) >= MaxAckRanges {
+		// Lebih tua dari semua rentang yang masih disimpan
+		if len(t.late) < MaxAckRanges/2 && !slices.Contains(t.late, seq) {
+			t.late = append(t.late, seq)
+		}
+		return false
+	}
+
+	extendsPrev := i > 0 && t.ranges[i-1].End+1 == seq
+	extendsNext := i < len(t.ranges) && t.ranges[i].Start == seq+1
+	switch {
+	case extendsPrev && extendsNext:
+		t.ranges[i-1].End = t.ranges[i].End
+		t.ranges = append(t.ranges[:i], t.ranges[i+1:]...)
+	case extendsPrev:
+		t.ranges[i-1].End = seq
+	case extendsNext:
+		t.ranges[i].Start = seq
+	default:
+		t.ranges = append(t.ranges, AckRange{})
+		copy(t.ranges[i+1:], t.ranges[i:])
+		t.ranges[i] = AckRange{Start: seq, End: seq}
+	}
+	if len(t.ranges) > MaxAckRanges {
+		t.ranges = t.ranges[len(t.ranges)-MaxAckRanges:]
+	}
+	return true
+}
+
+// Contains mengembalikan true jika seq sudah tercatat.
+func (t *AckTracker) Contains(seq uint64) bool {
+	for _, r := range t.ranges {
+		if r.Contains(seq) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ranges mengembalikan salinan rentang SACK, dimulai dari rentang tertinggi, diikuti nomor
+// urut lama yang belum dilaporkan menggantikan rentang tersimpan terendah.
+func (t *AckTracker) Ranges() []AckRange {
+	kept := min(len(t.ranges), MaxAckRanges-len(t.late))
+	out := make([]AckRange, 0, kept+len(t.late))
+	for i := len(t.ranges) - 1; i >= len(t.ranges)-kept; i-- {
+		out = append(out, t.ranges[i])
+	}
+	for _, seq := range t.late {
+		out = append(out, AckRange{Start: seq, End: seq})
+	}
+	t.late = t.late[:0]
+	return out
+}
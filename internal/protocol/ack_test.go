@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAckTrackerMergesRanges(t *testing.T) {
+	var tracker AckTracker
+	steps := []struct {
+		seq   uint64
+		added bool
+		want  []AckRange
+	}{
+		{1, true, []AckRange{{1, 1}}},
+		{3, true, []AckRange{{3, 3}, {1, 1}}},
+		{2, true, []AckRange{{1, 3}}},
+		{2, false, []AckRange{{1, 3}}},
+		{0, true, []AckRange{{0, 3}}},
+		{9, true, []AckRange{{9, 9}, {0, 3}}},
+		{8, true, []AckRange{{8, 9}, {0, 3}}},
+		{4, true, []AckRange{{8, 9}, {0, 4}}},
+	}
+	for _, step := range steps {
+		if added := tracker.Add(step.seq); added != step.added {
+			t.Errorf("Add(%d) = %v, diharapkan %v", step.seq, added, step.added)
+		}
+		if got := tracker.Ranges(); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("setelah Add(%d): rentang %v, diharapkan %v", step.seq, got, step.want)
+		}
+	}
+	for seq, want := range map[uint64]bool{0: true, 4: true, 5: false, 8: true, 10: false} {
+		if got := tracker.Contains(seq); got != want {
+			t.Errorf("Contains(%d) = %v, diharapkan %v", seq, got, want)
+		}
+	}
+}
+
+func TestAckTrackerKeepsHighestRanges(t *testing.T) {
+	var tracker AckTracker
+	for i := range MaxAckRanges + 4 {
+		tracker.Add(uint64(2 * i))
+	}
+	ranges := tracker.Ranges()
+	if len(ranges) != MaxAckRanges {
+		t.Fatalf("%d rentang disimpan, diharapkan %d", len(ranges), MaxAckRanges)
+	}
+	if highest := uint64(2 * (MaxAckRanges + 3)); ranges[0] != (AckRange{highest, highest}) {
+		t.Errorf("rentang pertama %v, diharapkan #%d", ranges[0], highest)
+	}
+	if tracker.Add(0) {
+		t.Error("nomor urut yang lebih tua dari semua rentang tersimpan dicatat ulang")
+	}
+	// Nomor urut lama tetap dilaporkan sekali agar retransmisinya berhenti
+	ranges = tracker.Ranges()
+	if len(ranges) != MaxAckRanges || ranges[len(ranges)-1] != (AckRange{0, 0}) {
+		t.Errorf("nomor urut lama tidak dilaporkan: %v", ranges)
+	}
+	if ranges = tracker.Ranges(); ranges[len(ranges)-1] == (AckRange{0, 0}) {
+		t.Error("nomor urut lama dilaporkan lebih dari sekali")
+	}
+}
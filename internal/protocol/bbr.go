@@ -0,0 +1,268 @@
+package protocol
+
+import (
+	"time"
+)
+
+// Parameter BBR mengikuti draft BBRv2 (draft-cardwell-iccrg-bbr-congestion-control).
+const (
+	bbrStartupGain     = 2.77
+	bbrDrainGain       = 1 / bbrStartupGain
+	bbrCwndGain        = 2.0
+	bbrBwWindowRounds  = 10
+	bbrMinRTTWindow    = 10 * time.Second
+	bbrProbeRTTTime    = 200 * time.Millisecond
+	bbrMinCwnd         = 4 * CongestionMSS
+	bbrInitialCwnd     = 10 * CongestionMSS
+	bbrFullBwThreshold = 1.25
+	bbrFullBwRounds    = 3
+	bbrLossThreshold   = 0.02 // Laju loss per ronde yang dianggap sinyal kongesti (BBRv2)
+	bbrInflightBeta    = 0.7  // Reduksi inflight_hi saat loss melewati ambang
+	bbrDefaultRTT      = 100 * time.Millisecond
+)
+
+// Gain pacing untuk siklus ProbeBW: naik, turun, lalu jelajah.
+var bbrProbeBWGains = [...]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+type bbrState int
+
+const (
+	bbrStartup bbrState = iota
+	bbrDrain
+	bbrProbeBW
+	bbrProbeRTT
+)
+
+// bbrSentPacket adalah keadaan pengiriman yang dicatat untuk sampel laju pengiriman.
+type bbrSentPacket struct {
+	delivered     int
+	deliveredTime time.Time
+	sentTime      time.Time
+}
+
+// BBR adalah congestion controller berbasis model (bandwidth bottleneck dan RTT minimum)
+// mengikuti BBRv2: laju pengiriman dikendalikan oleh pacing, dan loss di atas ambang
+// membatasi inflight lewat inflight_hi.
+type BBR struct {
+	state      bbrState
+	pacingGain float64
+	cwndGain   float64
+	cwnd       int
+
+	// Sampler laju pengiriman
+	sent          map[uint64]bbrSentPacket
+	delivered     int
+	deliveredTime time.Time
+
+	// Filter bandwidth maksimum per ronde
+	bwSamples         [bbrBwWindowRounds]float64
+	round             uint64
+	nextRoundDelivery int
+
+	// Filter RTT minimum
+	minRTT          time.Duration
+	minRTTStamp     time.Time
+	probeRTTDone    time.Time
+	probeRTTEntered bool
+
+	// Deteksi pipa penuh saat Startup
+	fullBw      float64
+	fullBwCount int
+
+	// Respons loss BBRv2
+	inflightHi int
+	roundLost  int
+	roundAcked int
+	cycleIndex int
+	cycleStamp time.Time
+}
+
+// NewBBR membuat controller BBR dalam keadaan Startup.
+func NewBBR() *BBR {
+	return &BBR{
+		state:      bbrStartup,
+		pacingGain: bbrStartupGain,
+		cwndGain:   bbrCwndGain,
+		cwnd:       bbrInitialCwnd,
+		sent:       make(map[uint64]bbrSentPacket),
+	}
+}
+
+func (b *BBR) Name() string { return CongestionBBR }
+
+func (b *BBR) OnPacketSent(now time.Time, seq uint64, bytes int, bytesInFlight int) {
+	if bytesInFlight == 0 || b.deliveredTime.IsZero() {
+		b.deliveredTime = now
+	}
+	b.sent[seq] = bbrSentPacket{
+		delivered:     b.delivered,
+		deliveredTime: b.deliveredTime,
+		sentTime:      now,
+	}
+}
+
+func (b *BBR) OnAck(now time.Time, seq uint64, bytes int, rtt time.Duration, bytesInFlight int) {
+	p, ok := b.sent[seq]
+	delete(b.sent, seq)
+	b.delivered += bytes
+	b.deliveredTime = now
+	b.roundAcked += bytes
+
+	if rtt > 0 && (b.minRTT == 0 || rtt <= b.minRTT || now.Sub(b.minRTTStamp) > bbrMinRTTWindow) {
+		b.minRTT = rtt
+		b.minRTTStamp = now
+	}
+
+	roundStart := false
+	if ok && p.delivered >= b.nextRoundDelivery {
+		b.nextRoundDelivery = b.delivered
+		b.round++
+		roundStart = true
+		b.bwSamples[b.round%bbrBwWindowRounds] = 0
+	}
+	if ok {
+		interval := max(now.Sub(p.deliveredTime), now.Sub(p.sentTime))
+		if interval > 0 {
+			rate := float64(b.delivered-p.delivered) / interval.Seconds()
+			slot := b.round % bbrBwWindowRounds
+			b.bwSamples[slot] = max(b.bwSamples[slot], rate)
+		}
+	}
+
+	if roundStart {
+		b.onRoundStart(now)
+	}
+	b.updateState(now, bytesInFlight)
+	b.updateCwnd()
+}
+
+// onRoundStart memeriksa pipa penuh dan laju loss setiap satu ronde RTT.
+func (b *BBR) onRoundStart(now time.Time) {
+	lossRate := 0.0
+	if total := b.roundAcked + b.roundLost; total > 0 {
+		lossRate = float64(b.roundLost) / float64(total)
+	}
+	if lossRate > bbrLossThreshold {
+		inflight := max(b.cwnd, b.bdp())
+		b.inflightHi = max(int(float64(inflight)*bbrInflightBeta), bbrMinCwnd)
+		if b.state == bbrStartup {
+			b.enterDrain()
+		}
+	}
+	b.roundAcked, b.roundLost = 0, 0
+
+	if b.state != bbrStartup {
+		return
+	}
+	bw := b.BandwidthEstimate()
+	if bw >= b.fullBw*bbrFullBwThreshold {
+		b.fullBw = bw
+		b.fullBwCount = 0
+		return
+	}
+	b.fullBwCount++
+	if b.fullBwCount >= bbrFullBwRounds {
+		b.enterDrain()
+	}
+}
+
+func (b *BBR) enterDrain() {
+	b.state = bbrDrain
+	b.pacingGain = bbrDrainGain
+}
+
+func (b *BBR) updateState(now time.Time, bytesInFlight int) {
+	switch b.state {
+	case bbrDrain:
+		if bytesInFlight <= b.bdp() {
+			b.state = bbrProbeBW
+			b.cycleIndex = 0
+			b.cycleStamp = now
+			b.pacingGain = bbrProbeBWGains[0]
+		}
+	case bbrProbeBW:
+		if now.Sub(b.cycleStamp) > b.rtt() {
+			b.cycleIndex = (b.cycleIndex + 1) % len(bbrProbeBWGains)
+			b.cycleStamp = now
+			b.pacingGain = bbrProbeBWGains[b.cycleIndex]
+			if b.cycleIndex == 0 {
+				// Setiap siklus probe naik, beri kesempatan inflight_hi tumbuh lagi
+				b.inflightHi += CongestionMSS
+			}
+		}
+	case bbrProbeRTT:
+		if now.After(b.probeRTTDone) {
+			b.minRTTStamp = now
+			b.state = bbrProbeBW
+			b.cycleStamp = now
+			b.pacingGain = 1
+		}
+		return
+	}
+	if b.state != bbrStartup && b.minRTT > 0 && now.Sub(b.minRTTStamp) > bbrMinRTTWindow {
+		b.state = bbrProbeRTT
+		b.pacingGain = 1
+		b.probeRTTDone = now.Add(max(bbrProbeRTTTime, b.minRTT))
+	}
+}
+
+func (b *BBR) updateCwnd() {
+	if b.state == bbrProbeRTT {
+		b.cwnd = bbrMinCwnd
+		return
+	}
+	target := bbrInitialCwnd
+	if bw := b.BandwidthEstimate(); bw > 0 {
+		target = max(int(b.cwndGain*float64(b.bdp())), bbrMinCwnd)
+	}
+	if b.inflightHi > 0 {
+		target = min(target, b.inflightHi)
+	}
+	if b.state == bbrStartup {
+		// Di Startup cwnd hanya boleh tumbuh
+		target = max(target, b.cwnd)
+	}
+	b.cwnd = target
+}
+
+func (b *BBR) OnLoss(now time.Time, seq uint64, bytes int, sentTime time.Time) {
+	delete(b.sent, seq)
+	b.roundLost += bytes
+}
+
+func (b *BBR) CanSend(bytesInFlight int) bool {
+	return bytesInFlight < b.cwnd
+}
+
+func (b *BBR) CongestionWindow() int {
+	return b.cwnd
+}
+
+func (b *BBR) PacingRate() float64 {
+	bw := b.BandwidthEstimate()
+	if bw == 0 {
+		// Belum ada sampel: sebar jendela awal sepanjang satu RTT
+		bw = float64(bbrInitialCwnd) / b.rtt().Seconds()
+	}
+	return b.pacingGain * bw
+}
+
+func (b *BBR) BandwidthEstimate() float64 {
+	best := 0.0
+	for _, s := range b.bwSamples {
+		best = max(best, s)
+	}
+	return best
+}
+
+// bdp mengembalikan bandwidth-delay product dari model saat ini.
+func (b *BBR) bdp() int {
+	return int(b.BandwidthEstimate() * b.rtt().Seconds())
+}
+
+func (b *BBR) rtt() time.Duration {
+	if b.minRTT == 0 {
+		return bbrDefaultRTT
+	}
+	return b.minRTT
+}
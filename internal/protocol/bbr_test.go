@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// simulateBottleneck mengirim paket sebanyak yang diizinkan cc melalui link FIFO dengan
+// bandwidth bw byte/detik dan RTT dasar rtt selama duration, lalu mengembalikan waktu akhir.
+func simulateBottleneck(cc CongestionController, bw float64, rtt, duration time.Duration) time.Time {
+	type ack struct {
+		seq  uint64
+		sent time.Time
+		at   time.Time
+	}
+	now := time.Unix(1000, 0)
+	end := now.Add(duration)
+	serialize := time.Duration(CongestionMSS / bw * float64(time.Second))
+	var acks []ack
+	var seq uint64
+	var departure time.Time
+	inFlight := 0
+	for now.Before(end) {
+		for cc.CanSend(inFlight) {
+			cc.OnPacketSent(now, seq, CongestionMSS, inFlight)
+			inFlight += CongestionMSS
+			departure = maxTime(departure, now).Add(serialize)
+			acks = append(acks, ack{seq: seq, sent: now, at: departure.Add(rtt)})
+			seq++
+		}
+		next := acks[0]
+		acks = acks[1:]
+		now = next.at
+		inFlight -= CongestionMSS
+		cc.OnAck(now, next.seq, CongestionMSS, now.Sub(next.sent), inFlight)
+	}
+	return now
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func TestBBRConvergesOnBottleneck(t *testing.T) {
+	tests := []struct {
+		name string
+		bw   float64 // byte/detik
+		rtt  time.Duration
+	}{
+		{"1 MB/s, 50 ms", 1e6, 50 * time.Millisecond},
+		{"10 MB/s, 20 ms", 10e6, 20 * time.Millisecond},
+		{"200 KB/s, 200 ms", 200e3, 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		b := NewBBR()
+		simulateBottleneck(b, tt.bw, tt.rtt, 5*time.Second)
+
+		if b.state == bbrStartup {
+			t.Errorf("%s: masih Startup setelah 5 detik", tt.name)
+		}
+		if est := b.BandwidthEstimate(); math.Abs(est-tt.bw)/tt.bw > 0.1 {
+			t.Errorf("%s: estimasi bandwidth %.0f byte/detik, diharapkan %.0f ±10%%", tt.name, est, tt.bw)
+		}
+		serialize := time.Duration(CongestionMSS / tt.bw * float64(time.Second))
+		if b.minRTT < tt.rtt || b.minRTT > tt.rtt+2*serialize {
+			t.Errorf("%s: RTT minimum %v, diharapkan %v", tt.name, b.minRTT, tt.rtt)
+		}
+		// cwnd mengikuti dua kali BDP, tidak kurang dari bbrMinCwnd
+		bdp := tt.bw * tt.rtt.Seconds()
+		want := max(bbrCwndGain*bdp, bbrMinCwnd)
+		if math.Abs(float64(b.cwnd)-want)/want > 0.15 {
+			t.Errorf("%s: cwnd %d byte, diharapkan sekitar %.0f (BDP %.0f)", tt.name, b.cwnd, want, bdp)
+		}
+	}
+}
+
+func TestBBRLossCapsInflight(t *testing.T) {
+	b := NewBBR()
+	now := simulateBottleneck(b, 1e6, 50*time.Millisecond, 2*time.Second)
+	cwnd := b.cwnd
+
+	// Satu ronde dengan loss di atas bbrLossThreshold menurunkan inflight_hi
+	for seq := uint64(1 << 20); seq < 1<<20+20; seq++ {
+		b.OnPacketSent(now, seq, CongestionMSS, 0)
+	}
+	for seq := uint64(1 << 20); seq < 1<<20+5; seq++ {
+		b.OnLoss(now, seq, CongestionMSS, now)
+	}
+	now = now.Add(60 * time.Millisecond)
+	for seq := uint64(1<<20 + 5); seq < 1<<20+20; seq++ {
+		b.OnAck(now, seq, CongestionMSS, 60*time.Millisecond, 0)
+	}
+	if b.inflightHi == 0 || b.cwnd > int(float64(max(cwnd, b.bdp()))*bbrInflightBeta)+1 {
+		t.Errorf("cwnd %d, inflight_hi %d setelah loss 25%%; cwnd sebelumnya %d", b.cwnd, b.inflightHi, cwnd)
+	}
+	if b.cwnd < bbrMinCwnd {
+		t.Errorf("cwnd %d di bawah bbrMinCwnd", b.cwnd)
+	}
+}
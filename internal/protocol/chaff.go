@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Obfuscation mengatur penyamaran lalu lintas satu sesi. Nilai nol berarti tanpa penyamaran.
+type Obfuscation struct {
+	Padding PaddingPolicy // Ukuran datagram yang dikirim; nil berarti tanpa padding
+	// ChaffRate adalah anggaran paket chaff dalam byte per detik; nol berarti tanpa chaff.
+	// Diabaikan pada TimingConstant, yang sudah mengisi slot kosong dengan chaff.
+	ChaffRate int
+	Timing    Timing // Waktu kirim datagram
+}
+
+// ChaffScheduler menjadwalkan paket chaff sebagai proses Poisson dengan anggaran rate byte
+// per detik. Setiap paket yang terkirim, chaff maupun data, menjadwalkan ulang chaff
+// berikutnya sejauh waktu acak eksponensial yang sebanding dengan ukurannya. Selama lalu
+// lintas asli melebihi anggaran, chaff tidak pernah jatuh tempo; saat sesi diam, chaff
+// mengisi anggaran itu. Dengan begitu sesi diam dan sesi aktif tampak serupa di jalur.
+type ChaffScheduler struct {
+	rate float64
+	next time.Time
+	rng  *rand.Rand // Nil berarti sumber acak global
+}
+
+// chaffCatchUp membatasi seberapa jauh jadwal yang terlambat boleh dikejar. Sesi hanya
+// memeriksa jadwal setiap Tick, jadi chaff yang jatuh tempo di antara dua Tick dikirim
+// belakangan tanpa menggeser jadwal berikutnya; jadwal yang lebih terlambat dari ini
+// (misalnya karena jendela peer penuh) dimulai ulang dari sekarang.
+const chaffCatchUp = 100 * time.Millisecond
+
+// maxChaffPerTick membatasi jumlah chaff yang dikirim dalam satu Tick, agar jadwal yang
+// terlambat tidak dikejar dengan ledakan paket.
+const maxChaffPerTick = 4
+
+// NewChaffScheduler membuat penjadwal dengan anggaran rate byte per detik, atau nil jika
+// rate nol. Chaff pertama dijadwalkan seolah paket seukuran BasePLPMTU baru terkirim.
+func NewChaffScheduler(rate int, now time.Time) *ChaffScheduler {
+	if rate <= 0 {
+		return nil
+	}
+	c := &ChaffScheduler{rate: float64(rate)}
+	c.OnSent(now, BasePLPMTU)
+	return c
+}
+
+// OnSent menjadwalkan ulang chaff berikutnya setelah paket berukuran size terkirim pada now.
+// Jika chaff sudah jatuh tempo, jeda dihitung dari waktu jatuh temponya agar laju rata-rata
+// tetap sesuai anggaran walaupun jadwal hanya diperiksa secara berkala.
+func (c *ChaffScheduler) OnSent(now time.Time, size int) {
+	base := now
+	if c.next.Before(now) && now.Sub(c.next) < chaffCatchUp {
+		base = c.next
+	}
+	mean := float64(size) / c.rate
+	c.next = base.Add(time.Duration(c.expFloat64() * mean * float64(time.Second)))
+}
+
+// expFloat64 mengambil bilangan acak eksponensial dengan rata-rata 1.
+func (c *ChaffScheduler) expFloat64() float64 {
+	if c.rng == nil {
+		return rand.ExpFloat64()
+	}
+	return c.rng.ExpFloat64()
+}
+
+// Due melaporkan apakah chaff berikutnya sudah jatuh tempo pada now.
+func (c *ChaffScheduler) Due(now time.Time) bool {
+	return !now.Before(c.next)
+}
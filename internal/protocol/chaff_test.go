@@ -0,0 +1,165 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// testChaffScheduler membuat penjadwal dengan sumber acak berseed tetap.
+func testChaffScheduler(rate int, now time.Time) *ChaffScheduler {
+	c := &ChaffScheduler{rate: float64(rate), rng: rand.New(rand.NewPCG(1, 2))}
+	c.OnSent(now, BasePLPMTU)
+	return c
+}
+
+func TestChaffSchedulerPoisson(t *testing.T) {
+	const (
+		rate    = 100_000
+		size    = 1000
+		samples = 20_000
+	)
+	now := time.Unix(0, 0)
+	c := testChaffScheduler(rate, now)
+	mean := time.Duration(size) * time.Second / rate
+	// Chaff dikirim tepat saat jatuh tempo, jadi jeda antar chaff adalah jeda yang dijadwalkan
+	var sum, sumSquares float64
+	longer := 0
+	for range samples {
+		now = c.next
+		if !c.Due(now) || c.Due(now.Add(-time.Nanosecond)) {
+			t.Fatalf("Due tidak berubah tepat di %v", now)
+		}
+		c.OnSent(now, size)
+		gap := c.next.Sub(now)
+		sum += gap.Seconds()
+		sumSquares += gap.Seconds() * gap.Seconds()
+		if gap > mean {
+			longer++
+		}
+	}
+	// Jeda eksponensial: rata-rata dan simpangan baku sama dengan size/rate, dan sekitar
+	// 1/e jeda lebih panjang dari rata-ratanya
+	average := sum / samples
+	deviation := math.Sqrt(sumSquares/samples - average*average)
+	if math.Abs(average-mean.Seconds()) > 0.03*mean.Seconds() {
+		t.Errorf("rata-rata jeda %v, diharapkan %v", time.Duration(average*float64(time.Second)), mean)
+	}
+	if math.Abs(deviation-mean.Seconds()) > 0.05*mean.Seconds() {
+		t.Errorf("simpangan baku jeda %v, diharapkan %v", time.Duration(deviation*float64(time.Second)), mean)
+	}
+	if fraction := float64(longer) / samples; math.Abs(fraction-1/math.E) > 0.02 {
+		t.Errorf("%.3f jeda lebih panjang dari rata-rata, diharapkan %.3f", fraction, 1/math.E)
+	}
+}
+
+func TestChaffSchedulerBudget(t *testing.T) {
+	const (
+		rate     = 20_000
+		size     = 1000
+		tick     = 50 * time.Millisecond
+		duration = 60 * time.Second
+	)
+	tests := []struct {
+		name      string
+		dataEvery time.Duration // Jeda antar paket data; nol berarti sesi diam
+		min, max  float64       // Batas laju chaff sebagai pecahan anggaran
+	}{
+		{name: "diam", min: 0.9, max: 1.1},
+		{name: "data di atas anggaran", dataEvery: 2 * time.Millisecond, max: 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Unix(0, 0)
+			c := testChaffScheduler(rate, start)
+			chaff := 0
+			nextData := start
+			// Data dikirim kapan saja, sedangkan jadwal chaff hanya diperiksa setiap Tick
+			// seperti di Session.Tick. Rata-rata jeda chaff di sini sama dengan jeda Tick, jauh
+			// di bawah maxChaffPerTick chaff per Tick
+			for now := start; now.Before(start.Add(duration)); now = now.Add(tick) {
+				for tt.dataEvery > 0 && nextData.Before(now) {
+					c.OnSent(nextData, size)
+					nextData = nextData.Add(tt.dataEvery)
+				}
+				for i := 0; c.Due(now) && i < maxChaffPerTick; i++ {
+					c.OnSent(now, size)
+					chaff += size
+				}
+			}
+			budget := rate * duration.Seconds()
+			if fraction := float64(chaff) / budget; fraction < tt.min || fraction > tt.max {
+				t.Errorf("chaff %d byte dalam %v, %.2f dari anggaran (diharapkan %.2f-%.2f)", chaff, duration, fraction, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestChaffReusesConfirmedSeq(t *testing.T) {
+	var sent, replies [][]byte
+	client, server := sessionPair(t, &sent, &replies)
+	client.chaff = testChaffScheduler(10_000, time.Now())
+	// Jadwal chaff diperiksa jauh setelah jatuh tempo sehingga setiap Tick mengirim satu chaff.
+	// Pencarian PMTU dianggap selesai sesudahnya agar tidak ada probe yang ikut terkirim
+	later := time.Now().Add(time.Hour)
+	client.pmtu.complete, client.pmtu.completedAt = true, later.Add(24*time.Hour)
+	seqOf := func(raw []byte) uint64 {
+		t.Helper()
+		msg, err := client.open(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Seq
+	}
+
+	// Sebelum peer mengonfirmasi apa pun, chaff memakai nomor urut baru
+	if err := client.Tick(later); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || seqOf(sent[0]) != 0 || client.seq != 1 {
+		t.Fatalf("chaff pertama: %d paket, nomor urut berikutnya %d", len(sent), client.seq)
+	}
+	if err := client.SendMessage([]byte("halo")); err != nil {
+		t.Fatal(err)
+	}
+	for _, packet := range sent {
+		if err := deliver(t, server, packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliver(t, client, replies[len(replies)-1])
+	confirmed, ok := client.peerWindow.Confirmed()
+	if !ok || confirmed != 1 {
+		t.Fatalf("nomor urut terkonfirmasi %d, %v, diharapkan 1", confirmed, ok)
+	}
+
+	// Setelah konfirmasi, chaff memakai ulang nomor urut itu tanpa memajukan nomor urut
+	// dan dibuang peer sebagai duplikat
+	for i := range 3 {
+		sent = sent[:0]
+		if err := client.Tick(later.Add(time.Duration(i) * time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if len(sent) != 1 || seqOf(sent[0]) != confirmed || client.seq != 2 {
+			t.Fatalf("chaff %d: %d paket, nomor urut berikutnya %d", i, len(sent), client.seq)
+		}
+		if err := deliver(t, server, sent[0]); !errors.Is(err, ErrDuplicatePacket) {
+			t.Fatalf("chaff %d: error %v, diharapkan ErrDuplicatePacket", i, err)
+		}
+	}
+	// Rantai hash tetap utuh untuk pesan berikutnya
+	if err := client.SendMessage([]byte("lagi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliver(t, server, sent[len(sent)-1]); err != nil {
+		t.Fatal(err)
+	}
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range []string{"halo", "lagi"} {
+		if message, err := server.ReceiveMessage(); err != nil || string(message) != want {
+			t.Fatalf("pesan %q, %v, diharapkan %q", message, err, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+)
+
+// CongestionMSS adalah ukuran segmen acuan untuk perhitungan jendela kongesti.
+const CongestionMSS = 1200
+
+// Nama algoritma congestion control yang bisa dipilih lewat konfigurasi.
+const (
+	CongestionBBR   = "bbr"
+	CongestionCUBIC = "cubic"
+)
+
+// CongestionController adalah algoritma congestion control yang diberi makan oleh jalur ACK.
+// Semua ukuran dalam byte dan semua laju dalam byte per detik.
+type CongestionController interface {
+	// OnPacketSent dipanggil setiap paket baru dikirim.
+	OnPacketSent(now time.Time, seq uint64, bytes int, bytesInFlight int)
+	// OnAck dipanggil untuk setiap paket yang di-ACK. rtt bernilai nol jika paket pernah
+	// dikirim ulang sehingga sampelnya ambigu.
+	OnAck(now time.Time, seq uint64, bytes int, rtt time.Duration, bytesInFlight int)
+	// OnLoss dipanggil jika paket yang dikirim pada sentTime dianggap hilang (RTO habis).
+	OnLoss(now time.Time, seq uint64, bytes int, sentTime time.Time)
+	// CanSend mengembalikan true jika masih ada ruang di jendela kongesti.
+	CanSend(bytesInFlight int) bool
+	// CongestionWindow mengembalikan cwnd saat ini.
+	CongestionWindow() int
+	// PacingRate mengembalikan laju pacing yang disarankan.
+	PacingRate() float64
+	// BandwidthEstimate mengembalikan estimasi bandwidth bottleneck.
+	BandwidthEstimate() float64
+	// Name mengembalikan nama algoritma.
+	Name() string
+}
+
+// NewCongestionController membuat controller berdasarkan nama dari konfigurasi.
+// Nama kosong memilih BBR.
+func NewCongestionController(name string) (CongestionController, error) {
+	switch name {
+	case "", CongestionBBR:
+		return NewBBR(), nil
+	case CongestionCUBIC:
+		return NewCubic(), nil
+	default:
+		return nil, fmt.Errorf("algoritma congestion control tidak dikenal: %q", name)
+	}
+}
+
+// SessionStats adalah ringkasan keadaan transport satu sesi.
+type SessionStats struct {
+	Algorithm        string
+	CongestionWindow int
+	BytesInFlight    int
+	SRTT             time.Duration
+	RTO              time.Duration
+	Bandwidth        float64 // byte/detik
+	PacingRate       float64 // byte/detik
+	MTU              int     // PLPMTU yang sudah dikonfirmasi PMTUProber
+}
+
+func (s SessionStats) String() string {
+	return fmt.Sprintf("%s cwnd=%dB inflight=%dB srtt=%v rto=%v bw=%.0fB/s pacing=%.0fB/s mtu=%dB",
+		s.Algorithm, s.CongestionWindow, s.BytesInFlight, s.SRTT, s.RTO, s.Bandwidth, s.PacingRate, s.MTU)
+}
+
+// pacerBurst adalah jumlah byte yang boleh dikirim sekaligus setelah pengirim diam.
+const pacerBurst = 4 * CongestionMSS
+
+// Pacer menyebar pengiriman paket sesuai laju pacing congestion controller.
+type Pacer struct {
+	nextSend time.Time
+}
+
+// Delay mengembalikan berapa lama pengirim harus menunggu sebelum paket berikutnya.
+func (p *Pacer) Delay(now time.Time) time.Duration {
+	if now.After(p.nextSend) {
+		return 0
+	}
+	return p.nextSend.Sub(now)
+}
+
+// OnSent mencatat pengiriman bytes pada laju rate (byte/detik).
+func (p *Pacer) OnSent(now time.Time, bytes int, rate float64) {
+	if rate <= 0 {
+		return
+	}
+	earliest := now.Add(-time.Duration(float64(pacerBurst) / rate * float64(time.Second)))
+	if p.nextSend.Before(earliest) {
+		p.nextSend = earliest
+	}
+	p.nextSend = p.nextSend.Add(time.Duration(float64(bytes) / rate * float64(time.Second)))
+}
@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"lukechampine.com/blake3"
+)
+
+const (
+	// CookieSize adalah ukuran cookie Retry: timestamp (8 byte) || MAC alamat (16 byte).
+	CookieSize = 8 + cookieMACSize
+	// RetrySize adalah ukuran payload paket Retry: MAC ClientHello yang dibalas || cookie.
+	// Jauh lebih kecil dari ClientHello, sehingga Retry tidak bisa dipakai untuk amplifikasi.
+	RetrySize = crypto.HandshakeMACSize + CookieSize
+	// CookieLifetime adalah lama cookie berlaku sejak dibuat server.
+	CookieLifetime = 30 * time.Second
+	// DefaultCookieThreshold adalah jumlah handshake per detik sebelum cookie diwajibkan.
+	DefaultCookieThreshold = 32
+
+	cookieMACSize = 16
+)
+
+var ErrCookieInvalid = errors.New("cookie handshake tidak valid")
+
+// CookieGuard memutuskan kapan server mewajibkan cookie dan membuat serta memeriksa cookie
+// tanpa menyimpan state per klien, seperti Retry QUIC atau cookie reply WireGuard. Cookie
+// adalah MAC berkunci rahasia server atas alamat sumber dan waktu pembuatannya, sehingga
+// hanya klien yang benar-benar menerima paket di alamat itu yang bisa mengembalikannya.
+type CookieGuard struct {
+	secret    [crypto.KeySize]byte
+	threshold int // Negatif berarti cookie selalu diwajibkan
+
+	mu     sync.Mutex
+	second int64 // Detik Unix yang sedang dihitung
+	count  int   // Handshake yang sudah dihitung pada detik itu
+}
+
+// NewCookieGuard membuat CookieGuard dengan rahasia acak baru. threshold adalah jumlah
+// handshake per detik sebelum cookie diwajibkan; nol berarti DefaultCookieThreshold dan
+// negatif berarti cookie selalu diwajibkan.
+func NewCookieGuard(threshold int) (*CookieGuard, error) {
+	g := &CookieGuard{threshold: threshold}
+	if threshold == 0 {
+		g.threshold = DefaultCookieThreshold
+	}
+	if _, err := rand.Read(g.secret[:]); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// UnderLoad menghitung satu handshake pada waktu now dan melaporkan apakah server sedang
+// dibanjiri handshake sehingga cookie harus diwajibkan.
+func (g *CookieGuard) UnderLoad(now time.Time) bool {
+	if g.threshold < 0 {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if second := now.Unix(); second != g.second {
+		g.second, g.count = second, 0
+	}
+	g.count++
+	return g.count > g.threshold
+}
+
+// Cookie membuat cookie untuk addr pada waktu now.
+func (g *CookieGuard) Cookie(addr *net.UDPAddr, now time.Time) []byte {
+	cookie := binary.BigEndian.AppendUint64(make([]byte, 0, CookieSize), uint64(now.Unix()))
+	return append(cookie, g.mac(cookie, addr)...)
+}
+
+// Verify memeriksa bahwa cookie dibuat server ini untuk addr dan belum kedaluwarsa.
+func (g *CookieGuard) Verify(cookie []byte, addr *net.UDPAddr, now time.Time) error {
+	if len(cookie) != CookieSize {
+		return ErrCookieInvalid
+	}
+	if subtle.ConstantTimeCompare(g.mac(cookie[:8], addr), cookie[8:]) != 1 {
+		return ErrCookieInvalid
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(cookie)), 0)
+	if age := now.Sub(issued); age > CookieLifetime || age < -time.Second {
+		return ErrCookieInvalid
+	}
+	return nil
+}
+
+// mac menghitung BLAKE3 berkunci atas timestamp, IP, dan port sumber.
+func (g *CookieGuard) mac(timestamp []byte, addr *net.UDPAddr) []byte {
+	h := blake3.New(cookieMACSize, g.secret[:])
+	h.Write(timestamp)
+	h.Write(addr.IP.To16())
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(addr.Port)))
+	return h.Sum(nil)
+}
+
+// NewRetry membangun payload Retry untuk ClientHello hello. MAC ClientHello ikut dikirim
+// agar klien hanya menerima Retry untuk ClientHello yang benar-benar dikirimnya.
+func NewRetry(hello, cookie []byte) []byte {
+	retry := make([]byte, 0, RetrySize)
+	retry = append(retry, hello[len(hello)-crypto.HandshakeMACSize:]...)
+	return append(retry, cookie...)
+}
+
+// SplitClientHello memisahkan payload handshake klien menjadi ClientHello dan cookie.
+// Cookie kosong jika klien belum menerima Retry.
+func SplitClientHello(payload []byte) (hello, cookie []byte) {
+	if len(payload) == ClientHelloSize+CookieSize {
+		return payload[:ClientHelloSize], payload[ClientHelloSize:]
+	}
+	return payload, nil
+}
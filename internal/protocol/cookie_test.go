@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+)
+
+func TestCookieVerify(t *testing.T) {
+	guard, err := NewCookieGuard(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCookieGuard(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Timestamp cookie dibulatkan ke detik; waktu uji dibuat tepat di awal detik
+	now := time.Unix(1_700_000_000, 0)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}
+	cookie := guard.Cookie(addr, now)
+	if len(cookie) != CookieSize {
+		t.Fatalf("cookie %d byte, diharapkan %d", len(cookie), CookieSize)
+	}
+	tampered := bytes.Clone(cookie)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name   string
+		guard  *CookieGuard
+		cookie []byte
+		addr   *net.UDPAddr
+		now    time.Time
+		valid  bool
+	}{
+		{"valid", guard, cookie, addr, now, true},
+		{"hampir kedaluwarsa", guard, cookie, addr, now.Add(CookieLifetime), true},
+		{"kedaluwarsa", guard, cookie, addr, now.Add(CookieLifetime + 2*time.Second), false},
+		{"dari masa depan", guard, cookie, addr, now.Add(-2 * time.Second), false},
+		{"IP lain", guard, cookie, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 40000}, now, false},
+		{"port lain", guard, cookie, &net.UDPAddr{IP: addr.IP, Port: 40001}, now, false},
+		{"server lain", other, cookie, addr, now, false},
+		{"MAC diubah", guard, tampered, addr, now, false},
+		{"terpotong", guard, cookie[:CookieSize-1], addr, now, false},
+	}
+	for _, tt := range tests {
+		if err := tt.guard.Verify(tt.cookie, tt.addr, tt.now); (err == nil) != tt.valid {
+			t.Errorf("%s: Verify = %v, diharapkan valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestCookieGuardUnderLoad(t *testing.T) {
+	tests := []struct {
+		threshold int
+		loaded    int // Handshake pertama dalam satu detik yang mewajibkan cookie
+	}{
+		{3, 4},
+		{-1, 1},
+		{0, DefaultCookieThreshold + 1},
+	}
+	now := time.Unix(1_700_000_000, 0)
+	for _, tt := range tests {
+		guard, err := NewCookieGuard(tt.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := 0
+		for i := 1; i <= DefaultCookieThreshold+2 && first == 0; i++ {
+			if guard.UnderLoad(now) {
+				first = i
+			}
+		}
+		if first != tt.loaded {
+			t.Errorf("threshold %d: cookie mulai diwajibkan di handshake ke-%d, diharapkan %d", tt.threshold, first, tt.loaded)
+		}
+		// Hitungan dimulai ulang di detik berikutnya
+		if tt.threshold > 0 && guard.UnderLoad(now.Add(time.Second)) {
+			t.Errorf("threshold %d: cookie masih diwajibkan di detik berikutnya", tt.threshold)
+		}
+	}
+}
+
+func TestSplitClientHello(t *testing.T) {
+	hello := bytes.Repeat([]byte{1}, ClientHelloSize)
+	cookie := bytes.Repeat([]byte{2}, CookieSize)
+	if h, c := SplitClientHello(hello); !bytes.Equal(h, hello) || c != nil {
+		t.Errorf("tanpa cookie: %d byte hello, %d byte cookie", len(h), len(c))
+	}
+	if h, c := SplitClientHello(append(bytes.Clone(hello), cookie...)); !bytes.Equal(h, hello) || !bytes.Equal(c, cookie) {
+		t.Errorf("dengan cookie: %d byte hello, %d byte cookie", len(h), len(c))
+	}
+	retry := NewRetry(hello, cookie)
+	if len(retry) != RetrySize || !bytes.Equal(retry[:crypto.HandshakeMACSize], hello[ClientHelloSize-crypto.HandshakeMACSize:]) {
+		t.Errorf("Retry tidak membawa MAC ClientHello: %x", retry)
+	}
+	if RetrySize >= ClientHelloSize {
+		t.Errorf("Retry %d byte tidak lebih kecil dari ClientHello %d byte", RetrySize, ClientHelloSize)
+	}
+}
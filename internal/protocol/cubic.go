@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"math"
+	"time"
+)
+
+// Konstanta CUBIC sesuai RFC 9438.
+const (
+	cubicBeta          = 0.7
+	cubicC             = 0.4
+	cubicInitialCwnd   = 10 * CongestionMSS
+	cubicMinCwnd       = 2 * CongestionMSS
+	cubicDefaultRTT    = 100 * time.Millisecond
+	cubicSlowStartGain = 2.0
+	cubicAvoidanceGain = 1.25
+)
+
+// Cubic adalah congestion controller CUBIC (RFC 9438) berbasis loss.
+type Cubic struct {
+	cwnd          float64 // byte
+	ssthresh      float64
+	wMax          float64 // byte, cwnd sebelum reduksi terakhir
+	k             float64 // detik
+	epochStart    time.Time
+	recoveryStart time.Time
+	srtt          time.Duration
+}
+
+// NewCubic membuat controller CUBIC dengan jendela awal 10 MSS.
+func NewCubic() *Cubic {
+	return &Cubic{cwnd: cubicInitialCwnd, ssthresh: math.Inf(1)}
+}
+
+func (c *Cubic) Name() string { return CongestionCUBIC }
+
+func (c *Cubic) OnPacketSent(now time.Time, seq uint64, bytes int, bytesInFlight int) {}
+
+func (c *Cubic) OnAck(now time.Time, seq uint64, bytes int, rtt time.Duration, bytesInFlight int) {
+	if rtt > 0 {
+		if c.srtt == 0 {
+			c.srtt = rtt
+		} else {
+			c.srtt = (7*c.srtt + rtt) / 8
+		}
+	}
+	if c.cwnd < c.ssthresh {
+		c.cwnd += float64(bytes)
+		return
+	}
+
+	if c.epochStart.IsZero() {
+		c.epochStart = now
+		if c.cwnd < c.wMax {
+			c.k = math.Cbrt((c.wMax - c.cwnd) / CongestionMSS / cubicC)
+		} else {
+			c.k = 0
+			c.wMax = c.cwnd
+		}
+	}
+	rttSec := c.rtt().Seconds()
+	t := now.Sub(c.epochStart).Seconds()
+	wMaxSeg := c.wMax / CongestionMSS
+	target := (cubicC*math.Pow(t+rttSec-c.k, 3) + wMaxSeg) * CongestionMSS
+
+	// Wilayah TCP-friendly: jangan tumbuh lebih lambat dari Reno dengan beta yang sama
+	wEst := (wMaxSeg*cubicBeta + 3*(1-cubicBeta)/(1+cubicBeta)*(t/rttSec)) * CongestionMSS
+	target = max(target, wEst)
+
+	if target > c.cwnd {
+		c.cwnd += (target - c.cwnd) / c.cwnd * float64(bytes)
+	}
+}
+
+func (c *Cubic) OnLoss(now time.Time, seq uint64, bytes int, sentTime time.Time) {
+	// Satu reduksi per episode: loss dari paket yang dikirim sebelum reduksi terakhir diabaikan
+	if sentTime.Before(c.recoveryStart) {
+		return
+	}
+	if c.cwnd < c.wMax {
+		// Fast convergence: beri ruang untuk aliran baru
+		c.wMax = c.cwnd * (1 + cubicBeta) / 2
+	} else {
+		c.wMax = c.cwnd
+	}
+	c.cwnd = max(c.cwnd*cubicBeta, cubicMinCwnd)
+	c.ssthresh = c.cwnd
+	c.epochStart = time.Time{}
+	c.recoveryStart = now
+}
+
+func (c *Cubic) CanSend(bytesInFlight int) bool {
+	return float64(bytesInFlight) < c.cwnd
+}
+
+func (c *Cubic) CongestionWindow() int {
+	return int(c.cwnd)
+}
+
+func (c *Cubic) PacingRate() float64 {
+	gain := cubicAvoidanceGain
+	if c.cwnd < c.ssthresh {
+		gain = cubicSlowStartGain
+	}
+	return gain * c.BandwidthEstimate()
+}
+
+func (c *Cubic) BandwidthEstimate() float64 {
+	return c.cwnd / c.rtt().Seconds()
+}
+
+func (c *Cubic) rtt() time.Duration {
+	if c.srtt == 0 {
+		return cubicDefaultRTT
+	}
+	return c.srtt
+}
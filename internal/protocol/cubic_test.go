@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCubicOnLoss(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	now := t0.Add(time.Second)
+	tests := []struct {
+		name          string
+		cwnd, wMax    float64 // Dalam MSS
+		recoveryStart time.Time
+		sentTime      time.Time // Waktu kirim paket yang hilang
+		wantCwnd      float64
+		wantWMax      float64
+	}{
+		{"reduksi pertama", 100, 0, time.Time{}, t0, 70, 100},
+		// Paket yang dikirim sebelum reduksi terakhir termasuk episode loss yang sama
+		{"episode yang sama", 70, 100, t0.Add(500 * time.Millisecond), t0, 70, 100},
+		{"episode baru", 100, 100, t0, t0.Add(500 * time.Millisecond), 70, 100},
+		// cwnd belum kembali ke wMax: wMax diturunkan lagi agar aliran baru mendapat ruang
+		{"fast convergence", 70, 100, t0, t0.Add(500 * time.Millisecond), 49, 70 * (1 + cubicBeta) / 2},
+		{"batas bawah cwnd", 2.5, 4, t0, t0.Add(500 * time.Millisecond), 2, 2.5 * (1 + cubicBeta) / 2},
+		{"sudah di batas bawah", 2, 2, t0, t0.Add(500 * time.Millisecond), 2, 2},
+	}
+	for _, tt := range tests {
+		c := NewCubic()
+		c.cwnd, c.wMax, c.recoveryStart = tt.cwnd*CongestionMSS, tt.wMax*CongestionMSS, tt.recoveryStart
+		before := *c
+		c.OnLoss(now, 1, CongestionMSS, tt.sentTime)
+		if math.Abs(c.cwnd-tt.wantCwnd*CongestionMSS) > 1e-6 || math.Abs(c.wMax-tt.wantWMax*CongestionMSS) > 1e-6 {
+			t.Errorf("%s: cwnd %.2f MSS, wMax %.2f MSS; diharapkan %.2f dan %.2f", tt.name, c.cwnd/CongestionMSS, c.wMax/CongestionMSS, tt.wantCwnd, tt.wantWMax)
+		}
+		if tt.sentTime.Before(tt.recoveryStart) {
+			if *c != before {
+				t.Errorf("%s: loss dari episode yang sama mengubah state", tt.name)
+			}
+			continue
+		}
+		if c.ssthresh != c.cwnd || c.recoveryStart != now || !c.epochStart.IsZero() {
+			t.Errorf("%s: ssthresh %.0f, recoveryStart %v, epochStart %v setelah reduksi", tt.name, c.ssthresh, c.recoveryStart, c.epochStart)
+		}
+	}
+}
+
+func TestCubicGrowth(t *testing.T) {
+	const rtt = 100 * time.Millisecond
+	now := time.Unix(1000, 0)
+	c := NewCubic()
+
+	// Slow start: setiap byte yang di-ACK menambah cwnd satu byte
+	for range 10 {
+		now = now.Add(10 * time.Millisecond)
+		c.OnAck(now, 1, CongestionMSS, rtt, 0)
+	}
+	if want := float64(cubicInitialCwnd + 10*CongestionMSS); c.cwnd != want {
+		t.Fatalf("cwnd slow start %.0f, diharapkan %.0f", c.cwnd, want)
+	}
+	if c.PacingRate() != cubicSlowStartGain*c.BandwidthEstimate() {
+		t.Errorf("pacing slow start %.0f, diharapkan %.1f × %.0f", c.PacingRate(), cubicSlowStartGain, c.BandwidthEstimate())
+	}
+
+	// Congestion avoidance dari 70 MSS dengan wMax 100 MSS: cwnd tumbuh jauh lebih lambat,
+	// mendatar di sekitar wMax sampai K detik, lalu mulai mencari bandwidth baru
+	c.cwnd = 100 * CongestionMSS
+	c.OnLoss(now, 2, CongestionMSS, now)
+	k := time.Duration(math.Cbrt(30/cubicC) * float64(time.Second))
+	start := now
+	before := c.cwnd
+	c.OnAck(now, 3, CongestionMSS, rtt, 0)
+	if growth := c.cwnd - before; growth >= CongestionMSS/2 {
+		t.Errorf("satu ACK di congestion avoidance menambah cwnd %.0f byte", growth)
+	}
+	if c.PacingRate() != cubicAvoidanceGain*c.BandwidthEstimate() {
+		t.Errorf("pacing congestion avoidance %.0f, diharapkan %.2f × %.0f", c.PacingRate(), cubicAvoidanceGain, c.BandwidthEstimate())
+	}
+	checks := []struct {
+		at       time.Duration
+		min, max float64 // Dalam MSS
+	}{
+		{k / 2, 85, 100},
+		{k, 95, 101},
+		{k + 2*time.Second, 101, 120},
+	}
+	for _, check := range checks {
+		for now.Sub(start) < check.at {
+			now = now.Add(10 * time.Millisecond)
+			c.OnAck(now, 4, CongestionMSS, rtt, 0)
+		}
+		if cwnd := c.cwnd / CongestionMSS; cwnd < check.min || cwnd > check.max {
+			t.Errorf("cwnd %.1f MSS setelah %v, diharapkan %.0f-%.0f MSS (K = %v)", cwnd, check.at, check.min, check.max, k)
+		}
+	}
+}
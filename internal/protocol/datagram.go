@@ -0,0 +1,81 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MaxQueuedDatagrams adalah jumlah datagram masuk yang ditahan sebelum aplikasi membacanya.
+// Jika antrean penuh, datagram tertua dibuang agar data terbaru (misalnya suara atau state
+// game) tetap diutamakan.
+const MaxQueuedDatagrams = 256
+
+var ErrDatagramTooLarge = errors.New("datagram melebihi ruang satu paket")
+
+// SendDatagram mengirim data sebagai satu datagram tak andal (RFC 9221). Datagram melewati
+// enkripsi, rantai hash, dan port hopping yang sama dengan stream, tetapi tidak masuk antrean
+// retransmisi: jika hilang, penerima melompati nomor urutnya lewat ForwardSeq paket
+// berikutnya. Datagram tetap tunduk pada congestion control dan pacing, dan harus muat dalam
+// satu paket (lihat MaxDatagramSize).
+func (s *Session) SendDatagram(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.waitSendable(nil, &s.writeDeadline); err != nil {
+		return err
+	}
+	// Ukuran diperiksa dengan template agar datagram yang ditolak tidak membuang ACK tertunda
+	if room := DatagramRoom(s.mtu(), s.messageTemplate(false)); len(data) > room {
+		return fmt.Errorf("%w: %d byte (maksimum %d)", ErrDatagramTooLarge, len(data), room)
+	}
+	msg := s.newMessage(false)
+	msg.Frames = []Frame{{Type: FrameDatagram, Data: data}}
+	now := time.Now()
+	s.pacer.OnSent(now, PacketSize(msg), s.retransmit.Congestion.PacingRate())
+	return s.transmit(msg, false, now)
+}
+
+// ReceiveDatagram menunggu dan mengembalikan datagram berikutnya dari peer. Datagram
+// diteruskan sesuai urutan kedatangan, bukan nomor urut.
+func (s *Session) ReceiveDatagram() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.datagrams) == 0 {
+		if s.closeErr != nil {
+			return nil, s.closeErr
+		}
+		if s.readDeadline.exceeded() {
+			return nil, os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+	data := s.datagrams[0]
+	s.datagrams = s.datagrams[1:]
+	return data, nil
+}
+
+// MaxDatagramSize mengembalikan ukuran data terbesar yang saat ini bisa dikirim SendDatagram.
+// Nilainya mengikuti MTU jalur sehingga bisa berubah selama sesi berjalan.
+func (s *Session) MaxDatagramSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return DatagramRoom(s.mtu(), s.messageTemplate(false))
+}
+
+// DatagramRoom mengembalikan jumlah byte datagram yang muat di msg tanpa membuat datagram UDP
+// melebihi mtu.
+func DatagramRoom(mtu int, msg *DataMessage) int {
+	probe := *msg
+	probe.Frames = []Frame{{Type: FrameDatagram}}
+	room := mtu - PacketSize(&probe) - 3 // Panjang frame bisa bertambah sampai 3 byte uvarint
+	return max(room, 0)
+}
+
+// queueDatagram menyimpan datagram masuk untuk ReceiveDatagram.
+func (s *Session) queueDatagram(data []byte) {
+	if len(s.datagrams) >= MaxQueuedDatagrams {
+		s.datagrams = s.datagrams[1:]
+	}
+	s.datagrams = append(s.datagrams, data)
+}
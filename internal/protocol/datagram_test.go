@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDatagramSizingKeepsPendingAck(t *testing.T) {
+	var sent, replies [][]byte
+	client, _ := sessionPair(t, &sent, &replies)
+	// ACK yang ditunda sampai Tick, misalnya karena jendela peer hampir penuh
+	client.mu.Lock()
+	client.ackPending = true
+	client.mu.Unlock()
+
+	room := client.MaxDatagramSize()
+	if err := client.SendDatagram(make([]byte, room+1)); !errors.Is(err, ErrDatagramTooLarge) {
+		t.Fatalf("datagram %d byte: error %v, diharapkan ErrDatagramTooLarge", room+1, err)
+	}
+	client.mu.Lock()
+	pending := client.ackPending
+	client.mu.Unlock()
+	if !pending {
+		t.Fatal("MaxDatagramSize atau datagram yang ditolak membuang ACK yang tertunda")
+	}
+	if len(sent) != 0 {
+		t.Fatalf("%d paket terkirim oleh pengukuran datagram", len(sent))
+	}
+
+	// Datagram seukuran MaxDatagramSize muat dalam satu paket dan membawa ACK tertunda
+	if err := client.SendDatagram(make([]byte, room)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || len(sent[0]) > client.mtu() {
+		t.Fatalf("%d paket terkirim, ukuran melebihi MTU %d", len(sent), client.mtu())
+	}
+	client.mu.Lock()
+	pending = client.ackPending
+	client.mu.Unlock()
+	if pending {
+		t.Error("ACK masih tertunda setelah datagram terkirim")
+	}
+}
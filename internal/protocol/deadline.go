@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"sync"
+	"time"
+)
+
+// deadline adalah batas waktu operasi blocking milik Session atau Stream. Saat batasnya
+// habis, semua yang menunggu di cond dibangunkan agar bisa mengembalikan
+// os.ErrDeadlineExceeded. Dipanggil dengan kunci cond dipegang.
+type deadline struct {
+	t     time.Time
+	timer *time.Timer
+}
+
+func (d *deadline) set(t time.Time, cond *sync.Cond) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.t = t
+	if wait := time.Until(t); !t.IsZero() && wait > 0 {
+		d.timer = time.AfterFunc(wait, func() {
+			cond.L.Lock()
+			defer cond.L.Unlock()
+			cond.Broadcast()
+		})
+	}
+	cond.Broadcast() // Deadline yang sudah lewat atau dihapus berlaku untuk penunggu saat ini
+}
+
+func (d *deadline) exceeded() bool {
+	return !d.t.IsZero() && !time.Now().Before(d.t)
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package protocol
+
+import (
+	"net"
+	"syscall"
+)
+
+// SetDontFragment menyalakan bit Don't Fragment pada conn tanpa memakai cache PMTU kernel
+// (IP_PMTUDISC_PROBE), sehingga probe PMTU yang terlalu besar benar-benar hilang di jalur
+// alih-alih difragmentasi IP.
+func SetDontFragment(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	ipv4 := true
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil && !addr.IP.IsUnspecified() {
+		ipv4 = false
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv4 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		} else {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
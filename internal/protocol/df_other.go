@@ -0,0 +1,11 @@
+//go:build !linux
+
+package protocol
+
+import "net"
+
+// SetDontFragment tidak tersedia di platform ini. Probe PMTU tetap berjalan, tetapi
+// datagram yang terlalu besar bisa difragmentasi IP sehingga hasilnya terlalu optimis.
+func SetDontFragment(conn *net.UDPConn) error {
+	return nil
+}
@@ -0,0 +1,249 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxPacketSize adalah ukuran buffer baca untuk satu datagram UDP (payload UDP maksimum).
+	MaxPacketSize = 65507
+	// MaxMessageSize adalah ukuran maksimum satu pesan aplikasi setelah dirakit ulang.
+	MaxMessageSize = 64 << 20
+	// MaxReassemblyMemory adalah total byte yang boleh ditahan Reassembler satu sesi untuk
+	// pesan yang belum lengkap.
+	MaxReassemblyMemory = 128 << 20
+	// ReassemblyTimeout adalah waktu maksimum tanpa fragmen baru sebelum pesan yang belum
+	// lengkap dibuang.
+	ReassemblyTimeout = 30 * time.Second
+)
+
+var (
+	ErrMessageTooLarge  = errors.New("pesan melebihi ukuran maksimum")
+	ErrInvalidFragment  = errors.New("fragmen tidak valid")
+	ErrReassemblyMemory = errors.New("batas memori reassembly terlampaui")
+)
+
+// Fragment adalah potongan satu pesan aplikasi. Total nol berarti pesan tidak difragmentasi.
+type Fragment struct {
+	ID     uint64 // Sama untuk semua fragmen dari satu pesan
+	Offset uint64 // Posisi Data di dalam pesan asli
+	Total  uint64 // Panjang pesan asli
+	Data   []byte
+}
+
+// FragmentAt mengembalikan fragmen message yang dimulai di offset dan memuat paling banyak
+// room byte. Pesan yang muat seluruhnya dalam room dikembalikan utuh tanpa informasi fragmen.
+func FragmentAt(id uint64, message []byte, offset, room int) Fragment {
+	if offset == 0 && len(message) <= room {
+		return Fragment{Data: message}
+	}
+	end := min(offset+room, len(message))
+	return Fragment{ID: id, Offset: uint64(offset), Total: uint64(len(message)), Data: message[offset:end]}
+}
+
+// FragmentRoom mengembalikan jumlah byte pesan aplikasi yang muat di msg tanpa membuat
+// datagramnya melebihi mtu. Perhitungan mengasumsikan field fragmen terisi, sehingga hasilnya
+// aman untuk fragmen mana pun dari pesan berukuran total.
+func FragmentRoom(mtu int, msg *DataMessage, id uint64, total int) int {
+	probe := *msg
+	probe.Message = nil
+	probe.FragmentID, probe.FragmentOffset, probe.FragmentTotal = id, uint64(total), uint64(total)
+	room := mtu - PacketSize(&probe) - 1 - binary.MaxVarintLen32
+	return max(room, 1)
+}
+
+// partialMessage adalah pesan yang fragmennya belum lengkap. Fragmen disimpan apa adanya
+// dan baru disalin ke buffer seukuran pesan saat lengkap, sehingga memori yang ditahan
+// mengikuti byte yang benar-benar diterima, bukan Total yang diklaim fragmen pertama.
+type partialMessage struct {
+	total     uint64
+	fragments []Fragment
+	covered   []AckRange // Rentang byte yang sudah diterima, terurut dan tidak tumpang tindih
+	received  int
+	memory    int // Byte data fragmen yang disimpan
+	lastSeen  time.Time
+}
+
+// newBytes mengembalikan jumlah byte di [offset, offset+length) yang belum pernah diterima.
+func (m *partialMessage) newBytes(offset uint64, length int) int {
+	start, end := offset, offset+uint64(length)-1
+	fresh := length
+	i := sort.Search(len(m.covered), func(i int) bool { return m.covered[i].End >= start })
+	for ; i < len(m.covered) && m.covered[i].Start <= end; i++ {
+		r := m.covered[i]
+		fresh -= int(min(r.End, end) - max(r.Start, start) + 1)
+	}
+	return fresh
+}
+
+// add mencatat fragmen yang membawa fresh byte baru. Data fragmen harus sudah menjadi milik m.
+func (m *partialMessage) add(f Fragment, fresh int) {
+	m.fragments = append(m.fragments, f)
+	start, end := f.Offset, f.Offset+uint64(len(f.Data))-1
+	i := sort.Search(len(m.covered), func(i int) bool { return m.covered[i].End+1 >= start })
+	j := i
+	for j < len(m.covered) && m.covered[j].Start <= end+1 {
+		start, end = min(start, m.covered[j].Start), max(end, m.covered[j].End)
+		j++
+	}
+	m.covered = append(m.covered[:i], append([]AckRange{{Start: start, End: end}}, m.covered[j:]...)...)
+	m.received += fresh
+}
+
+// assemble menyalin semua fragmen ke satu buffer pesan.
+func (m *partialMessage) assemble() []byte {
+	data := make([]byte, m.total)
+	for _, f := range m.fragments {
+		copy(data[f.Offset:], f.Data)
+	}
+	return data
+}
+
+// ReassemblyBudget adalah batas memori reassembly yang dipakai bersama beberapa
+// Reassembler, misalnya semua sesi satu Listener, agar banyak sesi yang masing-masing masih
+// di bawah batasnya tidak menghabiskan memori proses bersama-sama.
+type ReassemblyBudget struct {
+	mu    sync.Mutex
+	used  int
+	limit int
+}
+
+// NewReassemblyBudget membuat anggaran bersama sebesar limit byte.
+func NewReassemblyBudget(limit int) *ReassemblyBudget {
+	return &ReassemblyBudget{limit: limit}
+}
+
+// reserve memesan n byte dan mengembalikan false jika anggaran tidak cukup.
+func (b *ReassemblyBudget) reserve(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// release mengembalikan n byte ke anggaran.
+func (b *ReassemblyBudget) release(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+}
+
+// Used mengembalikan jumlah byte yang sedang dipakai semua Reassembler.
+func (b *ReassemblyBudget) Used() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Reassembler merakit ulang fragmen menjadi pesan utuh dengan batas waktu, batas memori
+// sendiri, dan anggaran bersama opsional.
+type Reassembler struct {
+	pending map[uint64]*partialMessage
+	memory  int
+	limit   int
+	shared  *ReassemblyBudget // Nil berarti hanya batas sendiri
+	timeout time.Duration
+}
+
+// NewReassembler membuat Reassembler dengan batas MaxReassemblyMemory dan ReassemblyTimeout.
+// Jika shared tidak nil, setiap byte yang ditahan juga dipotong dari anggaran bersama itu.
+func NewReassembler(shared *ReassemblyBudget) *Reassembler {
+	return &Reassembler{
+		pending: make(map[uint64]*partialMessage),
+		limit:   MaxReassemblyMemory,
+		shared:  shared,
+		timeout: ReassemblyTimeout,
+	}
+}
+
+// Add memasukkan satu fragmen. Jika pesannya menjadi lengkap, pesan utuh dikembalikan.
+// Fragmen dari pesan yang melanggar batas membuat seluruh pesan itu dibuang.
+func (r *Reassembler) Add(f Fragment, now time.Time) ([]byte, error) {
+	r.Expire(now)
+	if f.Total == 0 {
+		return f.Data, nil
+	}
+	if f.Total > MaxMessageSize {
+		return nil, fmt.Errorf("%w: %d byte", ErrMessageTooLarge, f.Total)
+	}
+	if len(f.Data) == 0 || f.Offset >= f.Total || uint64(len(f.Data)) > f.Total-f.Offset {
+		r.drop(f.ID)
+		return nil, ErrInvalidFragment
+	}
+
+	m, ok := r.pending[f.ID]
+	if !ok {
+		m = &partialMessage{total: f.Total}
+	} else if m.total != f.Total {
+		r.drop(f.ID)
+		return nil, ErrInvalidFragment
+	}
+	m.lastSeen = now
+	fresh := m.newBytes(f.Offset, len(f.Data))
+	if fresh == 0 {
+		return nil, nil // Duplikat fragmen yang sudah diterima
+	}
+	if uint64(m.received+fresh) < f.Total {
+		// Fragmen yang menyelesaikan pesan tidak perlu disimpan terpisah: buffer pesan
+		// langsung dialokasikan di bawah
+		if r.memory+len(f.Data) > r.limit || (r.shared != nil && !r.shared.reserve(len(f.Data))) {
+			r.drop(f.ID)
+			return nil, ErrReassemblyMemory
+		}
+		r.memory += len(f.Data)
+		m.memory += len(f.Data)
+		m.add(Fragment{Offset: f.Offset, Data: append([]byte(nil), f.Data...)}, fresh)
+		r.pending[f.ID] = m
+		return nil, nil
+	}
+	m.add(f, fresh)
+	data := m.assemble()
+	r.drop(f.ID)
+	return data, nil
+}
+
+// Expire membuang pesan yang tidak menerima fragmen baru selama batas waktu reassembly.
+// Mengembalikan jumlah pesan yang dibuang.
+func (r *Reassembler) Expire(now time.Time) int {
+	expired := 0
+	for id, m := range r.pending {
+		if now.Sub(m.lastSeen) > r.timeout {
+			r.drop(id)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Memory mengembalikan jumlah byte yang sedang ditahan untuk pesan yang belum lengkap.
+func (r *Reassembler) Memory() int {
+	return r.memory
+}
+
+// Reset membuang semua pesan yang belum lengkap dan mengembalikan memorinya ke anggaran
+// bersama. Dipanggil saat sesi ditutup.
+func (r *Reassembler) Reset() {
+	for id := range r.pending {
+		r.drop(id)
+	}
+}
+
+func (r *Reassembler) drop(id uint64) {
+	m, ok := r.pending[id]
+	if !ok {
+		return
+	}
+	delete(r.pending, id)
+	r.memory -= m.memory
+	if r.shared != nil {
+		r.shared.release(m.memory)
+	}
+}
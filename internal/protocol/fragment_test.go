@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReassemblerOrders(t *testing.T) {
+	message := []byte("pesan yang dipotong menjadi beberapa fragmen")
+	frag := func(start, end int) Fragment {
+		return Fragment{ID: 1, Offset: uint64(start), Total: uint64(len(message)), Data: message[start:end]}
+	}
+	tests := []struct {
+		name      string
+		fragments []Fragment
+	}{
+		{"berurutan", []Fragment{frag(0, 10), frag(10, 20), frag(20, len(message))}},
+		{"terbalik", []Fragment{frag(20, len(message)), frag(10, 20), frag(0, 10)}},
+		{"duplikat", []Fragment{frag(0, 10), frag(0, 10), frag(20, len(message)), frag(10, 20)}},
+		{"tumpang tindih", []Fragment{frag(0, 15), frag(5, 25), frag(20, len(message))}},
+		{"menutup celah", []Fragment{frag(0, 5), frag(30, 35), frag(10, 15), frag(0, len(message))}},
+	}
+	now := time.Now()
+	for _, tt := range tests {
+		r := NewReassembler(nil)
+		var got []byte
+		for i, f := range tt.fragments {
+			out, err := r.Add(f, now)
+			if err != nil {
+				t.Fatalf("%s: fragmen %d: %v", tt.name, i, err)
+			}
+			if out != nil && i != len(tt.fragments)-1 {
+				t.Fatalf("%s: pesan lengkap terlalu awal di fragmen %d", tt.name, i)
+			}
+			got = out
+		}
+		if !bytes.Equal(got, message) {
+			t.Errorf("%s: dirakit %q", tt.name, got)
+		}
+		if r.Memory() != 0 {
+			t.Errorf("%s: %d byte masih ditahan setelah pesan lengkap", tt.name, r.Memory())
+		}
+	}
+}
+
+func TestReassemblerRejects(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		f    Fragment
+		err  error
+	}{
+		{"terlalu besar", Fragment{ID: 1, Total: MaxMessageSize + 1, Data: []byte{1}}, ErrMessageTooLarge},
+		{"data kosong", Fragment{ID: 1, Total: 10}, ErrInvalidFragment},
+		{"offset di luar pesan", Fragment{ID: 1, Offset: 10, Total: 10, Data: []byte{1}}, ErrInvalidFragment},
+		{"melewati akhir pesan", Fragment{ID: 1, Offset: 8, Total: 10, Data: []byte{1, 2, 3}}, ErrInvalidFragment},
+	}
+	for _, tt := range tests {
+		r := NewReassembler(nil)
+		if _, err := r.Add(tt.f, now); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, diharapkan %v", tt.name, err, tt.err)
+		}
+	}
+
+	r := NewReassembler(nil)
+	r.Add(Fragment{ID: 1, Total: 10, Data: []byte{1}}, now)
+	if _, err := r.Add(Fragment{ID: 1, Offset: 1, Total: 20, Data: []byte{2}}, now); !errors.Is(err, ErrInvalidFragment) {
+		t.Errorf("Total berubah: error %v", err)
+	}
+	if r.Memory() != 0 {
+		t.Errorf("pesan dengan Total berubah tidak dibuang: %d byte", r.Memory())
+	}
+}
+
+func TestReassemblerMemory(t *testing.T) {
+	now := time.Now()
+	budget := NewReassemblyBudget(300)
+	a, b := NewReassembler(budget), NewReassembler(budget)
+
+	// Total yang diklaim tidak dialokasikan di depan
+	if _, err := a.Add(Fragment{ID: 1, Total: MaxMessageSize, Data: make([]byte, 100)}, now); err != nil {
+		t.Fatal(err)
+	}
+	if a.Memory() != 100 || budget.Used() != 100 {
+		t.Fatalf("Memory %d, anggaran terpakai %d; diharapkan 100", a.Memory(), budget.Used())
+	}
+	if _, err := b.Add(Fragment{ID: 1, Total: 1000, Data: make([]byte, 150)}, now); err != nil {
+		t.Fatal(err)
+	}
+	// Sisa anggaran bersama 50 byte, walaupun batas b sendiri masih jauh
+	if _, err := b.Add(Fragment{ID: 2, Total: 1000, Data: make([]byte, 60)}, now); !errors.Is(err, ErrReassemblyMemory) {
+		t.Fatalf("anggaran bersama terlampaui: error %v", err)
+	}
+	if budget.Used() != 250 {
+		t.Errorf("anggaran terpakai %d setelah fragmen ditolak, diharapkan 250", budget.Used())
+	}
+
+	// Pesan yang lengkap, kedaluwarsa, atau dibuang saat sesi ditutup melepas anggarannya
+	if out, err := b.Add(Fragment{ID: 1, Offset: 150, Total: 1000, Data: make([]byte, 850)}, now); err != nil || len(out) != 1000 {
+		t.Fatalf("fragmen penutup: %d byte, %v", len(out), err)
+	}
+	if budget.Used() != 100 {
+		t.Errorf("anggaran terpakai %d setelah pesan lengkap, diharapkan 100", budget.Used())
+	}
+	b.Add(Fragment{ID: 3, Total: 1000, Data: make([]byte, 50)}, now)
+	if expired := b.Expire(now.Add(ReassemblyTimeout + time.Second)); expired != 1 {
+		t.Errorf("%d pesan kedaluwarsa, diharapkan 1", expired)
+	}
+	a.Reset()
+	if budget.Used() != 0 || a.Memory() != 0 || b.Memory() != 0 {
+		t.Errorf("anggaran terpakai %d setelah Reset dan Expire", budget.Used())
+	}
+}
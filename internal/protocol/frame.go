@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// FrameType adalah jenis frame stream di dalam DataMessage.
+type FrameType byte
+
+const (
+	// FrameOpen membuka stream baru milik pengirim.
+	FrameOpen FrameType = 0x01
+	// FrameData membawa data stream mulai dari Offset.
+	FrameData FrameType = 0x02
+	// FrameClose menutup arah kirim stream; Offset adalah panjang akhir stream.
+	FrameClose FrameType = 0x03
+	// FrameReset membatalkan stream di kedua arah dengan ErrorCode.
+	FrameReset FrameType = 0x04
+	// FrameWindow menaikkan batas flow control stream menjadi MaxData.
+	FrameWindow FrameType = 0x05
+	// FrameDatagram membawa satu datagram tak andal (RFC 9221). Frame ini tidak milik stream
+	// mana pun, sehingga isinya hanya Data tanpa StreamID.
+	FrameDatagram FrameType = 0x06
+	// FrameConnectionClose memberi tahu peer bahwa sesi ditutup dengan ErrorCode. Seperti
+	// FrameDatagram, frame ini tidak membawa StreamID.
+	FrameConnectionClose FrameType = 0x07
+)
+
+// Frame adalah satu frame kontrol atau data milik sebuah stream.
+type Frame struct {
+	Type      FrameType
+	StreamID  uint64
+	Offset    uint64 // FrameData: posisi Data; FrameClose: panjang akhir stream
+	MaxData   uint64 // FrameWindow
+	ErrorCode uint64 // FrameReset dan FrameConnectionClose
+	Data      []byte // FrameData dan FrameDatagram
+}
+
+// encodeFrames menulis frame sebagai TLV: tipe (1 byte) || panjang (uvarint) || isi, dengan
+// isi diawali StreamID (uvarint) lalu field khusus tipe frame. Frame tingkat sesi tidak
+// membawa StreamID: isi FrameDatagram hanya Data dan isi FrameConnectionClose hanya ErrorCode.
+func encodeFrames(frames []Frame) []byte {
+	var buf []byte
+	for _, f := range frames {
+		switch f.Type {
+		case FrameDatagram:
+			buf = appendField(buf, byte(f.Type), f.Data)
+			continue
+		case FrameConnectionClose:
+			buf = appendField(buf, byte(f.Type), binary.AppendUvarint(nil, f.ErrorCode))
+			continue
+		}
+		body := binary.AppendUvarint(nil, f.StreamID)
+		switch f.Type {
+		case FrameData:
+			body = binary.AppendUvarint(body, f.Offset)
+			body = append(body, f.Data...)
+		case FrameClose:
+			body = binary.AppendUvarint(body, f.Offset)
+		case FrameReset:
+			body = binary.AppendUvarint(body, f.ErrorCode)
+		case FrameWindow:
+			body = binary.AppendUvarint(body, f.MaxData)
+		}
+		buf = appendField(buf, byte(f.Type), body)
+	}
+	return buf
+}
+
+// decodeFrames membaca frame yang ditulis encodeFrames. Tipe frame yang tidak dikenal dilewati.
+func decodeFrames(value []byte) ([]Frame, error) {
+	var frames []Frame
+	for len(value) > 0 {
+		frameType := FrameType(value[0])
+		length, n := binary.Uvarint(value[1:])
+		if n <= 0 || length > uint64(len(value)-1-n) {
+			return nil, ErrMessageTruncated
+		}
+		body := value[1+n : 1+n+int(length)]
+		value = value[1+n+int(length):]
+
+		f := Frame{Type: frameType}
+		switch frameType {
+		case FrameDatagram:
+			f.Data = append([]byte(nil), body...)
+			frames = append(frames, f)
+			continue
+		case FrameConnectionClose:
+			code, err := decodeUvarintField(body)
+			if err != nil {
+				return nil, fmt.Errorf("frame 0x%02x: %w", byte(frameType), err)
+			}
+			f.ErrorCode = code
+			frames = append(frames, f)
+			continue
+		}
+		id, n := binary.Uvarint(body)
+		if n <= 0 {
+			return nil, fmt.Errorf("stream ID frame 0x%02x tidak valid", byte(frameType))
+		}
+		f.StreamID = id
+		body = body[n:]
+
+		var err error
+		switch frameType {
+		case FrameOpen:
+			if len(body) != 0 {
+				err = fmt.Errorf("frame open terlalu panjang")
+			}
+		case FrameData:
+			offset, n := binary.Uvarint(body)
+			if n <= 0 {
+				return nil, fmt.Errorf("offset frame data tidak valid")
+			}
+			f.Offset = offset
+			f.Data = append([]byte(nil), body[n:]...)
+		case FrameClose:
+			f.Offset, err = decodeUvarintField(body)
+		case FrameReset:
+			f.ErrorCode, err = decodeUvarintField(body)
+		case FrameWindow:
+			f.MaxData, err = decodeUvarintField(body)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("frame 0x%02x: %w", byte(frameType), err)
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
@@ -1,96 +1,356 @@
 package protocol
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"log"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/eikarna/SecureFlow/internal/crypto"
 )
 
-// HandleServerHandshake menangani proses handshake di sisi server.
-func HandleServerHandshake(conn *net.UDPConn, remoteAddr *net.UDPAddr, clientPubKey [crypto.KeySize]byte, serverPrivKey [crypto.KeySize]byte, serverPubKey [crypto.KeySize]byte) ([crypto.KeySize]byte, error) {
-	// Membuat shared secret
-	sharedKey, err := crypto.SharedSecret(serverPrivKey, clientPubKey)
-	if err != nil {
-		return [crypto.KeySize]byte{}, err
+const (
+	// serverHelloPlainSize adalah bagian ServerHello yang tidak dienkripsi:
+	// representative X25519 efemeral || ciphertext ML-KEM || kunci statis server.
+	serverHelloPlainSize = crypto.HybridCiphertextSize + crypto.KeySize
+	handshakeTimeout     = 10 * time.Second
+	// handshakeRetransmitInterval adalah jeda sebelum ClientHello pertama kali dikirim ulang;
+	// jeda berikutnya berlipat dua.
+	handshakeRetransmitInterval = 500 * time.Millisecond
+
+	// ClientHelloSize adalah ukuran pesan handshake pertama:
+	// kunci publik hibrida || timestamp (8 byte) || MAC PSK.
+	ClientHelloSize = crypto.HybridPublicKeySize + 8 + crypto.HandshakeMACSize
+	// MaxHandshakeAge adalah selisih waktu maksimum yang diterima untuk timestamp ClientHello.
+	MaxHandshakeAge = 2 * time.Minute
+)
+
+var (
+	ErrHandshakeMAC    = errors.New("MAC handshake tidak valid")
+	ErrHandshakeStale  = errors.New("timestamp handshake kedaluwarsa")
+	ErrHandshakeReplay = errors.New("handshake diputar ulang")
+)
+
+// HandshakeResult berisi hasil handshake yang dibutuhkan klien untuk memulai sesi.
+type HandshakeResult struct {
+	Keys         *crypto.KeySchedule
+	SessionID    string
+	ServerStatic [crypto.KeySize]byte
+}
+
+// HostKeyVerifier dipanggil klien untuk memutuskan apakah kunci statis server dipercaya.
+// Mengembalikan error akan membatalkan handshake. Verifier dipanggil sebelum server membuktikan
+// kepemilikan kuncinya, jadi tidak boleh menyimpan kunci itu sebagai kunci tepercaya; simpan
+// HandshakeResult.ServerStatic setelah handshake berhasil.
+type HostKeyVerifier func(serverStatic [crypto.KeySize]byte) error
+
+// NewClientHello membangun pesan handshake pertama yang diautentikasi dengan PSK.
+func NewClientHello(psk [crypto.KeySize]byte, hybridPublic []byte, now time.Time) []byte {
+	hello := make([]byte, 0, ClientHelloSize)
+	hello = append(hello, hybridPublic...)
+	hello = binary.BigEndian.AppendUint64(hello, uint64(now.Unix()))
+	mac := crypto.HandshakeMAC(psk, hello)
+	return append(hello, mac[:]...)
+}
+
+// VerifyClientHello memeriksa ukuran, MAC PSK, dan timestamp ClientHello. Pemeriksaan ini
+// hanya memakai hash berkunci sehingga aman dijalankan sebelum server melakukan operasi
+// kunci publik atau mengalokasikan sesi dan port.
+func VerifyClientHello(psk [crypto.KeySize]byte, hello []byte, now time.Time) error {
+	if len(hello) != ClientHelloSize {
+		return fmt.Errorf("panjang ClientHello salah: %d", len(hello))
+	}
+	body := hello[:ClientHelloSize-crypto.HandshakeMACSize]
+	expected := crypto.HandshakeMAC(psk, body)
+	if subtle.ConstantTimeCompare(expected[:], hello[len(body):]) != 1 {
+		return ErrHandshakeMAC
 	}
+	sent := time.Unix(int64(binary.BigEndian.Uint64(body[crypto.HybridPublicKeySize:])), 0)
+	if age := now.Sub(sent); age > MaxHandshakeAge || age < -MaxHandshakeAge {
+		return ErrHandshakeStale
+	}
+	return nil
+}
 
-	// Mengirim kembali public key server
-	responsePacket := &SecurePacket{
-		Header: PacketHeader{
-			Version: ProtocolVersion,
-			Type:    HandshakeMsgType,
-		},
-		Payload: serverPubKey[:],
+// ReplayFilter mengingat MAC ClientHello yang sudah diterima selama MaxHandshakeAge, sehingga
+// ClientHello yang direkam pihak lain tidak bisa dipakai untuk membuat sesi baru. Entri
+// disimpan juga dalam urutan kedaluwarsanya, jadi setiap Check hanya membuang entri yang
+// sudah lewat di depan antrean alih-alih memindai seluruh map.
+//
+// ServerHello yang dicatat dengan Answer disimpan bersama entrinya, sehingga ClientHello yang
+// dikirim ulang klien karena balasannya hilang bisa dijawab ulang tanpa membuat sesi baru.
+type ReplayFilter struct {
+	mu     sync.Mutex
+	seen   map[[crypto.HandshakeMACSize]byte]*replayEntry
+	expiry []*replayEntry // Urut menurut waktu kedaluwarsa
+}
+
+// replayEntry adalah MAC ClientHello beserta waktu kedaluwarsanya di ReplayFilter.
+type replayEntry struct {
+	mac    [crypto.HandshakeMACSize]byte
+	expiry time.Time
+
+	// ServerHello untuk ClientHello ini, alamat klien yang dijawab, dan batas waktu
+	// balasan boleh dikirim ulang
+	response []byte
+	from     *net.UDPAddr
+	answered time.Time
+}
+
+// NewReplayFilter membuat ReplayFilter kosong.
+func NewReplayFilter() *ReplayFilter {
+	return &ReplayFilter{seen: make(map[[crypto.HandshakeMACSize]byte]*replayEntry)}
+}
+
+// Check mengembalikan ErrHandshakeReplay jika ClientHello ini sudah pernah dilihat.
+// ClientHello harus sudah lolos VerifyClientHello.
+func (f *ReplayFilter) Check(hello []byte, now time.Time) error {
+	mac := helloMAC(hello)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prune(now)
+	if _, ok := f.seen[mac]; ok {
+		return ErrHandshakeReplay
 	}
+	// Timestamp bisa berada hingga MaxHandshakeAge di masa depan, jadi simpan selama dua kali
+	// lipat. now dari jam monoton selalu naik, sehingga antrean tetap urut.
+	entry := &replayEntry{mac: mac, expiry: now.Add(2 * MaxHandshakeAge)}
+	f.seen[mac] = entry
+	f.expiry = append(f.expiry, entry)
+	return nil
+}
 
-	packetBytes, err := responsePacket.Serialize()
-	if err != nil {
-		return [crypto.KeySize]byte{}, err
+// prune membuang entri yang sudah kedaluwarsa di depan antrean. Dipanggil dengan f.mu dikunci.
+func (f *ReplayFilter) prune(now time.Time) {
+	for len(f.expiry) > 0 && now.After(f.expiry[0].expiry) {
+		delete(f.seen, f.expiry[0].mac)
+		f.expiry[0] = nil
+		f.expiry = f.expiry[1:]
 	}
+}
 
-	_, err = conn.WriteToUDP(packetBytes, remoteAddr)
-	if err != nil {
-		return [crypto.KeySize]byte{}, err
+// Answer mencatat response sebagai ServerHello yang dikirim ke from untuk ClientHello yang
+// sudah lolos Check. Balasan itu bisa diambil lagi dengan Resend selama handshakeTimeout.
+func (f *ReplayFilter) Answer(hello []byte, from *net.UDPAddr, response []byte, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if entry, ok := f.seen[helloMAC(hello)]; ok {
+		entry.response, entry.from, entry.answered = response, from, now.Add(handshakeTimeout)
+	}
+}
+
+// Resend mengembalikan ServerHello yang dicatat Answer jika ClientHello ini dikirim ulang dari
+// alamat yang sama sebelum handshakeTimeout habis. ClientHello yang sama dari alamat lain
+// tetap dianggap pemutaran ulang.
+func (f *ReplayFilter) Resend(hello []byte, from *net.UDPAddr, now time.Time) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prune(now)
+	entry, ok := f.seen[helloMAC(hello)]
+	if !ok || entry.response == nil || !now.Before(entry.answered) || !entry.from.IP.Equal(from.IP) || entry.from.Port != from.Port {
+		return nil, false
 	}
+	return entry.response, true
+}
 
-	log.Printf("Handshake dengan %s berhasil. Shared key dibuat.", remoteAddr.String())
-	return sharedKey, nil
+// helloMAC mengembalikan MAC PSK di ujung ClientHello.
+func helloMAC(hello []byte) [crypto.HandshakeMACSize]byte {
+	return [crypto.HandshakeMACSize]byte(hello[len(hello)-crypto.HandshakeMACSize:])
 }
 
-// HandleClientHandshake menangani proses handshake di sisi klien.
-func HandleClientHandshake(conn *net.UDPConn) ([crypto.KeySize]byte, error) {
-	// Membuat kunci klien
-	privKey, pubKey, err := crypto.GenerateKeys()
+// AcceptHandshake memproses ClientHello (kunci publik hibrida klien) dan membangun ServerHello:
+//
+//	representative X25519 efemeral || ciphertext ML-KEM || kunci statis server || nonce || AEAD(session ID)
+//
+// Secret hibrida dicampur dengan DH(kunci statis server, X25519 efemeral klien), mirip pola
+// Noise NX. Hanya pemilik kunci privat statis yang bisa menurunkan kunci yang sama dengan klien,
+// sehingga bagian AEAD yang valid membuktikan identitas server. PSK dicampurkan terakhir seperti
+// pada Noise-PSK, sehingga pihak tanpa auth_key tidak bisa menurunkan kunci sesi.
+// ClientHello harus sudah diperiksa dengan VerifyClientHello.
+func AcceptHandshake(request []byte, psk [crypto.KeySize]byte, identity *crypto.StaticKeyPair, sessionID string) ([]byte, *crypto.KeySchedule, error) {
+	if len(request) != ClientHelloSize {
+		return nil, nil, fmt.Errorf("panjang ClientHello salah: %d", len(request))
+	}
+	hybridResponse, hybridSecret, err := crypto.HybridEncapsulate(request[:crypto.HybridPublicKeySize])
+	if err != nil {
+		return nil, nil, err
+	}
+	clientEphemeral := crypto.RepresentativeToPublic([crypto.KeySize]byte(request[:crypto.KeySize]))
+	staticSecret, err := crypto.SharedSecret(identity.Private, clientEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response := make([]byte, 0, serverHelloPlainSize)
+	response = append(response, hybridResponse...)
+	response = append(response, identity.Public[:]...)
+
+	secret := crypto.MixKey(crypto.MixKey(hybridSecret, staticSecret[:]), psk[:])
+	keys, err := crypto.NewKeySchedule(secret, request, response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed, nonce, err := crypto.Encrypt(keys.ServerToClient, []byte(sessionID))
 	if err != nil {
-		return [crypto.KeySize]byte{}, err
+		return nil, nil, err
 	}
+	response = append(response, nonce...)
+	response = append(response, sealed...)
+	return response, keys, nil
+}
 
-	// Mengirim kunci publik klien ke server
-	handshakePacket := &SecurePacket{
+// SendHandshake mengirim satu paket handshake bertipe msgType ke remoteAddr.
+func SendHandshake(conn PacketConn, remoteAddr *net.UDPAddr, msgType uint8, payload []byte) error {
+	packet := &SecurePacket{
 		Header: PacketHeader{
 			Version: ProtocolVersion,
-			Type:    HandshakeMsgType,
+			Type:    msgType,
 		},
-		Payload: pubKey[:],
+		Payload: payload,
 	}
-
-	packetBytes, err := handshakePacket.Serialize()
+	packetBytes, err := packet.Serialize()
 	if err != nil {
-		return [crypto.KeySize]byte{}, err
+		return err
 	}
-	_, err = conn.Write(packetBytes)
+	_, err = conn.WriteToUDP(packetBytes, remoteAddr)
+	return err
+}
+
+// HandleClientHandshake menangani proses handshake di sisi klien. Kunci statis server
+// diperiksa dengan verify sebelum dipakai; handshake dibatalkan jika verify gagal atau
+// server tidak bisa membuktikan kepemilikan kunci privat statisnya. ClientHello dikirim
+// lewat conn ke serverAddr dan dikirim ulang dengan backoff eksponensial sampai server
+// membalas, ctx dibatalkan, atau handshakeTimeout habis.
+func HandleClientHandshake(ctx context.Context, conn PacketConn, serverAddr *net.UDPAddr, psk [crypto.KeySize]byte, verify HostKeyVerifier) (*HandshakeResult, error) {
+	// Membuat kunci hibrida klien
+	hybridKeys, err := crypto.GenerateHybridKeys()
 	if err != nil {
-		return [crypto.KeySize]byte{}, err
+		return nil, err
 	}
-	log.Println("Mengirim public key ke server...")
 
-	// Menerima kunci publik server
-	buffer := make([]byte, 2048)
-	n, _, err := conn.ReadFromUDP(buffer)
-	if err != nil {
-		return [crypto.KeySize]byte{}, err
+	// Mengirim kunci publik hibrida klien ke server, diautentikasi dengan PSK
+	hello := NewClientHello(psk, hybridKeys.PublicBytes(), time.Now())
+	request := hello
+	if err := SendHandshake(conn, serverAddr, HandshakeMsgType, request); err != nil {
+		return nil, err
 	}
+	log.Println("Mengirim public key hibrida ke server...")
 
-	responsePacket, err := Deserialize(buffer[:n])
-	if err != nil {
-		return [crypto.KeySize]byte{}, err
+	// Menerima ServerHello. Server yang sedang dibanjiri handshake membalas dengan Retry
+	// lebih dulu; ClientHello yang sama dikirim ulang sekali bersama cookie-nya.
+	deadline := time.Now().Add(handshakeTimeout)
+	interval := handshakeRetransmitInterval
+	resend := time.Now().Add(interval)
+	defer conn.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	buffer := make([]byte, MaxPacketSize)
+	retried := false
+	for {
+		if resend.After(deadline) {
+			resend = deadline
+		}
+		conn.SetReadDeadline(resend)
+		// Diperiksa setelah batas waktu dipasang agar pembatalan yang terjadi bersamaan
+		// tidak tertimpa
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() || !time.Now().Before(deadline) {
+				return nil, err
+			}
+			// ClientHello atau balasannya hilang
+			if err := SendHandshake(conn, serverAddr, HandshakeMsgType, request); err != nil {
+				return nil, err
+			}
+			interval *= 2
+			resend = time.Now().Add(interval)
+			continue
+		}
+		responsePacket, err := Deserialize(buffer[:n])
+		if err != nil {
+			return nil, err
+		}
+		switch responsePacket.Header.Type {
+		case HandshakeMsgType:
+			log.Println("Menerima balasan hibrida dari server.")
+			return finishClientHandshake(hybridKeys, psk, hello, responsePacket.Payload, verify)
+		case RetryMsgType:
+			retry := responsePacket.Payload
+			// Retry untuk ClientHello lain, atau Retry kedua, diabaikan
+			if retried || len(retry) != RetrySize || subtle.ConstantTimeCompare(retry[:crypto.HandshakeMACSize], hello[ClientHelloSize-crypto.HandshakeMACSize:]) != 1 {
+				continue
+			}
+			retried = true
+			log.Println("Server meminta cookie, ClientHello dikirim ulang...")
+			request = append(append([]byte(nil), hello...), retry[crypto.HandshakeMACSize:]...)
+			if err := SendHandshake(conn, serverAddr, HandshakeMsgType, request); err != nil {
+				return nil, err
+			}
+			resend = time.Now().Add(interval)
+		default:
+			return nil, fmt.Errorf("menerima paket handshake yang tidak valid dari server")
+		}
 	}
+}
 
-	if responsePacket.Header.Type != HandshakeMsgType || len(responsePacket.Payload) != crypto.KeySize {
-		log.Fatalf("Menerima paket handshake yang tidak valid dari server")
+// finishClientHandshake memverifikasi ServerHello dan menurunkan kunci sesi di sisi klien.
+func finishClientHandshake(hybridKeys *crypto.PQCKeys, psk [crypto.KeySize]byte, request, response []byte, verify HostKeyVerifier) (*HandshakeResult, error) {
+	if len(response) < serverHelloPlainSize {
+		return nil, fmt.Errorf("balasan handshake terlalu pendek: %d", len(response))
 	}
 
-	var serverPubKey [crypto.KeySize]byte
-	copy(serverPubKey[:], responsePacket.Payload)
-	log.Println("Menerima public key dari server.")
+	var serverStatic [crypto.KeySize]byte
+	copy(serverStatic[:], response[crypto.HybridCiphertextSize:serverHelloPlainSize])
+	if verify != nil {
+		if err := verify(serverStatic); err != nil {
+			return nil, err
+		}
+	}
 
-	// Membuat shared secret
-	sharedKey, err := crypto.SharedSecret(privKey, serverPubKey)
+	hybridSecret, err := crypto.HybridSharedSecret(hybridKeys, response[:crypto.HybridCiphertextSize])
+	if err != nil {
+		return nil, err
+	}
+	staticSecret, err := crypto.SharedSecret(hybridKeys.X25519Private, serverStatic)
 	if err != nil {
-		return [crypto.KeySize]byte{}, err
+		return nil, err
+	}
+	secret := crypto.MixKey(crypto.MixKey(hybridSecret, staticSecret[:]), psk[:])
+	keys, err := crypto.NewKeySchedule(secret, request, response[:serverHelloPlainSize])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := response[serverHelloPlainSize:]
+	if len(sealed) < NonceSize {
+		return nil, fmt.Errorf("balasan handshake terlalu pendek: %d", len(response))
+	}
+	sessionInfo, err := crypto.Decrypt(keys.ServerToClient, sealed[:NonceSize], sealed[NonceSize:])
+	if err != nil {
+		return nil, fmt.Errorf("server gagal membuktikan kepemilikan kunci statis: %w", err)
+	}
+	if len(sessionInfo) == 0 {
+		return nil, fmt.Errorf("informasi sesi dari server tidak valid")
 	}
 
-	log.Println("Handshake berhasil, shared secret dibuat.")
-	return sharedKey, nil
+	log.Println("Handshake berhasil, identitas server terverifikasi.")
+	return &HandshakeResult{
+		Keys:         keys,
+		SessionID:    string(sessionInfo),
+		ServerStatic: serverStatic,
+	}, nil
 }
@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+)
+
+func TestReplayFilter(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	hello := func(i byte) []byte {
+		h := make([]byte, ClientHelloSize)
+		h[len(h)-1] = i
+		return h
+	}
+	f := NewReplayFilter()
+	for i := range byte(10) {
+		if err := f.Check(hello(i), now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("ClientHello %d: %v", i, err)
+		}
+	}
+	if err := f.Check(hello(3), now.Add(time.Minute)); !errors.Is(err, ErrHandshakeReplay) {
+		t.Errorf("ClientHello yang diputar ulang: error %v", err)
+	}
+
+	// Entri yang kedaluwarsa dibuang dari depan antrean tanpa menyentuh entri yang lebih baru
+	later := now.Add(2*MaxHandshakeAge + 4500*time.Millisecond)
+	if err := f.Check(hello(7), later); !errors.Is(err, ErrHandshakeReplay) {
+		t.Errorf("ClientHello yang belum kedaluwarsa diterima ulang: %v", err)
+	}
+	if len(f.seen) != 5 || len(f.expiry) != 5 {
+		t.Errorf("%d entri tersisa (%d di antrean), diharapkan 5", len(f.seen), len(f.expiry))
+	}
+	if err := f.Check(hello(0), later); err != nil {
+		t.Errorf("ClientHello yang sudah kedaluwarsa dari filter: %v", err)
+	}
+}
+
+func TestReplayFilterResend(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	hello := make([]byte, ClientHelloSize)
+	from := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}
+	f := NewReplayFilter()
+	if err := f.Check(hello, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Resend(hello, from, now); ok {
+		t.Error("balasan dikirim ulang sebelum ServerHello dicatat")
+	}
+	f.Answer(hello, from, []byte("server-hello"), now)
+
+	tests := []struct {
+		name string
+		from *net.UDPAddr
+		at   time.Time
+		ok   bool
+	}{
+		{"alamat sama", &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}, now.Add(time.Second), true},
+		{"port lain", &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40001}, now.Add(time.Second), false},
+		{"IP lain", &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 40000}, now.Add(time.Second), false},
+		{"setelah handshakeTimeout", from, now.Add(handshakeTimeout), false},
+	}
+	for _, tt := range tests {
+		response, ok := f.Resend(hello, tt.from, tt.at)
+		if ok != tt.ok || (ok && string(response) != "server-hello") {
+			t.Errorf("%s: balasan %q, %v; diharapkan %v", tt.name, response, ok, tt.ok)
+		}
+		if err := f.Check(hello, tt.at); !errors.Is(err, ErrHandshakeReplay) {
+			t.Errorf("%s: ClientHello yang dikirim ulang lolos Check: %v", tt.name, err)
+		}
+	}
+}
+
+func TestVerifyClientHello(t *testing.T) {
+	psk := [crypto.KeySize]byte{1}
+	now := time.Unix(1_700_000_000, 0)
+	public := make([]byte, crypto.HybridPublicKeySize)
+	tests := []struct {
+		name  string
+		hello []byte
+		err   error
+	}{
+		{"valid", NewClientHello(psk, public, now), nil},
+		{"PSK salah", NewClientHello([crypto.KeySize]byte{2}, public, now), ErrHandshakeMAC},
+		{"terlalu lama", NewClientHello(psk, public, now.Add(-MaxHandshakeAge-time.Second)), ErrHandshakeStale},
+		{"dari masa depan", NewClientHello(psk, public, now.Add(MaxHandshakeAge+time.Second)), ErrHandshakeStale},
+	}
+	for _, tt := range tests {
+		if err := VerifyClientHello(psk, tt.hello, now); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, diharapkan %v", tt.name, err, tt.err)
+		}
+	}
+	if err := VerifyClientHello(psk, make([]byte, ClientHelloSize-1), now); err == nil {
+		t.Error("ClientHello terpotong diterima")
+	}
+}
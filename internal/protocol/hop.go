@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"time"
+
+	"lukechampine.com/blake3"
+)
+
+// DefaultHopInterval adalah lama satu slot jadwal port hop jika konfigurasi tidak mengaturnya.
+const DefaultHopInterval = 10 * time.Second
+
+// HopSchedule menurunkan port hop dari kunci rahasia dan waktu sejak sesi dimulai, seperti
+// TOTP: waktu dibagi menjadi slot sepanjang interval dan port setiap slot dihitung dengan
+// BLAKE3 berkunci. Kedua sisi menghitung jadwal yang sama tanpa pernah mengirimkan port
+// berikutnya, sehingga paket yang hilang tidak membuat jadwal kedua sisi berbeda.
+type HopSchedule struct {
+	key      [HashSize]byte
+	start    int
+	size     int
+	interval time.Duration
+	epoch    time.Time
+}
+
+// NewHopSchedule membuat jadwal untuk rentang port start-end dengan slot sepanjang interval
+// yang dihitung mulai epoch. Setiap sisi memakai waktu handshake selesai menurut jamnya
+// sendiri sebagai epoch; selisihnya cukup kecil untuk ditoleransi Accepts. Jadwal balasan
+// server→klien memakai rentang indeks daftar port balasan klien, bukan nomor port.
+func NewHopSchedule(key [HashSize]byte, start, end int, interval time.Duration, epoch time.Time) *HopSchedule {
+	if interval <= 0 {
+		interval = DefaultHopInterval
+	}
+	return &HopSchedule{key: key, start: start, size: end - start + 1, interval: interval, epoch: epoch}
+}
+
+// Slot mengembalikan nomor slot pada waktu now.
+func (h *HopSchedule) Slot(now time.Time) uint64 {
+	if now.Before(h.epoch) {
+		return 0
+	}
+	return uint64(now.Sub(h.epoch) / h.interval)
+}
+
+// Port mengembalikan port untuk slot.
+func (h *HopSchedule) Port(slot uint64) int {
+	var slotBytes [8]byte
+	binary.BigEndian.PutUint64(slotBytes[:], slot)
+	hasher := blake3.New(8, h.key[:])
+	hasher.Write(slotBytes[:])
+	return h.start + int(binary.BigEndian.Uint64(hasher.Sum(nil))%uint64(h.size))
+}
+
+// Current mengembalikan port untuk slot yang sedang berjalan pada waktu now.
+func (h *HopSchedule) Current(now time.Time) int {
+	return h.Port(h.Slot(now))
+}
+
+// Accepts melaporkan apakah paket yang tiba di port pada waktu now mengikuti jadwal. Slot
+// sebelum dan sesudahnya juga diterima agar selisih epoch, paket yang tertahan di jalan,
+// dan pergantian slot tidak membuat paket ditolak.
+func (h *HopSchedule) Accepts(port int, now time.Time) bool {
+	slot := h.Slot(now)
+	if slot > 0 && h.Port(slot-1) == port {
+		return true
+	}
+	return h.Port(slot) == port || h.Port(slot+1) == port
+}
@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHopScheduleDeterministic(t *testing.T) {
+	epoch := time.Now()
+	key := [HashSize]byte{1, 2, 3}
+	client := NewHopSchedule(key, 5001, 5999, time.Second, epoch)
+	server := NewHopSchedule(key, 5001, 5999, time.Second, epoch)
+	other := NewHopSchedule([HashSize]byte{9}, 5001, 5999, time.Second, epoch)
+	same := 0
+	for slot := range uint64(200) {
+		port := client.Port(slot)
+		if port < 5001 || port > 5999 {
+			t.Fatalf("slot %d: port %d di luar rentang", slot, port)
+		}
+		if server.Port(slot) != port {
+			t.Fatalf("slot %d: kedua sisi menghitung port berbeda", slot)
+		}
+		if other.Port(slot) == port {
+			same++
+		}
+	}
+	if same > 10 {
+		t.Errorf("jadwal dengan kunci berbeda sama di %d dari 200 slot", same)
+	}
+}
+
+func TestHopScheduleSlots(t *testing.T) {
+	epoch := time.Now()
+	h := NewHopSchedule([HashSize]byte{1}, 0, 7, 0, epoch)
+	tests := []struct {
+		at   time.Duration
+		slot uint64
+	}{
+		{-time.Second, 0},
+		{0, 0},
+		{DefaultHopInterval - 1, 0},
+		{DefaultHopInterval, 1},
+		{5*DefaultHopInterval + time.Second, 5},
+	}
+	for _, tt := range tests {
+		if got := h.Slot(epoch.Add(tt.at)); got != tt.slot {
+			t.Errorf("Slot(epoch%+v) = %d, diharapkan %d", tt.at, got, tt.slot)
+		}
+	}
+	// Rentang satu port selalu menghasilkan port itu
+	single := NewHopSchedule([HashSize]byte{1}, 4000, 4000, time.Second, epoch)
+	if single.Current(epoch.Add(time.Hour)) != 4000 {
+		t.Error("rentang satu port menghasilkan port lain")
+	}
+}
+
+func TestHopScheduleAccepts(t *testing.T) {
+	epoch := time.Now()
+	h := NewHopSchedule([HashSize]byte{7}, 6000, 6999, time.Second, epoch)
+	now := epoch.Add(10*time.Second + 500*time.Millisecond)
+	slot := h.Slot(now)
+	for _, s := range []uint64{slot - 1, slot, slot + 1} {
+		if !h.Accepts(h.Port(s), now) {
+			t.Errorf("port slot %d ditolak pada slot %d", s, slot)
+		}
+	}
+	adjacent := map[int]bool{h.Port(slot - 1): true, h.Port(slot): true, h.Port(slot + 1): true}
+	for _, s := range []uint64{slot - 3, slot + 3} {
+		if port := h.Port(s); !adjacent[port] && h.Accepts(port, now) {
+			t.Errorf("port slot %d diterima pada slot %d", s, slot)
+		}
+	}
+	// Epoch server sedikit lebih lambat dari klien: port klien tetap diterima di batas slot
+	server := NewHopSchedule([HashSize]byte{7}, 6000, 6999, time.Second, epoch.Add(200*time.Millisecond))
+	for at := time.Duration(0); at < 5*time.Second; at += 100 * time.Millisecond {
+		if port := h.Current(epoch.Add(at)); !server.Accepts(port, epoch.Add(at)) {
+			t.Fatalf("port klien pada %v ditolak server", at)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"net"
+	"sync"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"lukechampine.com/blake3"
+)
+
+// MaskSaltSize adalah ukuran salt acak di depan setiap datagram yang disamarkan.
+const MaskSaltSize = 8
+
+// keystream mengisi dst dengan keystream BLAKE3 berkunci key atas salt.
+func keystream(key [crypto.KeySize]byte, salt, dst []byte) {
+	h := blake3.New(crypto.KeySize, key[:])
+	h.Write(salt)
+	h.XOF().Read(dst)
+}
+
+// maskXOR mengisi dst dengan src XOR keystream atas salt. dst dan src tidak boleh tumpang tindih.
+func maskXOR(key [crypto.KeySize]byte, salt, dst, src []byte) {
+	keystream(key, salt, dst)
+	subtle.XORBytes(dst, dst, src)
+}
+
+// MaskedConn menyamarkan setiap datagram yang melewati conn dengan kunci turunan PSK,
+// seperti obfuscator Salamander milik Hysteria: datagram di jalur berupa salt acak diikuti
+// datagram asli yang di-XOR keystream BLAKE3 berkunci atas salt itu. Tanpa PSK, setiap
+// byte, termasuk header tetap dan paket handshake, tidak bisa dibedakan dari acak.
+// Datagram yang terlalu pendek untuk berisi salt dibuang diam-diam.
+type MaskedConn struct {
+	PacketConn
+	key [crypto.KeySize]byte
+
+	readMu  sync.Mutex
+	readBuf []byte
+}
+
+// NewMaskedConn membungkus conn dengan penyamaran berkunci key.
+func NewMaskedConn(conn PacketConn, key [crypto.KeySize]byte) *MaskedConn {
+	return &MaskedConn{PacketConn: conn, key: key}
+}
+
+// ReadFromUDP membaca satu datagram dan membuka penyamarannya ke b.
+func (c *MaskedConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(c.readBuf) < len(b)+MaskSaltSize {
+		c.readBuf = make([]byte, len(b)+MaskSaltSize)
+	}
+	for {
+		n, addr, err := c.PacketConn.ReadFromUDP(c.readBuf[:len(b)+MaskSaltSize])
+		if err != nil {
+			return 0, addr, err
+		}
+		if n <= MaskSaltSize {
+			continue
+		}
+		maskXOR(c.key, c.readBuf[:MaskSaltSize], b[:n-MaskSaltSize], c.readBuf[MaskSaltSize:n])
+		return n - MaskSaltSize, addr, nil
+	}
+}
+
+// WriteToUDP menyamarkan b dengan salt baru lalu mengirimnya ke addr.
+func (c *MaskedConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	out := make([]byte, MaskSaltSize+len(b))
+	if _, err := rand.Read(out[:MaskSaltSize]); err != nil {
+		return 0, err
+	}
+	maskXOR(c.key, out[:MaskSaltSize], out[MaskSaltSize:], b)
+	if _, err := c.PacketConn.WriteToUDP(out, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// maskedTransport membungkus setiap port yang dibuka Transport dengan MaskedConn.
+type maskedTransport struct {
+	Transport
+	key [crypto.KeySize]byte
+}
+
+// NewMaskedTransport mengembalikan Transport yang menyamarkan semua datagram di port yang
+// dibukanya dengan kunci key.
+func NewMaskedTransport(transport Transport, key [crypto.KeySize]byte) Transport {
+	return maskedTransport{Transport: transport, key: key}
+}
+
+// Listen membuka port lewat Transport asal dan membungkusnya dengan MaskedConn.
+func (t maskedTransport) Listen(addr *net.UDPAddr) (PacketConn, error) {
+	conn, err := t.Transport.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewMaskedConn(conn, t.key), nil
+}
+
+// prevHashMask menghitung masker header protection untuk PrevHash paket data dengan kunci
+// header-protection key dan nonce AEAD paket sebagai sampel, seperti header protection
+// QUIC. Pengirim dan penerima meng-XOR PrevHash dengan masker ini. Penyamaran PSK sudah
+// menyembunyikan header dari pengamat; lapisan ini menyembunyikan rantai hash dari pemegang
+// PSK lain, yang sebaliknya bisa mengaitkan paket satu sesi di port hop berbeda lewat hash
+// paket sebelumnya.
+func prevHashMask(key [crypto.KeySize]byte, nonce []byte) [HashSize]byte {
+	var mask [HashSize]byte
+	keystream(key, nonce, mask[:])
+	return mask
+}
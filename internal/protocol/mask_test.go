@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+)
+
+// listenPort membuka port di transport dengan batas waktu baca satu detik.
+func listenPort(t *testing.T, transport Transport, ip net.IP, port int) PacketConn {
+	t.Helper()
+	conn, err := transport.Listen(&net.UDPAddr{IP: ip, Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	return conn
+}
+
+func TestMaskedConn(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	key, wrongKey := [crypto.KeySize]byte{1}, [crypto.KeySize]byte{2}
+	aIP, bIP := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	a := listenPort(t, NewMaskedTransport(network.Host(aIP), key), aIP, 7000)
+	b := listenPort(t, NewMaskedTransport(network.Host(bIP), key), bIP, 7000)
+	raw := listenPort(t, network.Host(bIP), bIP, 7001)
+	wrong := listenPort(t, NewMaskedTransport(network.Host(bIP), wrongKey), bIP, 7002)
+	buf := make([]byte, 2048)
+
+	for _, size := range []int{1, 40, 1400} {
+		payload := bytes.Repeat([]byte{0xab}, size)
+		if _, err := a.WriteToUDP(payload, b.LocalAddr().(*net.UDPAddr)); err != nil {
+			t.Fatal(err)
+		}
+		n, from, err := b.ReadFromUDP(buf)
+		if err != nil || !bytes.Equal(buf[:n], payload) {
+			t.Fatalf("%d byte: diterima %d byte, %v", size, n, err)
+		}
+		if from.Port != 7000 {
+			t.Errorf("%d byte: alamat asal %v", size, from)
+		}
+
+		// Di jalur datagram diawali salt dan tidak memuat isi aslinya
+		a.WriteToUDP(payload, raw.LocalAddr().(*net.UDPAddr))
+		n, _, err = raw.ReadFromUDP(buf)
+		if err != nil || n != size+MaskSaltSize || (size >= 8 && bytes.Equal(buf[MaskSaltSize:n], payload)) {
+			t.Errorf("%d byte: datagram di jalur %x, %v", size, buf[:n], err)
+		}
+
+		// Kunci yang salah membuka datagram menjadi byte acak
+		a.WriteToUDP(payload, wrong.LocalAddr().(*net.UDPAddr))
+		n, _, err = wrong.ReadFromUDP(buf)
+		if err != nil || n != size || (size >= 8 && bytes.Equal(buf[:n], payload)) {
+			t.Errorf("%d byte: kunci salah membuka %x, %v", size, buf[:n], err)
+		}
+	}
+
+	// Datagram yang tidak lebih panjang dari salt dibuang; pembaca menunggu datagram berikutnya
+	sender := listenPort(t, network.Host(aIP), aIP, 7003)
+	for size := range MaskSaltSize + 1 {
+		sender.WriteToUDP(make([]byte, size), b.LocalAddr().(*net.UDPAddr))
+	}
+	a.WriteToUDP([]byte("utuh"), b.LocalAddr().(*net.UDPAddr))
+	if n, _, err := b.ReadFromUDP(buf); err != nil || string(buf[:n]) != "utuh" {
+		t.Errorf("setelah datagram pendek diterima %q, %v", buf[:n], err)
+	}
+}
+
+func TestPrevHashMask(t *testing.T) {
+	key, otherKey := [crypto.KeySize]byte{1}, [crypto.KeySize]byte{2}
+	nonce, otherNonce := make([]byte, NonceSize), make([]byte, NonceSize)
+	otherNonce[NonceSize-1] = 1
+
+	mask := prevHashMask(key, nonce)
+	if mask != prevHashMask(key, slices.Clone(nonce)) {
+		t.Error("mask berbeda untuk kunci dan nonce yang sama")
+	}
+	if mask == ([HashSize]byte{}) {
+		t.Error("mask bernilai nol")
+	}
+	if mask == prevHashMask(otherKey, nonce) {
+		t.Error("mask tidak bergantung pada kunci")
+	}
+	if mask == prevHashMask(key, otherNonce) {
+		t.Error("mask tidak bergantung pada nonce")
+	}
+}
@@ -0,0 +1,280 @@
+package protocol
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// memoryQueueSize adalah jumlah datagram yang ditahan satu port memori sebelum datagram
+	// berikutnya dibuang, seperti buffer socket yang penuh.
+	memoryQueueSize = 1024
+	// memoryEphemeralPort adalah port pertama yang dipakai untuk port efemeral.
+	memoryEphemeralPort = 40000
+)
+
+// LinkConditions mengatur perilaku MemoryNetwork untuk setiap datagram.
+type LinkConditions struct {
+	Loss      float64 // Peluang datagram hilang
+	Duplicate float64 // Peluang datagram dikirim dua kali
+	Reorder   float64 // Peluang datagram ditahan ReorderDelay sehingga disalip datagram sesudahnya
+	// ReorderDelay adalah tambahan waktu untuk datagram yang di-reorder. Nol berarti
+	// max(Latency, 1ms).
+	ReorderDelay time.Duration
+	Latency      time.Duration // Waktu tempuh setiap datagram
+	MTU          int           // Datagram yang lebih besar dibuang diam-diam; nol berarti tanpa batas
+}
+
+// MemoryStats menghitung nasib datagram yang dikirim lewat MemoryNetwork.
+type MemoryStats struct {
+	Sent       int // Datagram yang diserahkan ke WriteToUDP
+	Delivered  int // Datagram yang masuk antrean port tujuan
+	Lost       int // Dibuang karena Loss, MTU, port tujuan tidak ada, atau antrean penuh
+	Duplicated int
+	Reordered  int
+}
+
+// MemoryNetwork adalah jaringan datagram dalam memori. Keputusan loss, duplikasi, dan
+// reorder diambil dari sumber acak dengan seed tetap sehingga pengujian bisa diulang.
+// Tanpa Latency dan Reorder, datagram langsung masuk antrean tujuan sebelum WriteToUDP kembali.
+type MemoryNetwork struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	link     LinkConditions
+	ports    map[string]*memoryConn // ip:port → port yang sedang dibuka
+	nextPort map[string]int         // ip → port efemeral berikutnya
+	stats    MemoryStats
+}
+
+// NewMemoryNetwork membuat jaringan memori dengan kondisi link dan seed acak seed.
+func NewMemoryNetwork(seed int64, link LinkConditions) *MemoryNetwork {
+	return &MemoryNetwork{
+		rng:      rand.New(rand.NewSource(seed)),
+		link:     link,
+		ports:    make(map[string]*memoryConn),
+		nextPort: make(map[string]int),
+	}
+}
+
+// SetConditions mengganti kondisi link untuk datagram berikutnya.
+func (n *MemoryNetwork) SetConditions(link LinkConditions) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.link = link
+}
+
+// Stats mengembalikan hitungan datagram sejauh ini.
+func (n *MemoryNetwork) Stats() MemoryStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// Host mengembalikan Transport untuk host dengan alamat ip di jaringan ini. Port yang dibuka
+// tanpa IP atau dengan IP unspecified terikat ke ip.
+func (n *MemoryNetwork) Host(ip net.IP) Transport {
+	return &memoryHost{network: n, ip: ip}
+}
+
+// ephemeralPort mengalokasikan port yang belum dipakai di ip. Dipanggil dengan n.mu dipegang.
+func (n *MemoryNetwork) ephemeralPort(ip net.IP) int {
+	for {
+		port := n.nextPort[ip.String()]
+		if port < memoryEphemeralPort || port > 65535 {
+			port = memoryEphemeralPort
+		}
+		n.nextPort[ip.String()] = port + 1
+		if _, used := n.ports[memoryKey(ip, port)]; !used {
+			return port
+		}
+	}
+}
+
+// send menerapkan kondisi link lalu menjadwalkan packet ke to.
+func (n *MemoryNetwork) send(from, to *net.UDPAddr, packet []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stats.Sent++
+	link := n.link
+	if n.rng.Float64() < link.Loss || (link.MTU > 0 && len(packet) > link.MTU) {
+		n.stats.Lost++
+		return
+	}
+	copies := 1
+	if n.rng.Float64() < link.Duplicate {
+		copies = 2
+		n.stats.Duplicated++
+	}
+	delay := link.Latency
+	if n.rng.Float64() < link.Reorder {
+		extra := link.ReorderDelay
+		if extra == 0 {
+			extra = max(link.Latency, time.Millisecond)
+		}
+		delay += extra
+		n.stats.Reordered++
+	}
+	data := append([]byte(nil), packet...)
+	for range copies {
+		if delay == 0 {
+			n.deliver(from, to, data)
+			continue
+		}
+		time.AfterFunc(delay, func() {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			n.deliver(from, to, data)
+		})
+	}
+}
+
+// deliver memasukkan datagram ke antrean port tujuan. Dipanggil dengan n.mu dipegang.
+func (n *MemoryNetwork) deliver(from, to *net.UDPAddr, data []byte) {
+	conn, ok := n.ports[memoryKey(to.IP, to.Port)]
+	if !ok {
+		n.stats.Lost++
+		return
+	}
+	select {
+	case conn.queue <- memoryPacket{from: from, data: data}:
+		n.stats.Delivered++
+	default:
+		n.stats.Lost++
+	}
+}
+
+func memoryKey(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port))
+}
+
+// memoryHost adalah satu host di MemoryNetwork.
+type memoryHost struct {
+	network *MemoryNetwork
+	ip      net.IP
+}
+
+func (h *memoryHost) Listen(addr *net.UDPAddr) (PacketConn, error) {
+	n := h.network
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ip := h.ip
+	if addr != nil && addr.IP != nil && !addr.IP.IsUnspecified() {
+		if !addr.IP.Equal(h.ip) {
+			return nil, fmt.Errorf("listen %s: alamat bukan milik host %s", addr, h.ip)
+		}
+	}
+	port := 0
+	if addr != nil {
+		port = addr.Port
+	}
+	if port == 0 {
+		port = n.ephemeralPort(ip)
+	}
+	key := memoryKey(ip, port)
+	if _, used := n.ports[key]; used {
+		return nil, fmt.Errorf("listen %s: port sudah dipakai", key)
+	}
+	conn := &memoryConn{
+		network:  n,
+		addr:     &net.UDPAddr{IP: ip, Port: port},
+		queue:    make(chan memoryPacket, memoryQueueSize),
+		closed:   make(chan struct{}),
+		deadline: make(chan struct{}),
+	}
+	n.ports[key] = conn
+	return conn, nil
+}
+
+type memoryPacket struct {
+	from *net.UDPAddr
+	data []byte
+}
+
+// memoryConn adalah satu port terbuka di MemoryNetwork.
+type memoryConn struct {
+	network *MemoryNetwork
+	addr    *net.UDPAddr
+	queue   chan memoryPacket
+	closed  chan struct{}
+
+	mu        sync.Mutex
+	readUntil time.Time
+	deadline  chan struct{} // Ditutup lalu diganti setiap kali deadline berubah
+	closeOnce sync.Once
+}
+
+func (c *memoryConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	for {
+		c.mu.Lock()
+		until, changed := c.readUntil, c.deadline
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !until.IsZero() {
+			wait := time.Until(until)
+			if wait <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		n, from, err, done := 0, (*net.UDPAddr)(nil), error(nil), true
+		select {
+		case p := <-c.queue:
+			n, from = copy(b, p.data), p.from
+		case <-c.closed:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-changed:
+			done = false // Deadline berubah: tunggu lagi dengan deadline baru
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return n, from, err
+		}
+	}
+}
+
+func (c *memoryConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.network.send(c.addr, addr, b)
+	return len(b), nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readUntil = t
+	close(c.deadline)
+	c.deadline = make(chan struct{})
+	return nil
+}
+
+func (c *memoryConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		n := c.network
+		n.mu.Lock()
+		delete(n.ports, memoryKey(c.addr.IP, c.addr.Port))
+		n.mu.Unlock()
+		close(c.closed)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,309 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DataMessageVersion adalah versi format biner DataMessage.
+const DataMessageVersion = 1
+
+// Tipe field TLV di dalam DataMessage.
+const (
+	// fieldPad1 adalah satu byte padding tanpa panjang dan nilai, seperti opsi Pad1 IPv6,
+	// untuk sisa satu byte yang tidak bisa diisi field padding biasa
+	fieldPad1      = 0x00
+	fieldSeq       = 0x01
+	fieldAckRanges = 0x02
+	// 0x03 dulu NextPort; port hop kini diturunkan dari HopSchedule dan tidak dikirim
+	fieldReturnPorts = 0x04
+	fieldMessage     = 0x05
+	fieldForwardSeq  = 0x06
+	fieldFragment    = 0x07
+	fieldPadding     = 0x08
+	fieldFrames      = 0x09
+	fieldAckOnly     = 0x0a
+	fieldRecvWindow  = 0x0b
+)
+
+// MaxReturnPorts adalah jumlah maksimum port balasan yang boleh diumumkan klien.
+const MaxReturnPorts = 64
+
+var (
+	ErrMessageTruncated = errors.New("pesan data terpotong")
+	ErrMessageVersion   = errors.New("versi pesan data tidak didukung")
+)
+
+// DataMessage adalah struktur data aplikasi yang sebenarnya.
+// Struktur ini diserialisasi dengan EncodeDataMessage lalu dienkripsi.
+type DataMessage struct {
+	Message []byte
+	Seq     uint64     // Nomor urut paket ini
+	Acks    []AckRange // Rentang SACK nomor urut yang sudah diterima dari peer
+	// ReturnPorts adalah port-port tempat klien menerima paket server. Server memilih salah
+	// satunya untuk setiap paket dengan jadwal hop server→klien; kosong berarti tidak berubah.
+	ReturnPorts []uint16
+	// ForwardSeq menyatakan bahwa pengirim tidak akan mengirim (ulang) nomor urut di bawahnya.
+	// Penerima melompati celah di bawah nilai ini dan menyinkronkan ulang rantai hash.
+	ForwardSeq uint64
+	// Informasi fragmen untuk pesan yang dipotong oleh SplitMessage. FragmentTotal nol
+	// berarti Message adalah pesan utuh.
+	FragmentID     uint64
+	FragmentOffset uint64
+	FragmentTotal  uint64
+	// Padding adalah jumlah byte, termasuk tipe dan panjang field, yang ditambahkan agar
+	// paket mencapai ukuran tertentu, misalnya untuk probe PMTU. Isinya diabaikan penerima.
+	Padding int
+	// Frames adalah frame stream yang dibawa paket ini.
+	Frames []Frame
+	// AckOnly menandai paket yang hanya membawa ACK. Paket ini tidak dikirim ulang dan
+	// tidak perlu di-ACK oleh penerima.
+	AckOnly bool
+	// ReceiveWindow mengumumkan ukuran jendela penerimaan pengirim dalam nomor urut. Dikirim
+	// sampai peer meng-ACK salah satu paket; nol berarti tidak diumumkan.
+	ReceiveWindow uint64
+}
+
+// Fragment mengembalikan isi pesan sebagai fragmen untuk Reassembler.
+func (m *DataMessage) Fragment() Fragment {
+	return Fragment{ID: m.FragmentID, Offset: m.FragmentOffset, Total: m.FragmentTotal, Data: m.Message}
+}
+
+// SetFragment mengisi Message dan informasi fragmen dari f.
+func (m *DataMessage) SetFragment(f Fragment) {
+	m.Message = f.Data
+	m.FragmentID, m.FragmentOffset, m.FragmentTotal = f.ID, f.Offset, f.Total
+}
+
+// EncodeDataMessage mengubah DataMessage menjadi format biner berversi:
+//
+//	versi (1 byte) || field TLV...
+//
+// Setiap field berbentuk tipe (1 byte) || panjang (uvarint) || nilai. Field dengan nilai
+// nol selain Seq tidak ditulis, sehingga paket ACK murni tetap kecil. Rentang SACK ditulis
+// sebagai pasangan uvarint (awal, panjang-1), dan informasi fragmen sebagai tiga uvarint
+// (ID, offset, total). Padding ditulis paling akhir sebagai satu field padding ditambah,
+// jika perlu, satu byte fieldPad1.
+func EncodeDataMessage(msg *DataMessage) ([]byte, error) {
+	buf := make([]byte, 0, 32+len(msg.Message))
+	buf = append(buf, DataMessageVersion)
+	buf = appendUvarintField(buf, fieldSeq, msg.Seq)
+	if len(msg.Acks) > 0 {
+		buf = appendField(buf, fieldAckRanges, encodeAckRanges(msg.Acks))
+	}
+	if len(msg.ReturnPorts) > 0 {
+		var ports []byte
+		for _, port := range msg.ReturnPorts {
+			ports = binary.BigEndian.AppendUint16(ports, port)
+		}
+		buf = appendField(buf, fieldReturnPorts, ports)
+	}
+	if len(msg.Message) > 0 {
+		buf = appendField(buf, fieldMessage, msg.Message)
+	}
+	if msg.ForwardSeq != 0 {
+		buf = appendUvarintField(buf, fieldForwardSeq, msg.ForwardSeq)
+	}
+	if msg.FragmentTotal != 0 {
+		value := binary.AppendUvarint(nil, msg.FragmentID)
+		value = binary.AppendUvarint(value, msg.FragmentOffset)
+		value = binary.AppendUvarint(value, msg.FragmentTotal)
+		buf = appendField(buf, fieldFragment, value)
+	}
+	if len(msg.Frames) > 0 {
+		buf = appendField(buf, fieldFrames, encodeFrames(msg.Frames))
+	}
+	if msg.AckOnly {
+		buf = appendField(buf, fieldAckOnly, nil)
+	}
+	if msg.ReceiveWindow != 0 {
+		buf = appendUvarintField(buf, fieldRecvWindow, msg.ReceiveWindow)
+	}
+	if msg.Padding > 0 {
+		buf = appendPadding(buf, msg.Padding)
+	}
+	return buf, nil
+}
+
+// appendPadding menambahkan tepat size byte padding. Panjang uvarint membuat field padding
+// tidak bisa berukuran 1, 130, 16387, dan seterusnya; sisa satu byte itu diisi fieldPad1.
+func appendPadding(buf []byte, size int) []byte {
+	if size >= 2 {
+		length := size - 2
+		for 1+uvarintLen(uint64(length))+length > size {
+			length--
+		}
+		buf = appendField(buf, fieldPadding, make([]byte, length))
+		size -= 1 + uvarintLen(uint64(length)) + length
+	}
+	for ; size > 0; size-- {
+		buf = append(buf, fieldPad1)
+	}
+	return buf
+}
+
+// DecodeDataMessage mengubah format biner menjadi DataMessage. Field yang tidak dikenal
+// dilewati agar versi yang sama bisa ditambah field baru; field ganda ditolak.
+func DecodeDataMessage(data []byte) (*DataMessage, error) {
+	if len(data) < 1 {
+		return nil, ErrMessageTruncated
+	}
+	if data[0] != DataMessageVersion {
+		return nil, fmt.Errorf("%w: %d", ErrMessageVersion, data[0])
+	}
+
+	msg := &DataMessage{}
+	var seen [256]bool
+	rest := data[1:]
+	for len(rest) > 0 {
+		fieldType := rest[0]
+		if fieldType == fieldPad1 {
+			msg.Padding++
+			rest = rest[1:]
+			continue
+		}
+		length, n := binary.Uvarint(rest[1:])
+		if n <= 0 {
+			return nil, ErrMessageTruncated
+		}
+		rest = rest[1+n:]
+		if length > uint64(len(rest)) {
+			return nil, ErrMessageTruncated
+		}
+		value := rest[:length]
+		rest = rest[length:]
+
+		if seen[fieldType] {
+			return nil, fmt.Errorf("field 0x%02x muncul lebih dari sekali", fieldType)
+		}
+		seen[fieldType] = true
+
+		var err error
+		switch fieldType {
+		case fieldSeq:
+			msg.Seq, err = decodeUvarintField(value)
+		case fieldAckRanges:
+			msg.Acks, err = decodeAckRanges(value)
+		case fieldReturnPorts:
+			msg.ReturnPorts, err = decodeReturnPorts(value)
+		case fieldMessage:
+			msg.Message = append([]byte(nil), value...)
+		case fieldForwardSeq:
+			msg.ForwardSeq, err = decodeUvarintField(value)
+		case fieldFragment:
+			msg.FragmentID, msg.FragmentOffset, msg.FragmentTotal, err = decodeFragmentField(value)
+		case fieldPadding:
+			msg.Padding += 1 + n + len(value)
+		case fieldFrames:
+			msg.Frames, err = decodeFrames(value)
+		case fieldAckOnly:
+			msg.AckOnly = true
+		case fieldRecvWindow:
+			msg.ReceiveWindow, err = decodeUvarintField(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field 0x%02x: %w", fieldType, err)
+		}
+	}
+	if !seen[fieldSeq] {
+		return nil, fmt.Errorf("field seq wajib tidak ada")
+	}
+	return msg, nil
+}
+
+// PacketSize mengembalikan ukuran datagram untuk msg setelah dienkripsi dan diberi header.
+func PacketSize(msg *DataMessage) int {
+	encoded, _ := EncodeDataMessage(msg)
+	return PacketOverhead + len(encoded)
+}
+
+// PadToSize mengisi msg.Padding sehingga datagramnya berukuran tepat size byte. Datagram
+// yang sudah lebih besar dari size tidak diberi padding.
+func PadToSize(msg *DataMessage, size int) {
+	msg.Padding = 0
+	msg.Padding = max(size-PacketSize(msg), 0)
+}
+
+func uvarintLen(v uint64) int {
+	return len(binary.AppendUvarint(nil, v))
+}
+
+func appendField(buf []byte, fieldType byte, value []byte) []byte {
+	buf = append(buf, fieldType)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+func appendUvarintField(buf []byte, fieldType byte, v uint64) []byte {
+	return appendField(buf, fieldType, binary.AppendUvarint(nil, v))
+}
+
+func decodeUvarintField(value []byte) (uint64, error) {
+	v, n := binary.Uvarint(value)
+	if n <= 0 || n != len(value) {
+		return 0, fmt.Errorf("uvarint tidak valid")
+	}
+	return v, nil
+}
+
+func decodeReturnPorts(value []byte) ([]uint16, error) {
+	if len(value) == 0 || len(value)%2 != 0 || len(value)/2 > MaxReturnPorts {
+		return nil, fmt.Errorf("panjang daftar port balasan salah: %d", len(value))
+	}
+	ports := make([]uint16, 0, len(value)/2)
+	for i := 0; i < len(value); i += 2 {
+		port := binary.BigEndian.Uint16(value[i:])
+		if port == 0 {
+			return nil, fmt.Errorf("port balasan nol")
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func decodeFragmentField(value []byte) (id, offset, total uint64, err error) {
+	var fields [3]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(value)
+		if n <= 0 {
+			return 0, 0, 0, fmt.Errorf("uvarint fragmen tidak valid")
+		}
+		fields[i] = v
+		value = value[n:]
+	}
+	if len(value) != 0 || fields[2] == 0 {
+		return 0, 0, 0, fmt.Errorf("field fragmen tidak valid")
+	}
+	return fields[0], fields[1], fields[2], nil
+}
+
+func encodeAckRanges(ranges []AckRange) []byte {
+	var buf []byte
+	for _, r := range ranges {
+		buf = binary.AppendUvarint(buf, r.Start)
+		buf = binary.AppendUvarint(buf, r.End-r.Start)
+	}
+	return buf
+}
+
+func decodeAckRanges(value []byte) ([]AckRange, error) {
+	var ranges []AckRange
+	for len(value) > 0 {
+		if len(ranges) == MaxAckRanges {
+			return nil, fmt.Errorf("terlalu banyak rentang SACK")
+		}
+		start, n := binary.Uvarint(value)
+		if n <= 0 {
+			return nil, fmt.Errorf("awal rentang SACK tidak valid")
+		}
+		value = value[n:]
+		length, n := binary.Uvarint(value)
+		if n <= 0 || start+length < start {
+			return nil, fmt.Errorf("panjang rentang SACK tidak valid")
+		}
+		value = value[n:]
+		ranges = append(ranges, AckRange{Start: start, End: start + length})
+	}
+	return ranges, nil
+}
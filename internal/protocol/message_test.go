@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// sampleMessages mengembalikan DataMessage yang memakai setiap field dan setiap tipe frame.
+func sampleMessages() []*DataMessage {
+	return []*DataMessage{
+		{Seq: 0},
+		{Seq: 1, Acks: []AckRange{{Start: 10, End: 12}, {Start: 0, End: 7}}, AckOnly: true, ReceiveWindow: DefaultReceiveWindow},
+		{Seq: 2, Message: []byte("halo"), ForwardSeq: 1, ReturnPorts: []uint16{40000, 40001}},
+		{Seq: 300, Message: []byte("fragmen"), FragmentID: 7, FragmentOffset: 1 << 20, FragmentTotal: 2 << 20},
+		{Seq: 1 << 40, Padding: 200},
+		{Seq: 6, Padding: 1},
+		{Seq: 7, Padding: 130},
+		{Seq: 5, Frames: []Frame{
+			{Type: FrameOpen, StreamID: 4},
+			{Type: FrameData, StreamID: 4, Offset: 1 << 16, Data: []byte("data stream")},
+			{Type: FrameClose, StreamID: 4, Offset: 99},
+			{Type: FrameReset, StreamID: 6, ErrorCode: 3},
+			{Type: FrameWindow, StreamID: 8, MaxData: 1 << 30},
+			{Type: FrameDatagram, Data: []byte("datagram")},
+			{Type: FrameConnectionClose, ErrorCode: 1},
+		}},
+	}
+}
+
+func TestDataMessageRoundTrip(t *testing.T) {
+	for _, msg := range sampleMessages() {
+		encoded, err := EncodeDataMessage(msg)
+		if err != nil {
+			t.Fatalf("EncodeDataMessage(#%d): %v", msg.Seq, err)
+		}
+		decoded, err := DecodeDataMessage(encoded)
+		if err != nil {
+			t.Fatalf("DecodeDataMessage(#%d): %v", msg.Seq, err)
+		}
+		if !reflect.DeepEqual(decoded, msg) {
+			t.Errorf("round-trip #%d berbeda:\n  dikirim  %+v\n  diterima %+v", msg.Seq, msg, decoded)
+		}
+	}
+}
+
+func TestDecodeDataMessageRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"kosong", nil},
+		{"versi salah", []byte{DataMessageVersion + 1, fieldSeq, 1, 0}},
+		{"tanpa seq", []byte{DataMessageVersion}},
+		{"seq ganda", []byte{DataMessageVersion, fieldSeq, 1, 0, fieldSeq, 1, 1}},
+		{"panjang melewati data", []byte{DataMessageVersion, fieldSeq, 5, 0}},
+		{"uvarint seq berlebih", []byte{DataMessageVersion, fieldSeq, 2, 0, 0}},
+		{"port balasan ganjil", []byte{DataMessageVersion, fieldSeq, 1, 0, fieldReturnPorts, 3, 1, 2, 3}},
+		{"port balasan nol", []byte{DataMessageVersion, fieldSeq, 1, 0, fieldReturnPorts, 2, 0, 0}},
+		{"total fragmen nol", []byte{DataMessageVersion, fieldSeq, 1, 0, fieldFragment, 3, 1, 0, 0}},
+		{"frame terpotong", []byte{DataMessageVersion, fieldSeq, 1, 0, fieldFrames, 2, byte(FrameData), 9}},
+	}
+	for _, tt := range tests {
+		if msg, err := DecodeDataMessage(tt.data); err == nil {
+			t.Errorf("%s: diterima sebagai %+v", tt.name, msg)
+		}
+	}
+}
+
+func TestPadToSizeExact(t *testing.T) {
+	targets := append(slices.Clone(DefaultPaddingBuckets), 1200, 1452, 16500)
+	for _, target := range targets {
+		for length := range 1400 {
+			msg := &DataMessage{Seq: 1 << 20, Message: make([]byte, length), Acks: []AckRange{{Start: 0, End: 1 << 20}}}
+			unpadded := PacketSize(msg)
+			PadToSize(msg, target)
+			got := PacketSize(msg)
+			if target >= unpadded && got != target {
+				t.Fatalf("pesan %d byte ke ukuran %d: paket %d byte (padding %d)", length, target, got, msg.Padding)
+			}
+			if target < unpadded && got != unpadded {
+				t.Fatalf("pesan %d byte melebihi ukuran %d tetapi diberi padding %d", length, target, msg.Padding)
+			}
+			encoded, err := EncodeDataMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := DecodeDataMessage(encoded)
+			if err != nil {
+				t.Fatalf("pesan %d byte ke ukuran %d: %v", length, target, err)
+			}
+			if decoded.Padding != msg.Padding {
+				t.Fatalf("pesan %d byte ke ukuran %d: padding diterima %d, dikirim %d", length, target, decoded.Padding, msg.Padding)
+			}
+		}
+	}
+}
+
+// FuzzDecodeDataMessage memastikan decoder tidak pernah panik dan setiap pesan yang diterima
+// di-encode ulang menjadi pesan yang sama.
+func FuzzDecodeDataMessage(f *testing.F) {
+	for _, msg := range sampleMessages() {
+		encoded, _ := EncodeDataMessage(msg)
+		f.Add(encoded)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := DecodeDataMessage(data)
+		if err != nil {
+			return
+		}
+		encoded, err := EncodeDataMessage(msg)
+		if err != nil {
+			t.Fatalf("EncodeDataMessage: %v", err)
+		}
+		again, err := DecodeDataMessage(encoded)
+		if err != nil {
+			t.Fatalf("hasil encode ulang ditolak: %v", err)
+		}
+		if !reflect.DeepEqual(again, msg) {
+			t.Fatalf("round-trip berbeda:\n  pertama %+v\n  kedua   %+v", msg, again)
+		}
+	})
+}
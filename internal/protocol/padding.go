@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+)
+
+// DefaultPaddingBuckets adalah ukuran datagram untuk mode padding "buckets" jika konfigurasi
+// tidak mengaturnya. Datagram yang lebih besar dari bucket terbesar diisi sampai MTU jalur.
+var DefaultPaddingBuckets = []int{128, 256, 512, 1024}
+
+// PaddingPolicy menentukan ukuran akhir setiap datagram data. Padding ditambahkan sebagai
+// field di dalam DataMessage sehingga ikut dienkripsi dan diautentikasi AEAD; pengamat hanya
+// melihat ukuran yang sudah dibulatkan, bukan ukuran pesan atau ketikan aslinya.
+type PaddingPolicy interface {
+	// Target mengembalikan ukuran datagram untuk paket berukuran size saat MTU jalur mtu.
+	// Nilai yang lebih kecil dari size berarti tanpa padding.
+	Target(size, mtu int) int
+}
+
+// NewPaddingPolicy membuat PaddingPolicy dari nama mode di konfigurasi:
+//
+//   - "none" atau kosong: tanpa padding
+//   - "buckets": dibulatkan ke bucket terkecil yang muat, atau MTU jika tidak ada
+//   - "mtu": selalu diisi sampai MTU jalur
+//   - "random": ditambah antara min dan max byte secara acak, dibatasi MTU
+func NewPaddingPolicy(mode string, buckets []int, min, max int) (PaddingPolicy, error) {
+	switch mode {
+	case "", "none":
+		return nil, nil
+	case "buckets":
+		if len(buckets) == 0 {
+			buckets = DefaultPaddingBuckets
+		}
+		sorted := slices.Sorted(slices.Values(buckets))
+		if sorted[0] <= PacketOverhead {
+			return nil, fmt.Errorf("bucket padding %d lebih kecil dari overhead paket", sorted[0])
+		}
+		return bucketPadding(sorted), nil
+	case "mtu":
+		return mtuPadding{}, nil
+	case "random":
+		if min < 0 || max < min {
+			return nil, fmt.Errorf("rentang padding acak tidak valid: %d-%d", min, max)
+		}
+		return randomPadding{min: min, max: max}, nil
+	default:
+		return nil, fmt.Errorf("mode padding tidak dikenal: %q", mode)
+	}
+}
+
+// bucketPadding membulatkan datagram ke bucket terkecil yang muat. Bucket terurut naik.
+type bucketPadding []int
+
+func (b bucketPadding) Target(size, mtu int) int {
+	for _, bucket := range b {
+		if bucket >= size {
+			return min(bucket, mtu)
+		}
+	}
+	return mtu
+}
+
+// mtuPadding mengisi setiap datagram sampai MTU jalur.
+type mtuPadding struct{}
+
+func (mtuPadding) Target(size, mtu int) int {
+	return mtu
+}
+
+// randomPadding menambahkan sejumlah byte acak antara min dan max.
+type randomPadding struct {
+	min, max int
+}
+
+func (r randomPadding) Target(size, mtu int) int {
+	return min(size+r.min+rand.IntN(r.max-r.min+1), mtu)
+}
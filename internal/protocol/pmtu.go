@@ -0,0 +1,151 @@
+package protocol
+
+import "time"
+
+const (
+	// BasePLPMTU adalah ukuran datagram yang diasumsikan selalu lolos (RFC 8899 BASE_PLPMTU
+	// untuk UDP). Sesi dimulai dan kembali ke ukuran ini saat terjadi black hole.
+	BasePLPMTU = 1200
+	// MaxPLPMTU adalah ukuran datagram terbesar yang dicoba: MTU Ethernet dikurangi header
+	// IPv4, UDP, dan salt penyamaran datagram.
+	MaxPLPMTU = 1500 - 20 - 8 - MaskSaltSize
+	// MaxProbes adalah jumlah probe yang boleh hilang untuk satu ukuran sebelum ukuran itu
+	// dianggap tidak lolos (RFC 8899 MAX_PROBES).
+	MaxProbes = 3
+	// PMTURaiseInterval adalah jeda sebelum pencarian diulang untuk mendeteksi MTU yang naik
+	// (RFC 8899 PMTU_RAISE_TIMER).
+	PMTURaiseInterval = 10 * time.Minute
+	// pmtuSearchGranularity adalah selisih terkecil antara ukuran lolos dan gagal yang masih
+	// dicari.
+	pmtuSearchGranularity = 16
+)
+
+// PMTUProber menjalankan Datagram Packetization Layer PMTU Discovery (RFC 8899) untuk satu
+// sesi. Probe adalah paket data bernomor urut yang diberi padding hingga ukuran yang diuji
+// dan tidak pernah dikirim ulang; ACK untuk probe mengonfirmasi ukurannya. Pencarian
+// dilakukan secara biner antara PLPMTU yang sudah dikonfirmasi dan ukuran terkecil yang gagal.
+type PMTUProber struct {
+	mtu    int // PLPMTU yang sudah dikonfirmasi
+	failed int // Ukuran terkecil yang diketahui tidak lolos
+
+	probing    bool
+	probeSeq   uint64
+	probeSize  int
+	probeSent  time.Time
+	probeCount int // Probe yang sudah hilang untuk probeSize
+
+	complete    bool
+	completedAt time.Time
+	blackHole   int // Paket data berukuran di atas BasePLPMTU yang hilang berturut-turut
+}
+
+// NewPMTUProber membuat prober yang dimulai dari BasePLPMTU.
+func NewPMTUProber() *PMTUProber {
+	return &PMTUProber{mtu: BasePLPMTU, failed: MaxPLPMTU + 1}
+}
+
+// MTU mengembalikan ukuran datagram terbesar yang sudah terbukti lolos.
+func (p *PMTUProber) MTU() int {
+	return p.mtu
+}
+
+// NextProbe mengembalikan ukuran probe berikutnya jika saatnya mengirim probe.
+func (p *PMTUProber) NextProbe(now time.Time) (int, bool) {
+	if p.probing {
+		return 0, false
+	}
+	if p.complete {
+		if now.Sub(p.completedAt) < PMTURaiseInterval {
+			return 0, false
+		}
+		p.complete = false
+		p.failed = MaxPLPMTU + 1
+	}
+	if p.probeCount > 0 {
+		return p.probeSize, true // Ulangi ukuran yang probe-nya hilang
+	}
+	if p.failed-p.mtu <= pmtuSearchGranularity {
+		p.complete = true
+		p.completedAt = now
+		return 0, false
+	}
+	return (p.mtu + p.failed) / 2, true
+}
+
+// OnProbeSent mencatat probe berukuran size yang dikirim dengan nomor urut seq.
+func (p *PMTUProber) OnProbeSent(seq uint64, size int, now time.Time) {
+	p.probing = true
+	p.probeSeq = seq
+	p.probeSize = size
+	p.probeSent = now
+}
+
+// OnProbeTooBig dipanggil jika sistem operasi menolak mengirim probe berukuran size karena
+// melebihi MTU antarmuka lokal. Ukuran itu langsung dianggap gagal.
+func (p *PMTUProber) OnProbeTooBig(size int) {
+	p.failed = min(p.failed, size)
+	p.probeCount = 0
+}
+
+// Outstanding mengembalikan nomor urut probe yang masih ditunggu ACK-nya.
+func (p *PMTUProber) Outstanding() (uint64, bool) {
+	return p.probeSeq, p.probing
+}
+
+// OnAck memproses rentang SACK dari peer. Mengembalikan true jika PLPMTU naik.
+func (p *PMTUProber) OnAck(ranges []AckRange) bool {
+	if !p.probing {
+		return false
+	}
+	for _, r := range ranges {
+		if r.Contains(p.probeSeq) {
+			p.probing = false
+			p.probeCount = 0
+			p.mtu = max(p.mtu, p.probeSize)
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTimeout menganggap probe hilang jika belum di-ACK setelah timeout. Mengembalikan
+// true jika probe baru saja dinyatakan hilang, sehingga pemanggil perlu memberi tahu peer
+// untuk melompati nomor urutnya.
+func (p *PMTUProber) CheckTimeout(now time.Time, timeout time.Duration) bool {
+	if !p.probing || now.Sub(p.probeSent) < timeout {
+		return false
+	}
+	p.probing = false
+	p.probeCount++
+	if p.probeCount >= MaxProbes {
+		p.failed = min(p.failed, p.probeSize)
+		p.probeCount = 0
+	}
+	return true
+}
+
+// OnPacketAcked mengatur ulang detektor black hole setelah paket data di-ACK.
+func (p *PMTUProber) OnPacketAcked() {
+	p.blackHole = 0
+}
+
+// OnPacketLost mencatat paket data berukuran size yang RTO-nya habis. Jika MaxProbes paket
+// besar hilang berturut-turut, jalur dianggap black hole: PLPMTU kembali ke BasePLPMTU dan
+// pencarian dimulai ulang. Mengembalikan true jika PLPMTU turun; pemanggil lalu harus
+// mengirim ulang isi paket yang lebih besar dari PLPMTU baru dalam paket yang lebih kecil.
+func (p *PMTUProber) OnPacketLost(size int) bool {
+	if size <= BasePLPMTU || p.mtu == BasePLPMTU {
+		return false
+	}
+	p.blackHole++
+	if p.blackHole < MaxProbes {
+		return false
+	}
+	p.failed = p.mtu
+	p.mtu = BasePLPMTU
+	p.probing = false
+	p.probeCount = 0
+	p.complete = false
+	p.blackHole = 0
+	return true
+}
@@ -3,24 +3,120 @@ package protocol
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"io"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"lukechampine.com/blake3"
 )
 
 const (
 	ProtocolVersion  = 1
 	HandshakeMsgType = 0x01
 	DataMsgType      = 0x02
+	RetryMsgType     = 0x03
 	HashSize         = 32 // BLAKE3-256
+	NonceSize        = 12 // Nonce ChaCha20-Poly1305
+	ConnIDSize       = 8
+)
+
+// ConnID adalah connection ID yang dibawa setiap paket data. Nilainya berganti untuk
+// setiap nomor urut sehingga pengamat tidak bisa mengaitkan paket di port yang berbeda,
+// tetapi penerima yang tahu kuncinya bisa menemukan sesi dengan satu lookup map.
+type ConnID [ConnIDSize]byte
+
+// DeriveConnID menghitung connection ID untuk nomor urut seq dengan BLAKE3 berkunci.
+func DeriveConnID(key [HashSize]byte, seq uint64) ConnID {
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], seq)
+	h := blake3.New(ConnIDSize, key[:])
+	h.Write(seqBytes[:])
+
+	var id ConnID
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// ConnIDWindow menyimpan connection ID yang valid untuk satu rentang nomor urut, sehingga
+// penerima bisa memetakan connection ID kembali ke nomor urutnya tanpa menghitung ulang.
+type ConnIDWindow struct {
+	key       [HashSize]byte
+	low, high uint64 // Rentang nomor urut yang ID-nya sedang disimpan
+	ids       map[uint64]ConnID
+	seqs      map[ConnID]uint64
+}
+
+// NewConnIDWindow membuat jendela kosong untuk kunci connection ID key.
+func NewConnIDWindow(key [HashSize]byte) *ConnIDWindow {
+	return &ConnIDWindow{
+		key:  key,
+		ids:  make(map[uint64]ConnID),
+		seqs: make(map[ConnID]uint64),
+	}
+}
+
+// Slide menggeser jendela ke rentang [low, high) dan mengembalikan ID yang baru
+// ditambahkan serta ID yang dihapus. Rentang hanya boleh bergeser maju; hanya nomor urut yang
+// keluar atau masuk rentang yang disentuh, sehingga biayanya tidak bergantung pada lebar jendela.
+func (w *ConnIDWindow) Slide(low, high uint64) (added, removed []ConnID) {
+	for seq := w.low; seq < min(low, w.high); seq++ {
+		id := w.ids[seq]
+		delete(w.ids, seq)
+		delete(w.seqs, id)
+		removed = append(removed, id)
+	}
+	for seq := max(low, w.high); seq < high; seq++ {
+		id := DeriveConnID(w.key, seq)
+		w.ids[seq] = id
+		w.seqs[id] = seq
+		added = append(added, id)
+	}
+	w.low, w.high = low, max(high, w.high)
+	return added, removed
+}
+
+// Lookup mengembalikan nomor urut untuk connection ID jika ID tersebut ada di jendela.
+func (w *ConnIDWindow) Lookup(id ConnID) (uint64, bool) {
+	seq, ok := w.seqs[id]
+	return seq, ok
+}
+
+// IDs mengembalikan semua connection ID di jendela.
+func (w *ConnIDWindow) IDs() []ConnID {
+	out := make([]ConnID, 0, len(w.seqs))
+	for id := range w.seqs {
+		out = append(out, id)
+	}
+	return out
+}
+
+// ConnIDRange mengembalikan rentang nomor urut yang connection ID-nya harus dikenali
+// penerima dengan jendela penerimaan sebesar size: paket lama yang mungkin dikirim ulang dan
+// paket di dalam jendela reorder.
+func ConnIDRange(next uint64, size int) (low, high uint64) {
+	if next > uint64(size) {
+		low = next - uint64(size)
+	}
+	return low, next + uint64(size)
+}
+
+const (
+	// PacketHeaderSize adalah ukuran PacketHeader yang diserialisasi.
+	PacketHeaderSize = 1 + 1 + 2 + 2 + ConnIDSize + HashSize
+	// PacketOverhead adalah jumlah byte di luar DataMessage terenkripsi: header, nonce,
+	// dan tag AEAD.
+	PacketOverhead = PacketHeaderSize + NonceSize + crypto.AEADOverhead
 )
 
-// PacketHeader adalah header tingkat rendah untuk setiap paket UDP.
+// PacketHeader adalah header tingkat rendah untuk setiap paket UDP. Di jalur, seluruh
+// datagram termasuk header ini disamarkan MaskedConn, dan PrevHash paket data juga
+// disamarkan dengan kunci header-protection sesi.
 type PacketHeader struct {
 	Version   uint8
 	Type      uint8
 	NonceSize uint16
 	Length    uint16 // Panjang dari sisa paket (Nonce + Payload)
+	ConnID    ConnID // Nol untuk paket handshake
 	PrevHash  [HashSize]byte
 }
 
@@ -31,17 +127,6 @@ type SecurePacket struct {
 	Payload []byte // Payload yang sudah dienkripsi
 }
 
-// DataMessage adalah struktur data aplikasi yang sebenarnya.
-// Struktur ini akan diserialisasi (misalnya ke JSON) dan kemudian dienkripsi.
-type DataMessage struct {
-	SessionID  string `json:"session_id"`
-	Message    []byte `json:"message"`
-	NextPort   uint16 `json:"next_port"`
-	Seq        uint64 `json:"seq"`        // Nomor urut paket ini
-	AckSeq     uint64 `json:"ack_seq"`    // ACK untuk nomor urut paket yang diterima
-	ReturnAddr string `json:"return_addr"` // Alamat untuk mengirim balasan/ACK
-}
-
 // Serialize mengubah SecurePacket menjadi byte slice untuk dikirim.
 func (p *SecurePacket) Serialize() ([]byte, error) {
 	buf := new(bytes.Buffer)
@@ -100,15 +185,3 @@ func Deserialize(data []byte) (*SecurePacket, error) {
 		Payload: payload,
 	}, nil
 }
-
-// EncodeDataMessage mengubah struct DataMessage menjadi JSON.
-func EncodeDataMessage(msg *DataMessage) ([]byte, error) {
-	return json.Marshal(msg)
-}
-
-// DecodeDataMessage mengubah JSON menjadi struct DataMessage.
-func DecodeDataMessage(data []byte) (*DataMessage, error) {
-	var msg DataMessage
-	err := json.Unmarshal(data, &msg)
-	return &msg, err
-}
\ No newline at end of file
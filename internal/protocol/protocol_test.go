@@ -0,0 +1,55 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func samplePackets() []*SecurePacket {
+	return []*SecurePacket{
+		{Header: PacketHeader{Version: ProtocolVersion, Type: HandshakeMsgType}, Payload: []byte("hello")},
+		{
+			Header:  PacketHeader{Version: ProtocolVersion, Type: DataMsgType, ConnID: ConnID{1, 2, 3}, PrevHash: [HashSize]byte{9}},
+			Nonce:   make([]byte, NonceSize),
+			Payload: bytes.Repeat([]byte{0xaa}, 64),
+		},
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	for _, packet := range samplePackets() {
+		data, err := packet.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Deserialize(data)
+		if err != nil {
+			t.Fatalf("Deserialize: %v", err)
+		}
+		if got.Header != packet.Header || !bytes.Equal(got.Nonce, packet.Nonce) || !bytes.Equal(got.Payload, packet.Payload) {
+			t.Errorf("round-trip berbeda: %+v, diharapkan %+v", got, packet)
+		}
+	}
+}
+
+// FuzzDeserialize memastikan Deserialize tidak pernah panik dan setiap paket yang diterima
+// diserialisasi ulang menjadi byte yang sama persis.
+func FuzzDeserialize(f *testing.F) {
+	for _, packet := range samplePackets() {
+		data, _ := packet.Serialize()
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err := Deserialize(data)
+		if err != nil {
+			return
+		}
+		again, err := packet.Serialize()
+		if err != nil {
+			t.Fatalf("Serialize: %v", err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Fatalf("serialisasi ulang berbeda:\n  %x\n  %x", data, again)
+		}
+	})
+}
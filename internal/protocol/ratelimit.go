@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLimiterEntries membatasi jumlah alamat yang diingat RateLimiter dan
+	// AmplificationLimiter, sehingga banjir paket dari alamat palsu tidak menghabiskan memori.
+	maxLimiterEntries = 1 << 16
+	// limiterPruneInterval adalah jarak minimum antara dua pembersihan entri lama.
+	limiterPruneInterval = 10 * time.Second
+	// amplificationIdle adalah lama entri AmplificationLimiter diingat sejak paket terakhir.
+	amplificationIdle = 30 * time.Second
+)
+
+// tokenBucket adalah token bucket dengan kapasitas satu detik laju.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill menambahkan token sesuai laju sejak pengisian terakhir sampai now.
+func (b *tokenBucket) refill(rate float64, now time.Time) {
+	b.tokens = min(max(rate, 1), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+}
+
+// full melaporkan apakah bucket sudah terisi penuh pada now, sehingga aman dilupakan.
+func (b *tokenBucket) full(rate float64, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= max(rate, 1)
+}
+
+// RateLimiter membatasi laju paket dengan token bucket per IP sumber dan per subnet. Paket
+// hanya diterima jika bucket IP dan bucket subnetnya sama-sama masih memiliki token.
+type RateLimiter struct {
+	ipRate     float64 // Negatif berarti tanpa batas
+	subnetRate float64
+	ipv4Mask   net.IPMask
+	ipv6Mask   net.IPMask
+
+	mu        sync.Mutex
+	ips       map[string]*tokenBucket
+	subnets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+// NewRateLimiter membuat RateLimiter dengan laju ipRate paket per detik per IP dan
+// subnetRate per subnet, yaitu alamat yang sama pada ipv4Prefix atau ipv6Prefix bit
+// pertamanya. Laju negatif berarti tanpa batas.
+func NewRateLimiter(ipRate, subnetRate float64, ipv4Prefix, ipv6Prefix int) *RateLimiter {
+	return &RateLimiter{
+		ipRate:     ipRate,
+		subnetRate: subnetRate,
+		ipv4Mask:   net.CIDRMask(ipv4Prefix, 32),
+		ipv6Mask:   net.CIDRMask(ipv6Prefix, 128),
+		ips:        make(map[string]*tokenBucket),
+		subnets:    make(map[string]*tokenBucket),
+	}
+}
+
+// Allow mengambil satu token untuk paket dari ip pada waktu now dan melaporkan apakah paket
+// boleh diproses.
+func (l *RateLimiter) Allow(ip net.IP, now time.Time) bool {
+	if l.ipRate < 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPrune) > limiterPruneInterval {
+		l.prune(now)
+	}
+	ipBucket := l.bucket(l.ips, string(ip.To16()), l.ipRate, now)
+	subnetBucket := l.bucket(l.subnets, l.subnet(ip), l.subnetRate, now)
+	if ipBucket == nil || subnetBucket == nil {
+		return false
+	}
+	ipBucket.refill(l.ipRate, now)
+	subnetBucket.refill(l.subnetRate, now)
+	// Token hanya diambil jika kedua bucket masih berisi, agar satu IP yang sudah dibatasi
+	// tidak ikut menghabiskan jatah tetangga di subnetnya
+	if ipBucket.tokens < 1 || subnetBucket.tokens < 1 {
+		return false
+	}
+	ipBucket.tokens--
+	subnetBucket.tokens--
+	return true
+}
+
+// subnet mengembalikan kunci subnet untuk ip.
+func (l *RateLimiter) subnet(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return string(ip4.Mask(l.ipv4Mask))
+	}
+	return string(ip.To16().Mask(l.ipv6Mask))
+}
+
+// bucket mengembalikan bucket untuk key, atau membuat bucket penuh untuk laju rate jika
+// belum ada. Nil dikembalikan jika tabel sudah penuh. Dipanggil dengan l.mu dipegang.
+func (l *RateLimiter) bucket(buckets map[string]*tokenBucket, key string, rate float64, now time.Time) *tokenBucket {
+	if b, ok := buckets[key]; ok {
+		return b
+	}
+	if len(buckets) >= maxLimiterEntries {
+		l.prune(now)
+		if len(buckets) >= maxLimiterEntries {
+			return nil
+		}
+	}
+	b := &tokenBucket{tokens: max(rate, 1), last: now}
+	buckets[key] = b
+	return b
+}
+
+// prune menghapus bucket yang sudah penuh kembali, karena bucket baru akan sama saja.
+// Dipanggil dengan l.mu dipegang.
+func (l *RateLimiter) prune(now time.Time) {
+	l.lastPrune = now
+	for key, b := range l.ips {
+		if b.full(l.ipRate, now) {
+			delete(l.ips, key)
+		}
+	}
+	for key, b := range l.subnets {
+		if b.full(l.subnetRate, now) {
+			delete(l.subnets, key)
+		}
+	}
+}
+
+// amplificationEntry menghitung byte dari dan ke satu alamat yang belum tervalidasi.
+type amplificationEntry struct {
+	received int
+	sent     int
+	last     time.Time
+}
+
+// AmplificationLimiter memastikan server tidak pernah mengirim lebih dari factor kali byte
+// yang diterimanya dari alamat yang belum tervalidasi, seperti batas anti-amplifikasi QUIC.
+// Alamat yang sudah membuktikan kepemilikannya tidak perlu dicatat di sini.
+type AmplificationLimiter struct {
+	factor float64
+
+	mu        sync.Mutex
+	entries   map[string]*amplificationEntry
+	lastPrune time.Time
+}
+
+// NewAmplificationLimiter membuat AmplificationLimiter dengan rasio kirim/terima factor.
+func NewAmplificationLimiter(factor float64) *AmplificationLimiter {
+	return &AmplificationLimiter{factor: factor, entries: make(map[string]*amplificationEntry)}
+}
+
+// Received mencatat n byte yang diterima dari IP addr pada waktu now.
+func (l *AmplificationLimiter) Received(addr *net.UDPAddr, n int, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry := l.entry(addr, now); entry != nil {
+		entry.received += n
+		entry.last = now
+	}
+}
+
+// Send melaporkan apakah n byte boleh dikirim ke IP addr dan, jika boleh, mencatatnya.
+func (l *AmplificationLimiter) Send(addr *net.UDPAddr, n int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := l.entry(addr, now)
+	if entry == nil || float64(entry.sent+n) > l.factor*float64(entry.received) {
+		return false
+	}
+	entry.sent += n
+	return true
+}
+
+// entry mengembalikan entri untuk addr, atau nil jika tabel penuh. Dipanggil dengan l.mu
+// dipegang.
+func (l *AmplificationLimiter) entry(addr *net.UDPAddr, now time.Time) *amplificationEntry {
+	if now.Sub(l.lastPrune) > limiterPruneInterval {
+		l.lastPrune = now
+		for key, entry := range l.entries {
+			if now.Sub(entry.last) > amplificationIdle {
+				delete(l.entries, key)
+			}
+		}
+	}
+	// Dihitung per IP, karena penyerang bisa memalsukan port sumber apa pun
+	key := string(addr.IP.To16())
+	if entry, ok := l.entries[key]; ok {
+		return entry
+	}
+	if len(l.entries) >= maxLimiterEntries {
+		return nil
+	}
+	entry := &amplificationEntry{last: now}
+	l.entries[key] = entry
+	return entry
+}
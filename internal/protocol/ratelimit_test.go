@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// allowed mengembalikan berapa dari n paket dari ip pada waktu now yang diterima l.
+func allowed(l *RateLimiter, ip net.IP, n int, now time.Time) int {
+	count := 0
+	for range n {
+		if l.Allow(ip, now) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRateLimiterPerIP(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewRateLimiter(5, 100, 24, 64)
+	ip := net.IPv4(192, 0, 2, 1)
+	if got := allowed(l, ip, 10, now); got != 5 {
+		t.Fatalf("%d paket diterima dalam satu burst, diharapkan 5", got)
+	}
+	if got := allowed(l, ip, 10, now.Add(400*time.Millisecond)); got != 2 {
+		t.Errorf("%d paket diterima setelah 400ms, diharapkan 2", got)
+	}
+	if got := allowed(l, net.IPv4(192, 0, 2, 2), 10, now); got != 5 {
+		t.Errorf("IP tetangga mendapat %d token, diharapkan 5", got)
+	}
+	// Bucket tidak pernah melebihi kapasitas satu detik walaupun lama diam
+	if got := allowed(l, ip, 10, now.Add(time.Hour)); got != 5 {
+		t.Errorf("%d paket diterima setelah lama diam, diharapkan 5", got)
+	}
+}
+
+func TestRateLimiterPerSubnet(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name     string
+		ips      []net.IP
+		accepted int
+	}{
+		{"satu /24", []net.IP{net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2), net.IPv4(192, 0, 2, 3)}, 8},
+		{"/24 berbeda", []net.IP{net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 3, 1), net.IPv4(192, 0, 4, 1)}, 12},
+		{"satu /64", []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::3")}, 8},
+		{"/64 berbeda", []net.IP{net.ParseIP("2001:db8:0:1::1"), net.ParseIP("2001:db8:0:2::1"), net.ParseIP("2001:db8:0:3::1")}, 12},
+	}
+	for _, tt := range tests {
+		l := NewRateLimiter(4, 8, 24, 64)
+		got := 0
+		for _, ip := range tt.ips {
+			got += allowed(l, ip, 10, now)
+		}
+		if got != tt.accepted {
+			t.Errorf("%s: %d paket diterima, diharapkan %d", tt.name, got, tt.accepted)
+		}
+	}
+}
+
+func TestRateLimiterUnlimitedAndFull(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	if got := allowed(NewRateLimiter(-1, -1, 24, 64), net.IPv4(192, 0, 2, 1), 1000, now); got != 1000 {
+		t.Errorf("laju negatif menerima %d dari 1000 paket", got)
+	}
+
+	// Tabel yang penuh menolak alamat baru sampai bucket lama terisi kembali
+	l := NewRateLimiter(1, 1, 32, 128)
+	for i := range maxLimiterEntries {
+		l.Allow(net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)), now)
+	}
+	if l.Allow(net.IPv4(192, 0, 2, 1), now) {
+		t.Error("alamat baru diterima saat tabel penuh")
+	}
+	if !l.Allow(net.IPv4(192, 0, 2, 1), now.Add(2*time.Second)) {
+		t.Error("alamat baru ditolak setelah bucket lama dibersihkan")
+	}
+}
+
+func TestAmplificationLimiter(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewAmplificationLimiter(3)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}
+	if l.Send(addr, 1, now) {
+		t.Fatal("balasan diizinkan ke alamat yang belum mengirim apa pun")
+	}
+	l.Received(addr, 100, now)
+	steps := []struct {
+		n    int
+		sent bool
+	}{
+		{200, true},
+		{101, false}, // Total 301 > 3 × 100
+		{100, true},
+		{1, false},
+	}
+	for i, step := range steps {
+		if got := l.Send(addr, step.n, now); got != step.sent {
+			t.Errorf("langkah %d: Send(%d) = %v, diharapkan %v", i, step.n, got, step.sent)
+		}
+	}
+	// Port sumber lain dari IP yang sama berbagi kuota
+	if l.Send(&net.UDPAddr{IP: addr.IP, Port: 40001}, 1, now) {
+		t.Error("port sumber lain mendapat kuota sendiri")
+	}
+	// Entri yang lama diam dilupakan
+	later := now.Add(amplificationIdle + limiterPruneInterval + time.Second)
+	l.Send(addr, 1, later)
+	if entry := l.entries[string(addr.IP.To16())]; entry == nil || entry.sent != 0 || entry.received != 0 {
+		t.Errorf("entri lama tidak dilupakan: %+v", entry)
+	}
+}
@@ -0,0 +1,206 @@
+package protocol
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Parameter estimasi RTO mengikuti RFC 6298, dengan batas bawah yang lebih rendah
+// karena SecureFlow memakai ACK eksplisit untuk setiap paket.
+const (
+	InitialRTO       = 1 * time.Second
+	MinRTO           = 200 * time.Millisecond
+	MaxRTO           = 60 * time.Second
+	MaxRetransmits   = 8
+	rttAlpha         = 0.125
+	rttBeta          = 0.25
+	rttVarMultiplier = 4
+	clockGranularity = time.Millisecond
+)
+
+// ErrMaxRetransmits dikembalikan jika sebuah paket tidak di-ACK setelah MaxRetransmits kali kirim ulang.
+var ErrMaxRetransmits = errors.New("batas retransmisi terlampaui")
+
+// RTTEstimator menghitung SRTT, RTTVAR, dan RTO sesuai RFC 6298.
+type RTTEstimator struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	rto     time.Duration
+	sampled bool
+}
+
+// Update memasukkan satu sampel RTT dari paket yang tidak pernah dikirim ulang (algoritma Karn).
+func (e *RTTEstimator) Update(sample time.Duration) {
+	if !e.sampled {
+		e.srtt = sample
+		e.rttvar = sample / 2
+		e.sampled = true
+	} else {
+		diff := e.srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		e.rttvar = time.Duration((1-rttBeta)*float64(e.rttvar) + rttBeta*float64(diff))
+		e.srtt = time.Duration((1-rttAlpha)*float64(e.srtt) + rttAlpha*float64(sample))
+	}
+	e.rto = e.srtt + max(clockGranularity, rttVarMultiplier*e.rttvar)
+	e.rto = min(max(e.rto, MinRTO), MaxRTO)
+}
+
+// SRTT mengembalikan smoothed RTT, atau nol jika belum ada sampel.
+func (e *RTTEstimator) SRTT() time.Duration {
+	return e.srtt
+}
+
+// RTO mengembalikan retransmission timeout saat ini.
+func (e *RTTEstimator) RTO() time.Duration {
+	if !e.sampled {
+		return InitialRTO
+	}
+	return e.rto
+}
+
+// PendingPacket adalah paket terkirim yang masih menunggu ACK.
+type PendingPacket struct {
+	Seq       uint64
+	Packet    []byte
+	FirstSent time.Time
+	LastSent  time.Time
+	Retries   int
+}
+
+// RetransmitQueue menyimpan paket yang belum di-ACK, memprosesnya dengan rentang SACK,
+// dan menentukan kapan paket harus dikirim ulang dengan exponential backoff. Setiap
+// pengiriman, ACK, dan loss juga diteruskan ke congestion controller.
+type RetransmitQueue struct {
+	RTT        RTTEstimator
+	Congestion CongestionController
+	pending    map[uint64]*PendingPacket
+	inFlight   int
+}
+
+// NewRetransmitQueue membuat antrean retransmisi kosong yang memberi makan cc.
+func NewRetransmitQueue(cc CongestionController) *RetransmitQueue {
+	return &RetransmitQueue{Congestion: cc, pending: make(map[uint64]*PendingPacket)}
+}
+
+// Add mencatat paket yang baru dikirim.
+func (q *RetransmitQueue) Add(seq uint64, packet []byte, now time.Time) {
+	q.Congestion.OnPacketSent(now, seq, len(packet), q.inFlight)
+	q.inFlight += len(packet)
+	q.pending[seq] = &PendingPacket{
+		Seq:       seq,
+		Packet:    packet,
+		FirstSent: now,
+		LastSent:  now,
+	}
+}
+
+// Remove menghapus paket dari antrean tanpa menganggapnya di-ACK.
+func (q *RetransmitQueue) Remove(seq uint64) {
+	if p, ok := q.pending[seq]; ok {
+		q.inFlight -= len(p.Packet)
+		delete(q.pending, seq)
+	}
+}
+
+// Len mengembalikan jumlah paket yang menunggu ACK.
+func (q *RetransmitQueue) Len() int {
+	return len(q.pending)
+}
+
+// OnAck menghapus semua paket yang tercakup rentang SACK dan mengembalikannya.
+// Sampel RTT hanya diambil dari paket yang belum pernah dikirim ulang.
+func (q *RetransmitQueue) OnAck(ranges []AckRange, now time.Time) []*PendingPacket {
+	var acked []*PendingPacket
+	for seq, p := range q.pending {
+		for _, r := range ranges {
+			if r.Contains(seq) {
+				acked = append(acked, p)
+				delete(q.pending, seq)
+				q.inFlight -= len(p.Packet)
+				var rtt time.Duration
+				if p.Retries == 0 {
+					rtt = now.Sub(p.FirstSent)
+					q.RTT.Update(rtt)
+				}
+				q.Congestion.OnAck(now, seq, len(p.Packet), rtt, q.inFlight)
+				break
+			}
+		}
+	}
+	return acked
+}
+
+// Due mengembalikan paket yang RTO-nya sudah habis dan mencatatnya sebagai dikirim ulang.
+// RTO setiap paket dikalikan dua untuk setiap retransmisi sebelumnya (exponential backoff).
+// ErrMaxRetransmits dikembalikan tanpa mengubah antrean jika ada paket yang melewati
+// MaxRetransmits.
+func (q *RetransmitQueue) Due(now time.Time) ([]*PendingPacket, error) {
+	var due []*PendingPacket
+	for _, p := range q.pending {
+		timeout := min(q.RTT.RTO()<<p.Retries, MaxRTO)
+		if now.Sub(p.LastSent) < timeout {
+			continue
+		}
+		if p.Retries >= MaxRetransmits {
+			return nil, ErrMaxRetransmits
+		}
+		due = append(due, p)
+	}
+	for _, p := range due {
+		q.Congestion.OnLoss(now, p.Seq, len(p.Packet), p.LastSent)
+		p.Retries++
+		p.LastSent = now
+	}
+	return due, nil
+}
+
+// Oversized mengembalikan paket yang lebih besar dari mtu, urut menurut nomor urut.
+func (q *RetransmitQueue) Oversized(mtu int) []*PendingPacket {
+	var oversized []*PendingPacket
+	for _, p := range q.pending {
+		if len(p.Packet) > mtu {
+			oversized = append(oversized, p)
+		}
+	}
+	slices.SortFunc(oversized, func(a, b *PendingPacket) int { return cmp.Compare(a.Seq, b.Seq) })
+	return oversized
+}
+
+// Oldest mengembalikan nomor urut terkecil yang belum di-ACK.
+func (q *RetransmitQueue) Oldest() (uint64, bool) {
+	var oldest uint64
+	found := false
+	for seq := range q.pending {
+		if !found || seq < oldest {
+			oldest, found = seq, true
+		}
+	}
+	return oldest, found
+}
+
+// BytesInFlight mengembalikan jumlah byte yang terkirim tetapi belum di-ACK.
+func (q *RetransmitQueue) BytesInFlight() int {
+	return q.inFlight
+}
+
+// CanSend mengembalikan true jika congestion controller mengizinkan paket baru.
+func (q *RetransmitQueue) CanSend() bool {
+	return q.Congestion.CanSend(q.inFlight)
+}
+
+// Stats mengembalikan estimasi cwnd, RTT, dan bandwidth untuk sesi ini. MTU diisi pemanggil.
+func (q *RetransmitQueue) Stats() SessionStats {
+	return SessionStats{
+		Algorithm:        q.Congestion.Name(),
+		CongestionWindow: q.Congestion.CongestionWindow(),
+		BytesInFlight:    q.inFlight,
+		SRTT:             q.RTT.SRTT(),
+		RTO:              q.RTT.RTO(),
+		Bandwidth:        q.Congestion.BandwidthEstimate(),
+		PacingRate:       q.Congestion.PacingRate(),
+	}
+}
@@ -0,0 +1,132 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	var e RTTEstimator
+	if e.RTO() != InitialRTO {
+		t.Fatalf("RTO tanpa sampel %v, diharapkan %v", e.RTO(), InitialRTO)
+	}
+	tests := []struct {
+		sample   time.Duration
+		srtt     time.Duration
+		rto      time.Duration
+		describe string
+	}{
+		// RFC 6298 2.2: SRTT = R, RTTVAR = R/2, RTO = SRTT + 4·RTTVAR
+		{100 * time.Millisecond, 100 * time.Millisecond, 300 * time.Millisecond, "sampel pertama"},
+		// RTTVAR = 3/4·50ms + 1/4·0 = 37.5ms
+		{100 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, "sampel stabil"},
+		// SRTT = 7/8·100ms + 1/8·500ms, RTTVAR = 3/4·37.5ms + 1/4·400ms
+		{500 * time.Millisecond, 150 * time.Millisecond, 150*time.Millisecond + 4*128125*time.Microsecond, "lonjakan"},
+	}
+	for _, tt := range tests {
+		e.Update(tt.sample)
+		if e.SRTT() != tt.srtt || e.RTO() != tt.rto {
+			t.Errorf("%s: SRTT %v RTO %v, diharapkan %v dan %v", tt.describe, e.SRTT(), e.RTO(), tt.srtt, tt.rto)
+		}
+	}
+
+	var fast RTTEstimator
+	fast.Update(time.Millisecond)
+	if fast.RTO() != MinRTO {
+		t.Errorf("RTO jalur cepat %v, diharapkan dibatasi %v", fast.RTO(), MinRTO)
+	}
+	var slow RTTEstimator
+	slow.Update(time.Minute)
+	if slow.RTO() != MaxRTO {
+		t.Errorf("RTO jalur lambat %v, diharapkan dibatasi %v", slow.RTO(), MaxRTO)
+	}
+}
+
+func TestRetransmitQueueAckAndBackoff(t *testing.T) {
+	q := NewRetransmitQueue(NewCubic())
+	t0 := time.Unix(1000, 0)
+	for seq := range uint64(4) {
+		q.Add(seq, make([]byte, 100), t0)
+	}
+	if q.BytesInFlight() != 400 {
+		t.Fatalf("bytes in flight %d, diharapkan 400", q.BytesInFlight())
+	}
+
+	acked := q.OnAck([]AckRange{{1, 2}}, t0.Add(50*time.Millisecond))
+	if len(acked) != 2 || q.Len() != 2 || q.BytesInFlight() != 200 {
+		t.Fatalf("setelah SACK 1-2: %d di-ACK, %d menunggu, %d byte", len(acked), q.Len(), q.BytesInFlight())
+	}
+	if q.RTT.SRTT() != 50*time.Millisecond {
+		t.Errorf("SRTT %v, diharapkan 50ms", q.RTT.SRTT())
+	}
+	if oldest, ok := q.Oldest(); !ok || oldest != 0 {
+		t.Errorf("Oldest = %d, %v; diharapkan 0", oldest, ok)
+	}
+
+	rto := q.RTT.RTO() // MinRTO
+	due, _ := q.Due(t0.Add(rto - time.Millisecond))
+	if len(due) != 0 {
+		t.Fatalf("%d paket dikirim ulang sebelum RTO", len(due))
+	}
+	t1 := t0.Add(rto)
+	due, _ = q.Due(t1)
+	if len(due) != 2 {
+		t.Fatalf("%d paket dikirim ulang setelah RTO, diharapkan 2", len(due))
+	}
+	// Exponential backoff: retransmisi kedua menunggu 2·RTO sejak kiriman terakhir
+	if due, _ = q.Due(t1.Add(2*rto - time.Millisecond)); len(due) != 0 {
+		t.Fatalf("%d paket dikirim ulang sebelum 2·RTO", len(due))
+	}
+	if due, _ = q.Due(t1.Add(2 * rto)); len(due) != 2 {
+		t.Fatalf("%d paket dikirim ulang setelah 2·RTO, diharapkan 2", len(due))
+	}
+
+	// Algoritma Karn: ACK untuk paket yang pernah dikirim ulang tidak menjadi sampel RTT
+	srtt := q.RTT.SRTT()
+	q.OnAck([]AckRange{{0, 0}}, t1.Add(10*time.Second))
+	if q.RTT.SRTT() != srtt {
+		t.Errorf("SRTT berubah menjadi %v oleh paket yang dikirim ulang", q.RTT.SRTT())
+	}
+}
+
+func TestRetransmitQueueGivesUp(t *testing.T) {
+	q := NewRetransmitQueue(NewCubic())
+	now := time.Unix(1000, 0)
+	q.Add(0, make([]byte, 100), now)
+	for retries := 0; ; retries++ {
+		now = now.Add(MaxRTO)
+		_, err := q.Due(now)
+		if errors.Is(err, ErrMaxRetransmits) {
+			if retries != MaxRetransmits {
+				t.Errorf("menyerah setelah %d retransmisi, diharapkan %d", retries, MaxRetransmits)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRetransmitQueueGivesUpBeforeChangingState(t *testing.T) {
+	cc := NewCubic()
+	q := NewRetransmitQueue(cc)
+	t0 := time.Unix(1000, 0)
+	for seq := range uint64(16) {
+		q.Add(seq, make([]byte, 100), t0)
+	}
+	q.pending[7].Retries = MaxRetransmits
+	now := t0.Add(MaxRTO)
+	if _, err := q.Due(now); !errors.Is(err, ErrMaxRetransmits) {
+		t.Fatalf("Due: error %v, diharapkan ErrMaxRetransmits", err)
+	}
+	for seq, p := range q.pending {
+		if seq != 7 && (p.Retries != 0 || !p.LastSent.Equal(t0)) {
+			t.Errorf("paket #%d diubah sebelum Due menyerah: %d retransmisi, terakhir %v", seq, p.Retries, p.LastSent)
+		}
+	}
+	if cc.CongestionWindow() != cubicInitialCwnd {
+		t.Errorf("cwnd %d, loss dilaporkan sebelum Due menyerah", cc.CongestionWindow())
+	}
+}
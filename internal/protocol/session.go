@@ -0,0 +1,801 @@
+package protocol
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"lukechampine.com/blake3"
+)
+
+var (
+	ErrSessionClosed   = fmt.Errorf("sesi sudah ditutup: %w", net.ErrClosed)
+	ErrPeerClosed      = errors.New("sesi ditutup oleh peer")
+	ErrUnknownConnID   = errors.New("connection ID tidak dikenal")
+	ErrConnIDMismatch  = errors.New("connection ID tidak cocok dengan nomor urut")
+	ErrNoReturnAddress = errors.New("alamat balasan peer belum diketahui")
+)
+
+// SessionHooks menghubungkan Session dengan transport dan logika port hopping pemanggil.
+// Semua hook dipanggil dengan sesi terkunci sehingga tidak boleh memanggil method Session.
+type SessionHooks struct {
+	// Output mengirim satu datagram ke peer.
+	Output func(packet []byte) error
+	// Prepare mengisi field port hopping sebelum paket disegel. reliable bernilai true untuk
+	// paket yang masuk antrean retransmisi. Prepare juga dipanggil untuk mengukur ruang paket
+	// yang tidak jadi dikirim, jadi hanya boleh mengisi field msg.
+	Prepare func(msg *DataMessage, reliable bool)
+	// OnReceive dipanggil untuk pesan yang diterima jendela dengan nomor urut lebih tinggi
+	// dari semua pesan sebelumnya, sebelum ACK-nya dikirim. Replay dan paket lama yang
+	// tertunda tidak memanggilnya, sehingga aman dipakai untuk memindahkan alamat balasan.
+	// from adalah alamat sumber datagram.
+	OnReceive func(msg *DataMessage, from net.Addr)
+	// OnAcked dipanggil untuk setiap paket andal yang di-ACK peer.
+	OnAcked func(p *PendingPacket)
+	// OnConnIDs dipanggil saat connection ID penerimaan bergeser.
+	OnConnIDs func(added, removed []ConnID)
+}
+
+// Session adalah mesin transport satu sesi SecureFlow yang dipakai klien maupun server:
+// penomoran paket dan rantai hash, ACK dan retransmisi, congestion control, PMTU,
+// fragmentasi pesan, stream, dan datagram tak andal. Pengiriman ke jaringan dilakukan lewat SessionHooks.
+type Session struct {
+	mu    sync.Mutex
+	cond  *sync.Cond // Dibangunkan setiap ada ACK, data masuk, kredit stream, atau penutupan
+	hooks SessionHooks
+
+	id            string
+	isClient      bool
+	sendKey       [crypto.KeySize]byte
+	recvKey       [crypto.KeySize]byte
+	sendConnIDKey [crypto.KeySize]byte
+	sendHeaderKey [crypto.KeySize]byte
+	recvHeaderKey [crypto.KeySize]byte
+	recvConnIDs   *ConnIDWindow
+	closeErr      error
+	lastSeen      time.Time
+	readDeadline  deadline // ReceiveMessage, ReceiveDatagram, dan AcceptStream
+	writeDeadline deadline // SendMessage dan SendDatagram
+
+	// Pengiriman
+	seq             uint64
+	lastSentHash    [HashSize]byte
+	lastSent        []byte // Datagram terakhir yang menyambung rantai hash
+	retransmit      *RetransmitQueue
+	peerWindow      *PeerWindow
+	control         []Frame       // Frame kontrol yang menunggu ruang di jendela peer
+	resend          []DataMessage // Isi paket andal yang dibuang setelah MTU turun, menunggu dikirim ulang
+	windowAnnounced bool          // Peer sudah meng-ACK paket yang mengumumkan ukuran jendela kita
+	forward         bool          // Paket kosong andal yang memajukan ForwardSeq peer belum terkirim
+	ackPending      bool          // ACK ditunda sampai Tick karena jendela peer hampir penuh
+	pacer           Pacer
+	pmtu            *PMTUProber
+	padding         PaddingPolicy   // Nil berarti tanpa padding
+	chaff           *ChaffScheduler // Nil berarti tanpa chaff
+	queue           *sendQueue      // Nil berarti datagram dikirim begitu disegel
+	nextFragmentID  uint64
+
+	// Penerimaan
+	window      *ReceiveWindow
+	recvNewest  uint64 // Satu di atas nomor urut tertinggi yang sudah diterima jendela
+	acks        AckTracker
+	reassembler *Reassembler
+	messages    [][]byte
+	datagrams   [][]byte
+
+	streams streamTable
+}
+
+// NewSession membuat sesi dari jadwal kunci hasil handshake. Rantai hash kedua arah
+// dimulai dari hash nol. window adalah ukuran jendela penerimaan yang diumumkan ke peer; nol
+// berarti DefaultReceiveWindow. obfs mengatur padding, chaff, dan waktu kirim paket sesi ini.
+func NewSession(id string, keys *crypto.KeySchedule, isClient bool, cc CongestionController, window int, obfs Obfuscation, hooks SessionHooks) *Session {
+	if window == 0 {
+		window = DefaultReceiveWindow
+	}
+	sendKey, recvKey := keys.TrafficKeys(isClient)
+	sendConnIDKey, recvConnIDKey := keys.ConnIDKeys(isClient)
+	sendHeaderKey, recvHeaderKey := keys.HeaderKeys(isClient)
+	s := &Session{
+		hooks:         hooks,
+		id:            id,
+		isClient:      isClient,
+		sendKey:       sendKey,
+		recvKey:       recvKey,
+		sendConnIDKey: sendConnIDKey,
+		sendHeaderKey: sendHeaderKey,
+		recvHeaderKey: recvHeaderKey,
+		recvConnIDs:   NewConnIDWindow(recvConnIDKey),
+		lastSeen:      time.Now(),
+		retransmit:    NewRetransmitQueue(cc),
+		peerWindow:    NewPeerWindow(),
+		pmtu:          NewPMTUProber(),
+		padding:       obfs.Padding,
+		chaff:         NewChaffScheduler(obfs.ChaffRate, time.Now()),
+		window:        NewReceiveWindow([HashSize]byte{}, window),
+		reassembler:   NewReassembler(nil),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	if obfs.Timing.Mode == TimingConstant {
+		// Slot kosong sudah diisi chaff berukuran tetap
+		s.chaff = nil
+	}
+	s.queue = s.startQueue(obfs.Timing, time.Now())
+	s.recvConnIDs.Slide(ConnIDRange(0, window))
+	s.streams.init(isClient)
+	return s
+}
+
+// ShareReassemblyBudget memotong memori reassembly sesi ini dari anggaran bersama budget,
+// misalnya milik Listener. Harus dipanggil sebelum paket pertama diproses.
+func (s *Session) ShareReassemblyBudget(budget *ReassemblyBudget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reassembler = NewReassembler(budget)
+}
+
+// ID mengembalikan SessionID.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// ConnIDs mengembalikan connection ID yang saat ini diterima sesi ini.
+func (s *Session) ConnIDs() []ConnID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recvConnIDs.IDs()
+}
+
+// RecvNext mengembalikan nomor urut berikutnya yang ditunggu dari peer.
+func (s *Session) RecvNext() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.window.Next()
+}
+
+// LastSeen mengembalikan waktu paket valid terakhir dari peer.
+func (s *Session) LastSeen() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeen
+}
+
+// Err mengembalikan alasan sesi ditutup, atau nil jika sesi masih hidup.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeErr
+}
+
+// Stats mengembalikan statistik congestion control dan MTU sesi.
+func (s *Session) Stats() SessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.retransmit.Stats()
+	stats.MTU = s.mtu()
+	return stats
+}
+
+// SetReadDeadline mengatur batas waktu ReceiveMessage, ReceiveDatagram, dan AcceptStream.
+// Operasi yang melewati batas mengembalikan os.ErrDeadlineExceeded; waktu nol menghapus batas.
+func (s *Session) SetReadDeadline(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline.set(t, s.cond)
+}
+
+// SetWriteDeadline mengatur batas waktu SendMessage dan SendDatagram menunggu jendela
+// kongesti. Data yang sudah terkirim sebelum batas habis tetap dikirim ulang jika hilang.
+func (s *Session) SetWriteDeadline(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeDeadline.set(t, s.cond)
+}
+
+// Drain menunggu sampai semua paket andal di-ACK peer atau sampai batas waktu until.
+func (s *Session) Drain(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var d deadline
+	d.set(until, s.cond)
+	defer d.set(time.Time{}, s.cond)
+	for s.retransmit.Len() > 0 {
+		if s.closeErr != nil {
+			return s.closeErr
+		}
+		if d.exceeded() {
+			return os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+	return nil
+}
+
+// Close menutup sesi, memberi tahu peer dengan FrameConnectionClose, dan membangunkan semua
+// pemanggil yang sedang menunggu. Paket yang belum di-ACK tidak dikirim ulang lagi; panggil
+// Drain lebih dulu untuk penutupan yang rapi. Pemberitahuan ke peer tidak andal, sehingga
+// peer yang tidak menerimanya baru menutup sesi setelah batas idle.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeErr != nil {
+		return nil
+	}
+	msg := s.newMessage(false)
+	msg.Frames = []Frame{{Type: FrameConnectionClose}}
+	s.transmit(msg, false, time.Now())
+	s.flushQueue()
+	s.closeLocked(ErrSessionClosed)
+	return nil
+}
+
+func (s *Session) closeLocked(err error) {
+	if s.closeErr != nil {
+		return
+	}
+	s.closeErr = err
+	s.queue.stop()
+	s.reassembler.Reset()
+	s.streams.closeAll(err)
+	s.cond.Broadcast()
+}
+
+// HandlePacket memproses satu paket data dari from yang sudah di-deserialize dari raw.
+// Frame stream dan datagram diproses begitu paket diterima agar tidak saling menghalangi,
+// sedangkan pesan diteruskan sesuai urutan nomor urut.
+func (s *Session) HandlePacket(packet *SecurePacket, raw []byte, from net.Addr, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeErr != nil {
+		return s.closeErr
+	}
+
+	seq, ok := s.recvConnIDs.Lookup(packet.Header.ConnID)
+	if !ok {
+		return ErrUnknownConnID
+	}
+	plaintext, err := crypto.Decrypt(s.recvKey, packet.Nonce, packet.Payload)
+	if err != nil {
+		return err
+	}
+	msg, err := DecodeDataMessage(plaintext)
+	if err != nil {
+		return err
+	}
+	if msg.Seq != seq {
+		return fmt.Errorf("%w: #%d", ErrConnIDMismatch, msg.Seq)
+	}
+	prevHash := prevHashMask(s.recvHeaderKey, packet.Nonce)
+	subtle.XORBytes(prevHash[:], prevHash[:], packet.Header.PrevHash[:])
+	s.lastSeen = now
+	if msg.ReceiveWindow != 0 {
+		s.peerWindow.SetSize(msg.ReceiveWindow)
+	}
+	s.onAck(msg.Acks, now)
+
+	delivered, err := s.window.Insert(&ReceivedPacket{
+		Seq:      msg.Seq,
+		PrevHash: prevHash,
+		Hash:     blake3.Sum256(raw),
+		Message:  msg,
+	})
+	if errors.Is(err, ErrDuplicatePacket) {
+		// Retransmisi dari paket yang sudah diterima: ACK sebelumnya kemungkinan hilang.
+		// Add melaporkannya ulang walaupun rentangnya sudah tergeser rentang yang lebih baru
+		if !msg.AckOnly {
+			s.acks.Add(msg.Seq)
+			s.sendAck(now)
+		}
+		return err
+	}
+	if err != nil && !errors.Is(err, ErrHashChain) {
+		return err
+	}
+	if err == nil && msg.Seq >= s.recvNewest {
+		s.recvNewest = msg.Seq + 1
+		if s.hooks.OnReceive != nil {
+			s.hooks.OnReceive(msg, from)
+		}
+	}
+	s.acks.Add(msg.Seq)
+	s.streams.handleFrames(s, msg.Frames)
+	for _, p := range delivered {
+		message, ferr := s.reassembler.Add(p.Message.Fragment(), now)
+		if ferr != nil {
+			log.Printf("[Session %s] Fragmen pada paket #%d dibuang: %v", s.id, p.Seq, ferr)
+			continue
+		}
+		if message != nil {
+			s.messages = append(s.messages, message)
+		}
+	}
+	if err != nil {
+		s.closeLocked(err)
+		return err
+	}
+
+	added, removed := s.recvConnIDs.Slide(ConnIDRange(s.window.Next(), s.window.Size()))
+	if s.hooks.OnConnIDs != nil && (len(added) > 0 || len(removed) > 0) {
+		s.hooks.OnConnIDs(added, removed)
+	}
+	if !msg.AckOnly {
+		s.sendAck(now)
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+// onAck memproses rentang SACK dari peer.
+func (s *Session) onAck(ranges []AckRange, now time.Time) {
+	if len(ranges) == 0 {
+		return
+	}
+	// Semua paket sebelum pengumuman diterima membawa ukuran jendela, jadi ACK apa pun
+	// berarti peer sudah mengetahuinya
+	s.windowAnnounced = true
+	if s.pmtu.OnAck(ranges) {
+		log.Printf("[Session %s] 📏 Probe PMTU di-ACK, MTU jalur sekarang %d byte", s.id, s.pmtu.MTU())
+	}
+	s.peerWindow.OnAck(ranges)
+	s.flushControl(now)
+	for _, p := range s.retransmit.OnAck(ranges, now) {
+		s.pmtu.OnPacketAcked()
+		if s.hooks.OnAcked != nil {
+			s.hooks.OnAcked(p)
+		}
+	}
+	s.cond.Broadcast()
+}
+
+// Tick mengirim ulang paket yang RTO-nya habis dan menjalankan probe PMTU. Pemanggil
+// memanggilnya secara berkala; error berarti sesi diputus.
+func (s *Session) Tick(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeErr != nil {
+		return s.closeErr
+	}
+	due, err := s.retransmit.Due(now)
+	if err != nil {
+		s.closeLocked(err)
+		return err
+	}
+	shrunk := false
+	for _, p := range due {
+		if s.pmtu.OnPacketLost(len(p.Packet)) {
+			log.Printf("[Session %s] 📏 Black hole terdeteksi, MTU jalur kembali ke %d byte", s.id, s.pmtu.MTU())
+			s.refragment()
+			shrunk = true
+		}
+	}
+	for _, p := range due {
+		if len(p.Packet) > s.mtu() {
+			continue // Isinya sudah dipindahkan ke s.resend
+		}
+		log.Printf("[Session %s] ❌ Paket #%d belum di-ACK, dikirim ulang (percobaan %d, RTO %v).", s.id, p.Seq, p.Retries, s.retransmit.RTT.RTO())
+		if err := s.output(p.Packet, now); err != nil {
+			log.Printf("[Session %s] Gagal mengirim ulang paket #%d: %v", s.id, p.Seq, err)
+		}
+	}
+	if shrunk {
+		s.flushControl(now)
+	}
+	if len(due) > 0 {
+		s.cond.Broadcast()
+	}
+	if s.ackPending && !s.queue.constant() {
+		s.transmitAck(now)
+	}
+	// Pesan setengah jadi dari peer yang berhenti mengirim fragmen juga harus melepas
+	// anggaran bersama, bukan hanya saat fragmen berikutnya tiba
+	s.reassembler.Expire(now)
+	s.probePMTU(now)
+	for i := 0; s.chaff != nil && s.chaff.Due(now) && i < maxChaffPerTick; i++ {
+		if !s.sendChaff(now) {
+			s.chaff.OnSent(now, BasePLPMTU)
+		}
+	}
+	if _, probing := s.pmtu.Outstanding(); !probing && s.retransmit.Len() == 0 && (!s.peerWindow.InWindow(s.seq, 1) || s.peerWindow.Blocked()) {
+		// Jendela peer tampak penuh, atau peer menahan paket di belakang celah, tanpa paket
+		// andal atau probe yang ditunggu: sisanya paket tak andal yang hilang atau ACK-nya
+		// tidak pernah kembali
+		s.forward = true
+		s.flushControl(now)
+	}
+	return nil
+}
+
+// refragment memindahkan isi paket andal yang lebih besar dari MTU jalur ke s.resend setelah
+// MTU turun. Paket yang sudah disegel tidak bisa diperkecil karena terikat rantai hash, jadi
+// nomor urutnya ditinggalkan seperti datagram tak andal yang hilang dan peer melompatinya
+// lewat ForwardSeq. Isinya dibaca ulang dari paket itu sendiri agar antrean retransmisi tidak
+// perlu menyimpan salinan kedua, lalu dikirim flushControl dalam paket seukuran MTU baru.
+func (s *Session) refragment() {
+	for _, p := range s.retransmit.Oversized(s.mtu()) {
+		s.retransmit.Remove(p.Seq)
+		msg, err := s.open(p.Packet)
+		if err != nil {
+			log.Printf("[Session %s] Gagal membaca ulang paket #%d: %v", s.id, p.Seq, err)
+			continue
+		}
+		content := DataMessage{Message: msg.Message, Frames: msg.Frames}
+		switch {
+		case msg.FragmentTotal != 0:
+			content.FragmentID, content.FragmentOffset, content.FragmentTotal = msg.FragmentID, msg.FragmentOffset, msg.FragmentTotal
+		case len(msg.Message) > 0:
+			// Pesan utuh dipotong menjadi fragmen dengan ID baru
+			content.FragmentID, content.FragmentTotal = s.nextFragmentID, uint64(len(msg.Message))
+			s.nextFragmentID++
+		case len(msg.Frames) == 0:
+			continue // Paket pemaju tanpa isi
+		}
+		s.resend = append(s.resend, content)
+	}
+}
+
+// open membuka paket yang disegel sesi ini sendiri.
+func (s *Session) open(raw []byte) (*DataMessage, error) {
+	packet, err := Deserialize(raw)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := crypto.Decrypt(s.sendKey, packet.Nonce, packet.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeDataMessage(plaintext)
+}
+
+// takeResend memindahkan bagian terdepan s.resend yang muat dalam MTU jalur ke msg. Data
+// fragmen dan stream yang terlalu besar dipotong; sisanya tetap di depan antrean.
+func (s *Session) takeResend(msg *DataMessage) {
+	head := &s.resend[0]
+	if len(head.Frames) > 0 {
+		f := head.Frames[0]
+		if room := StreamDataRoom(s.mtu(), msg, f.StreamID, f.Offset); f.Type == FrameData && len(f.Data) > room {
+			f.Data = f.Data[:room]
+			head.Frames[0].Data = head.Frames[0].Data[room:]
+			head.Frames[0].Offset += uint64(room)
+		} else {
+			head.Frames = head.Frames[1:]
+		}
+		msg.Frames = []Frame{f}
+	} else {
+		f := head.Fragment()
+		f.Data = f.Data[:min(len(f.Data), FragmentRoom(s.mtu(), msg, f.ID, int(f.Total)))]
+		msg.SetFragment(f)
+		head.Message = head.Message[len(f.Data):]
+		head.FragmentOffset += uint64(len(f.Data))
+	}
+	if len(head.Frames) == 0 && len(head.Message) == 0 {
+		s.resend = s.resend[1:]
+	}
+}
+
+// probePMTU mengirim probe PMTU jika prober memintanya. Probe yang hilang tidak dikirim
+// ulang; sebagai gantinya paket kosong yang andal dikirim agar peer melompati nomor urutnya.
+func (s *Session) probePMTU(now time.Time) {
+	if s.queue.constant() {
+		// Probe akan membocorkan ukuran yang berbeda dari ukuran tetap
+		return
+	}
+	if s.pmtu.CheckTimeout(now, s.retransmit.RTT.RTO()) {
+		s.forward = true
+		s.flushControl(now)
+	}
+	size, ok := s.pmtu.NextProbe(now)
+	if !ok || !s.peerWindow.InWindow(s.seq, s.peerWindow.AckReserve()) {
+		return
+	}
+	probe := s.newMessage(false)
+	PadToSize(probe, size)
+	packet, err := s.seal(probe)
+	if err != nil {
+		log.Printf("[Session %s] Gagal menyegel probe PMTU: %v", s.id, err)
+		return
+	}
+	if err := s.output(packet, now); err != nil {
+		if errors.Is(err, syscall.EMSGSIZE) {
+			s.pmtu.OnProbeTooBig(size)
+		}
+		return
+	}
+	s.pmtu.OnProbeSent(probe.Seq, len(packet), now)
+	s.advance(probe, packet, now)
+}
+
+// SendMessage mengirim satu pesan aplikasi secara andal dan berurutan. Pesan yang tidak muat
+// dalam satu datagram dipotong menjadi fragmen seukuran MTU jalur.
+func (s *Session) SendMessage(message []byte) error {
+	if len(message) > MaxMessageSize {
+		return fmt.Errorf("%w: %d byte", ErrMessageTooLarge, len(message))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextFragmentID
+	s.nextFragmentID++
+	for offset := 0; offset < len(message); {
+		if err := s.waitSendable(nil, &s.writeDeadline); err != nil {
+			return err
+		}
+		msg := s.newMessage(true)
+		f := FragmentAt(id, message, offset, FragmentRoom(s.mtu(), msg, id, len(message)))
+		msg.SetFragment(f)
+		if err := s.transmit(msg, true, time.Now()); err != nil {
+			return err
+		}
+		offset += len(f.Data)
+	}
+	return nil
+}
+
+// ReceiveMessage menunggu dan mengembalikan pesan aplikasi berikutnya dari peer.
+func (s *Session) ReceiveMessage() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.messages) == 0 {
+		if s.closeErr != nil {
+			return nil, s.closeErr
+		}
+		if s.readDeadline.exceeded() {
+			return nil, os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+	message := s.messages[0]
+	s.messages = s.messages[1:]
+	return message, nil
+}
+
+// waitSendable menunggu sampai ready mengizinkan, jendela kongesti, jendela penerimaan
+// peer, dan antrean kirim punya ruang, lalu sampai pacer mengizinkan pengiriman. ready
+// boleh nil. Menunggu dihentikan dengan os.ErrDeadlineExceeded jika batas waktu d habis.
+func (s *Session) waitSendable(ready func() (bool, error), d *deadline) error {
+	for {
+		if s.closeErr != nil {
+			return s.closeErr
+		}
+		if d.exceeded() {
+			return os.ErrDeadlineExceeded
+		}
+		ok := true
+		if ready != nil {
+			var err error
+			if ok, err = ready(); err != nil {
+				return err
+			}
+		}
+		if !ok || !s.retransmit.CanSend() || !s.peerWindow.InWindow(s.seq, s.peerWindow.AckReserve()) || !s.queue.hasRoom() {
+			s.cond.Wait()
+			continue
+		}
+		delay := s.pacer.Delay(time.Now())
+		if delay == 0 {
+			return nil
+		}
+		s.mu.Unlock()
+		time.Sleep(delay)
+		s.mu.Lock()
+	}
+}
+
+// newMessage membuat DataMessage untuk nomor urut berikutnya dengan field kontrol yang
+// dibawa setiap paket.
+func (s *Session) newMessage(reliable bool) *DataMessage {
+	msg := s.messageTemplate(reliable)
+	s.ackPending = false // Setiap paket membawa ACK terbaru
+	return msg
+}
+
+// messageTemplate membangun DataMessage dengan field kontrol yang akan dibawa paket berikutnya
+// tanpa mengubah state sesi, sehingga bisa dipakai untuk mengukur ruang paket tanpa mengirimnya.
+func (s *Session) messageTemplate(reliable bool) *DataMessage {
+	msg := &DataMessage{
+		Seq:  s.seq,
+		Acks: s.acks.Ranges(),
+	}
+	if !s.windowAnnounced {
+		msg.ReceiveWindow = uint64(s.window.Size())
+	}
+	// Nomor urut di bawah paket tertua yang masih ditunggu (data atau probe) tidak akan
+	// dikirim ulang, jadi peer boleh melompati ACK murni dan probe PMTU yang hilang
+	msg.ForwardSeq = s.seq
+	if oldest, ok := s.retransmit.Oldest(); ok {
+		msg.ForwardSeq = min(msg.ForwardSeq, oldest)
+	}
+	if probeSeq, ok := s.pmtu.Outstanding(); ok {
+		msg.ForwardSeq = min(msg.ForwardSeq, probeSeq)
+	}
+	if s.hooks.Prepare != nil {
+		s.hooks.Prepare(msg, reliable)
+	}
+	return msg
+}
+
+// seal mengenkripsi msg menjadi datagram yang menyambung rantai hash pengirim. PrevHash
+// disamarkan dengan kunci header-protection; hash paket dihitung atas datagram tersamar.
+func (s *Session) seal(msg *DataMessage) ([]byte, error) {
+	plaintext, err := EncodeDataMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("gagal menyandikan paket #%d: %w", msg.Seq, err)
+	}
+	encryptedPayload, nonce, err := crypto.Encrypt(s.sendKey, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("gagal mengenkripsi paket #%d: %w", msg.Seq, err)
+	}
+	prevHash := prevHashMask(s.sendHeaderKey, nonce)
+	subtle.XORBytes(prevHash[:], prevHash[:], s.lastSentHash[:])
+	packet := &SecurePacket{
+		Header: PacketHeader{
+			Version:  ProtocolVersion,
+			Type:     DataMsgType,
+			ConnID:   DeriveConnID(s.sendConnIDKey, msg.Seq),
+			PrevHash: prevHash,
+		},
+		Nonce:   nonce,
+		Payload: encryptedPayload,
+	}
+	return packet.Serialize()
+}
+
+// mtu mengembalikan ukuran datagram terbesar yang boleh dikirim: MTU jalur, atau ukuran
+// tetap mode timing constant.
+func (s *Session) mtu() int {
+	if s.queue.constant() {
+		return s.queue.timing.PacketSize
+	}
+	return s.pmtu.MTU()
+}
+
+// pad memberi msg padding sesuai kebijakan sesi, atau sampai ukuran tetap mode timing constant.
+func (s *Session) pad(msg *DataMessage) {
+	switch {
+	case s.queue.constant():
+		PadToSize(msg, s.queue.timing.PacketSize)
+	case s.padding != nil:
+		PadToSize(msg, s.padding.Target(PacketSize(msg), s.pmtu.MTU()))
+	}
+}
+
+// transmit menyegel dan mengirim msg setelah diberi padding, lalu memajukan nomor urut dan
+// rantai hash. Paket andal dimasukkan ke antrean retransmisi.
+func (s *Session) transmit(msg *DataMessage, reliable bool, now time.Time) error {
+	s.pad(msg)
+	packet, err := s.seal(msg)
+	if err != nil {
+		return err
+	}
+	if reliable {
+		s.retransmit.Add(msg.Seq, packet, now)
+		s.pacer.OnSent(now, len(packet), s.retransmit.Congestion.PacingRate())
+	}
+	if err := s.output(packet, now); err != nil {
+		if reliable {
+			s.retransmit.Remove(msg.Seq)
+		}
+		return err
+	}
+	s.advance(msg, packet, now)
+	return nil
+}
+
+// flushControl mengirim paket pemaju ForwardSeq, frame kontrol yang tertunda, dan isi paket
+// yang dipotong ulang setelah MTU turun selama jendela penerimaan peer punya ruang. Semuanya
+// tidak menunggu jendela kongesti: dua yang pertama kecil dan dibutuhkan agar peer bisa
+// melanjutkan, sedangkan isi yang dipotong ulang menggantikan paket yang sudah dikeluarkan
+// dari antrean retransmisi. Frame kontrol tidak boleh memakai cadangan ACK,
+// sedangkan paket pemaju boleh memakai nomor urut terakhir di jendela peer: hanya paket itu
+// yang bisa membuat peer melompati celah dari paket tak andal yang hilang ketika semua nomor
+// urut lain sudah terpakai.
+func (s *Session) flushControl(now time.Time) {
+	if s.forward && s.peerWindow.InWindow(s.seq, 0) {
+		s.forward = false
+		if err := s.transmit(s.newMessage(true), true, now); err != nil {
+			log.Printf("[Session %s] Gagal mengirim paket pemaju #%d: %v", s.id, s.seq, err)
+		}
+	}
+	for len(s.control) > 0 && s.peerWindow.InWindow(s.seq, s.peerWindow.AckReserve()) {
+		msg := s.newMessage(true)
+		msg.Frames = s.control[:1]
+		s.control = s.control[1:]
+		if err := s.transmit(msg, true, now); err != nil {
+			log.Printf("[Session %s] Gagal mengirim frame 0x%02x stream %d: %v", s.id, byte(msg.Frames[0].Type), msg.Frames[0].StreamID, err)
+		}
+	}
+	for len(s.resend) > 0 && s.peerWindow.InWindow(s.seq, s.peerWindow.AckReserve()) {
+		msg := s.newMessage(true)
+		s.takeResend(msg)
+		if err := s.transmit(msg, true, now); err != nil {
+			log.Printf("[Session %s] Gagal mengirim ulang isi paket #%d: %v", s.id, msg.Seq, err)
+		}
+	}
+}
+
+// advance memajukan nomor urut dan rantai hash setelah packet berisi msg terkirim.
+func (s *Session) advance(msg *DataMessage, packet []byte, now time.Time) {
+	s.lastSentHash = blake3.Sum256(packet)
+	s.lastSent = packet
+	s.peerWindow.OnSent(msg.Seq, msg.ForwardSeq)
+	s.seq++
+	if s.chaff != nil {
+		s.chaff.OnSent(now, len(packet))
+	}
+}
+
+// sendAck mengirim ACK murni untuk semua paket yang sudah diterima. Setelah data tidak lagi
+// boleh dikirim, ACK hanya memakai cadangan di ujung jendela peer: ACK digabung dan dikirim
+// paling banyak sekali per Tick, dan ditunda jika cadangannya habis. ACK murni tidak di-ACK
+// peer, sehingga pengirim yang hanya mengirim ACK tidak pernah tahu peer sudah melewatinya;
+// setelah setengah jendela belum terkonfirmasi, ACK dibuat memicu ACK balasan seperti
+// PING di QUIC. Pada mode timing constant ACK selalu menunggu slot kirim berikutnya.
+func (s *Session) sendAck(now time.Time) {
+	if !s.peerWindow.InWindow(s.seq, s.peerWindow.AckReserve()) || s.queue.constant() {
+		s.ackPending = true
+		return
+	}
+	s.transmitAck(now)
+}
+
+// transmitAck mengirim ACK murni jika jendela peer masih punya ruang di luar nomor urut
+// terakhir, yang disisakan untuk paket pemaju ForwardSeq.
+func (s *Session) transmitAck(now time.Time) {
+	if !s.peerWindow.InWindow(s.seq, 1) {
+		return
+	}
+	msg := s.newMessage(false)
+	msg.AckOnly = s.peerWindow.Unconfirmed() < s.peerWindow.Size()/2
+	if err := s.transmit(msg, false, now); err != nil {
+		log.Printf("[Session %s] Gagal mengirim ACK #%d: %v", s.id, msg.Seq, err)
+	}
+}
+
+// sendChaff mengirim satu paket chaff: paket tak andal tanpa data aplikasi yang berukuran
+// acak sampai MTU jalur sebelum dibulatkan kebijakan padding. Chaff memakai ulang nomor urut
+// tertinggi yang sudah pasti diterima atau dilompati peer, sehingga tidak memakai slot di
+// jendela penerimaan peer dan tidak menyambung rantai hash; bagi pengamat chaff tampak
+// seperti retransmisi. Penerima menganggapnya duplikat dan membuangnya setelah autentikasi,
+// kecuali ACK yang dibawanya. Sebelum peer mengonfirmasi paket apa pun, chaff memakai nomor
+// urut baru tanpa menyentuh cadangan ACK. Melaporkan apakah chaff terkirim.
+func (s *Session) sendChaff(now time.Time) bool {
+	confirmed, ok := s.peerWindow.Confirmed()
+	// Connection ID nomor urut itu masih dikenali peer selama berada di dalam jendelanya
+	reuse := ok && confirmed+uint64(s.peerWindow.Size()) >= s.seq
+	if !reuse && !s.peerWindow.InWindow(s.seq, s.peerWindow.AckReserve()) {
+		return false
+	}
+	msg := s.newMessage(false)
+	if reuse {
+		msg.Seq, msg.ForwardSeq, msg.AckOnly = confirmed, 0, true
+	} else {
+		msg.AckOnly = s.peerWindow.Unconfirmed() < s.peerWindow.Size()/2
+	}
+	size := PacketSize(msg)
+	if mtu := s.mtu(); mtu > size {
+		size += rand.IntN(mtu - size + 1)
+	}
+	PadToSize(msg, size)
+	if !reuse {
+		return s.transmit(msg, false, now) == nil
+	}
+	s.pad(msg)
+	packet, err := s.seal(msg)
+	if err != nil {
+		log.Printf("[Session %s] Gagal menyegel chaff: %v", s.id, err)
+		return false
+	}
+	if err := s.output(packet, now); err != nil {
+		return false
+	}
+	if s.chaff != nil {
+		s.chaff.OnSent(now, len(packet))
+	}
+	return true
+}
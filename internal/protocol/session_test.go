@@ -0,0 +1,240 @@
+package protocol
+
+import (
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+)
+
+// testKeys mengembalikan jadwal kunci tetap untuk sesi uji.
+func testKeys(t *testing.T) *crypto.KeySchedule {
+	t.Helper()
+	keys, err := crypto.NewKeySchedule([crypto.KeySize]byte{1}, []byte("transkrip uji"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// captureOutput mengembalikan hook Output yang menyimpan salinan setiap datagram ke packets.
+func captureOutput(packets *[][]byte) func([]byte) error {
+	return func(packet []byte) error {
+		*packets = append(*packets, slices.Clone(packet))
+		return nil
+	}
+}
+
+func TestOnReceiveIgnoresReplay(t *testing.T) {
+	keys := testKeys(t)
+	var sent, replies [][]byte
+	client := NewSession("uji", keys, true, NewBBR(), 0, Obfuscation{}, SessionHooks{Output: captureOutput(&sent)})
+	var from []net.Addr
+	server := NewSession("uji", keys, false, NewBBR(), 0, Obfuscation{}, SessionHooks{
+		Output:    captureOutput(&replies),
+		OnReceive: func(msg *DataMessage, addr net.Addr) { from = append(from, addr) },
+	})
+	for _, message := range []string{"satu", "dua", "tiga"} {
+		if err := client.SendMessage([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sent) != 3 {
+		t.Fatalf("%d paket terkirim, diharapkan 3", len(sent))
+	}
+
+	client1 := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}
+	attacker := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 40000}
+	steps := []struct {
+		name   string
+		index  int
+		addr   net.Addr
+		err    error
+		called bool
+	}{
+		{"paket pertama", 0, client1, nil, true},
+		{"replay dari alamat lain", 0, attacker, ErrDuplicatePacket, false},
+		{"paket terbaru", 2, client1, nil, true},
+		{"paket lama yang tertunda", 1, attacker, nil, false},
+		{"replay paket terbaru", 2, attacker, ErrDuplicatePacket, false},
+	}
+	for _, step := range steps {
+		calls := len(from)
+		packet, err := Deserialize(sent[step.index])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.HandlePacket(packet, sent[step.index], step.addr, time.Now()); !errors.Is(err, step.err) {
+			t.Fatalf("%s: error %v, diharapkan %v", step.name, err, step.err)
+		}
+		if called := len(from) > calls; called != step.called {
+			t.Errorf("%s: OnReceive dipanggil %v, diharapkan %v", step.name, called, step.called)
+		}
+		if len(from) > 0 && from[len(from)-1] != client1 {
+			t.Fatalf("%s: alamat balasan pindah ke %v", step.name, from[len(from)-1])
+		}
+	}
+}
+
+func TestConstantTimingFillsEverySlot(t *testing.T) {
+	timing, err := NewTiming("constant", 0, time.Hour, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent [][]byte
+	s := NewSession("uji", testKeys(t), true, NewBBR(), 0, Obfuscation{Timing: timing}, SessionHooks{Output: captureOutput(&sent)})
+	defer s.Close()
+
+	// Peer tidak pernah membalas: chaff memakai nomor urut baru sampai jendela peer penuh,
+	// setelah itu slot diisi ulang datagram terakhir
+	for slot := range 2 * DefaultReceiveWindow {
+		s.releaseQueued()
+		if len(sent) != slot+1 {
+			t.Fatalf("slot %d mengirim %d datagram", slot, len(sent)-slot)
+		}
+		if len(sent[slot]) != timing.PacketSize {
+			t.Fatalf("slot %d: datagram %d byte, diharapkan %d", slot, len(sent[slot]), timing.PacketSize)
+		}
+	}
+	last := len(sent) - 1
+	if s.seq >= uint64(len(sent)) || !slices.Equal(sent[last], sent[last-1]) {
+		t.Errorf("slot setelah jendela peer penuh tidak diisi datagram terakhir (nomor urut %d)", s.seq)
+	}
+}
+
+// sessionPair membuat sesi klien dan server dengan kunci yang sama; datagram keluaran
+// masing-masing ditampung di sent dan replies tanpa diteruskan.
+func sessionPair(t *testing.T, sent, replies *[][]byte) (client, server *Session) {
+	keys := testKeys(t)
+	client = NewSession("uji", keys, true, NewBBR(), 0, Obfuscation{}, SessionHooks{Output: captureOutput(sent)})
+	server = NewSession("uji", keys, false, NewBBR(), 0, Obfuscation{}, SessionHooks{Output: captureOutput(replies)})
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// deliver memberikan datagram raw ke sesi to.
+func deliver(t *testing.T, to *Session, raw []byte) error {
+	t.Helper()
+	packet, err := Deserialize(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return to.HandlePacket(packet, raw, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}, time.Now())
+}
+
+func TestSessionForwardsPastLostAck(t *testing.T) {
+	var sent, replies [][]byte
+	client, server := sessionPair(t, &sent, &replies)
+	// Pencarian PMTU dianggap selesai agar tidak ada probe yang kebetulan membawa ForwardSeq baru
+	client.pmtu.complete, client.pmtu.completedAt = true, time.Now()
+
+	// #0 andal, #1 ACK murni yang hilang, #2 datagram tak andal yang tiba lebih dulu
+	if err := client.SendMessage([]byte("andal")); err != nil {
+		t.Fatal(err)
+	}
+	client.mu.Lock()
+	client.transmitAck(time.Now())
+	client.mu.Unlock()
+	if err := client.SendDatagram([]byte("datagram")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 3 {
+		t.Fatalf("%d paket terkirim, diharapkan 3", len(sent))
+	}
+	deliver(t, server, sent[2])
+	deliver(t, server, sent[0])
+	if len(replies) == 0 {
+		t.Fatal("server tidak mengirim ACK")
+	}
+	// ACK #0 dan #2 membuat antrean retransmisi klien kosong, tetapi server masih menahan #2
+	// di belakang ACK murni #1 yang tidak pernah dikirim ulang
+	for _, reply := range replies {
+		deliver(t, client, reply)
+	}
+	if server.RecvNext() != 1 {
+		t.Fatalf("RecvNext server %d, diharapkan 1", server.RecvNext())
+	}
+
+	if err := client.Tick(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 4 {
+		t.Fatalf("Tick mengirim %d paket, diharapkan satu paket pemaju", len(sent)-3)
+	}
+	if err := deliver(t, server, sent[3]); err != nil {
+		t.Fatal(err)
+	}
+	if server.RecvNext() != 4 {
+		t.Errorf("RecvNext server %d setelah paket pemaju, diharapkan 4", server.RecvNext())
+	}
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	if data, err := server.ReceiveDatagram(); err != nil || string(data) != "datagram" {
+		t.Errorf("datagram %q, %v", data, err)
+	}
+}
+
+func TestSessionStopsAtPeerWindow(t *testing.T) {
+	var sent, replies [][]byte
+	client, _ := sessionPair(t, &sent, &replies)
+	room := MinReceiveWindow - int(client.peerWindow.AckReserve())
+	for range room {
+		if err := client.SendDatagram([]byte("isi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Data berikutnya pasti ditolak peer, jadi pengirim menunggu ACK
+	client.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if err := client.SendDatagram([]byte("lebih")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("datagram di luar jendela peer: error %v", err)
+	}
+	// ACK murni masih memakai cadangan, kecuali nomor urut terakhir untuk paket pemaju
+	client.mu.Lock()
+	for range MinReceiveWindow {
+		client.transmitAck(time.Now())
+	}
+	client.mu.Unlock()
+	if len(sent) != MinReceiveWindow-1 {
+		t.Errorf("%d paket terkirim, diharapkan %d", len(sent), MinReceiveWindow-1)
+	}
+}
+
+func TestSessionQueuesControlFramesUntilWindowOpens(t *testing.T) {
+	var sent, replies [][]byte
+	client, server := sessionPair(t, &sent, &replies)
+
+	// Datagram mengisi jendela peer sampai cadangan ACK
+	room := MinReceiveWindow - int(client.peerWindow.AckReserve())
+	for range room {
+		if err := client.SendDatagram([]byte("isi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.OpenStream(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != room {
+		t.Fatalf("frame FrameOpen dikirim ke jendela peer yang penuh (%d paket)", len(sent))
+	}
+
+	for _, packet := range sent {
+		if err := deliver(t, server, packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliver(t, client, replies[len(replies)-1])
+	if len(sent) != room+1 {
+		t.Fatalf("%d paket terkirim setelah ACK, diharapkan FrameOpen yang tertunda", len(sent)-room)
+	}
+	deliver(t, server, sent[room])
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := server.AcceptStream(); err != nil {
+		t.Errorf("AcceptStream: %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// StreamWindowSize adalah kredit flow control awal dan ukuran buffer terima per stream.
+	StreamWindowSize = 256 << 10
+	// MaxStreams adalah jumlah stream terbuka maksimum yang boleh dibuka peer.
+	MaxStreams = 128
+)
+
+var (
+	ErrStreamReset    = errors.New("stream di-reset")
+	ErrStreamClosed   = errors.New("stream sudah ditutup untuk penulisan")
+	ErrTooManyStreams = errors.New("terlalu banyak stream terbuka")
+)
+
+// Stream adalah aliran byte dua arah yang berurutan dan andal di dalam satu Session.
+// Setiap stream punya urutan dan flow control sendiri, sehingga paket yang hilang pada
+// satu stream tidak menahan stream lain.
+type Stream struct {
+	id      uint64
+	session *Session
+
+	// Arah kirim
+	sendOffset uint64 // Byte yang sudah dikirim
+	sendMax    uint64 // Batas flow control dari peer
+	sendClosed bool
+
+	// Arah terima
+	chunks      []streamChunk // Data yang datang lebih awal, terurut dan tidak tumpang tindih
+	readable    []byte        // Data bersambung yang belum dibaca aplikasi
+	recvOffset  uint64        // Semua byte di bawah offset ini sudah bersambung
+	recvMax     uint64        // Batas flow control yang sudah diiklankan ke peer
+	finalOffset uint64
+	finReceived bool
+	eofRead     bool
+
+	resetErr      error
+	readDeadline  deadline
+	writeDeadline deadline
+}
+
+// streamChunk adalah potongan data stream yang tiba sebelum byte di depannya.
+type streamChunk struct {
+	offset uint64
+	data   []byte
+}
+
+func (c streamChunk) end() uint64 {
+	return c.offset + uint64(len(c.data))
+}
+
+// ID mengembalikan stream ID. Stream yang dibuka klien bernomor genap, server ganjil.
+func (st *Stream) ID() uint64 {
+	return st.id
+}
+
+// Read membaca data stream sesuai urutan. io.EOF dikembalikan setelah peer menutup stream
+// dan semua datanya sudah dibaca.
+func (st *Stream) Read(p []byte) (int, error) {
+	s := st.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(st.readable) == 0 {
+		if st.resetErr != nil {
+			return 0, st.resetErr
+		}
+		if st.finReceived && st.recvOffset == st.finalOffset {
+			st.eofRead = true
+			s.streams.release(st)
+			return 0, io.EOF
+		}
+		if s.closeErr != nil {
+			return 0, s.closeErr
+		}
+		if st.readDeadline.exceeded() {
+			return 0, os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+	n := copy(p, st.readable)
+	st.readable = st.readable[n:]
+	// Kredit baru diiklankan setelah setengah jendela terpakai
+	consumed := st.recvOffset - uint64(len(st.readable))
+	if st.recvMax-consumed < StreamWindowSize/2 && !st.finReceived {
+		st.recvMax = consumed + StreamWindowSize
+		s.sendControl(Frame{Type: FrameWindow, StreamID: st.id, MaxData: st.recvMax})
+	}
+	return n, nil
+}
+
+// Write mengirim p secara andal. Write menunggu kredit flow control stream dan ruang di
+// jendela kongesti sesi.
+func (st *Stream) Write(p []byte) (int, error) {
+	s := st.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	written := 0
+	for written < len(p) {
+		err := s.waitSendable(func() (bool, error) {
+			if st.resetErr != nil {
+				return false, st.resetErr
+			}
+			if st.sendClosed {
+				return false, ErrStreamClosed
+			}
+			return st.sendOffset < st.sendMax, nil
+		}, &st.writeDeadline)
+		if err != nil {
+			return written, err
+		}
+		msg := s.newMessage(true)
+		room := StreamDataRoom(s.mtu(), msg, st.id, st.sendOffset)
+		n := min(len(p)-written, room, int(st.sendMax-st.sendOffset))
+		msg.Frames = []Frame{{Type: FrameData, StreamID: st.id, Offset: st.sendOffset, Data: p[written : written+n]}}
+		if err := s.transmit(msg, true, time.Now()); err != nil {
+			return written, err
+		}
+		st.sendOffset += uint64(n)
+		written += n
+	}
+	return written, nil
+}
+
+// Close menutup arah kirim stream. Peer membaca io.EOF setelah semua data diterima;
+// stream tetap bisa dibaca sampai peer juga menutupnya.
+func (st *Stream) Close() error {
+	s := st.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st.resetErr != nil {
+		return st.resetErr
+	}
+	if st.sendClosed {
+		return nil
+	}
+	st.sendClosed = true
+	s.sendControl(Frame{Type: FrameClose, StreamID: st.id, Offset: st.sendOffset})
+	s.streams.release(st)
+	return nil
+}
+
+// Reset membatalkan stream di kedua arah dan memberi tahu peer dengan kode code.
+func (st *Stream) Reset(code uint64) error {
+	s := st.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st.resetErr != nil {
+		return nil
+	}
+	s.sendControl(Frame{Type: FrameReset, StreamID: st.id, ErrorCode: code})
+	s.streams.reset(st, fmt.Errorf("%w secara lokal (kode %d)", ErrStreamReset, code))
+	s.cond.Broadcast()
+	return nil
+}
+
+// SetDeadline mengatur batas waktu Read dan Write sekaligus.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline mengatur batas waktu Read. Read yang melewati batas mengembalikan
+// os.ErrDeadlineExceeded; waktu nol menghapus batas.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	s := st.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.readDeadline.set(t, s.cond)
+	return nil
+}
+
+// SetWriteDeadline mengatur batas waktu Write menunggu kredit flow control dan jendela
+// kongesti.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	s := st.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.writeDeadline.set(t, s.cond)
+	return nil
+}
+
+// OpenStream membuka stream baru ke peer.
+func (s *Session) OpenStream() (*Stream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeErr != nil {
+		return nil, s.closeErr
+	}
+	st := s.streams.open(s)
+	s.sendControl(Frame{Type: FrameOpen, StreamID: st.id})
+	return st, nil
+}
+
+// AcceptStream menunggu stream berikutnya yang dibuka peer.
+func (s *Session) AcceptStream() (*Stream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.streams.accept) == 0 {
+		if s.closeErr != nil {
+			return nil, s.closeErr
+		}
+		if s.readDeadline.exceeded() {
+			return nil, os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+	st := s.streams.accept[0]
+	s.streams.accept = s.streams.accept[1:]
+	return st, nil
+}
+
+// sendControl mengirim frame kontrol stream secara andal tanpa menunggu jendela kongesti,
+// karena frame ini kecil dan dibutuhkan agar peer bisa melanjutkan. Jika jendela penerimaan
+// peer penuh, frame diantrekan dan dikirim begitu ACK membuka jendela.
+func (s *Session) sendControl(f Frame) {
+	s.control = append(s.control, f)
+	s.flushControl(time.Now())
+}
+
+// StreamDataRoom mengembalikan jumlah byte data stream yang muat di msg tanpa membuat
+// datagramnya melebihi mtu.
+func StreamDataRoom(mtu int, msg *DataMessage, id, offset uint64) int {
+	probe := *msg
+	probe.Frames = []Frame{{Type: FrameData, StreamID: id, Offset: offset}}
+	room := mtu - PacketSize(&probe) - 3 // Panjang frame bisa bertambah sampai 3 byte uvarint
+	return max(room, 1)
+}
+
+// streamTable menyimpan stream milik satu sesi. Semua method dipanggil dengan sesi terkunci.
+type streamTable struct {
+	streams    map[uint64]*Stream
+	accept     []*Stream
+	nextLocal  uint64 // Stream ID berikutnya untuk stream yang kita buka
+	nextRemote uint64 // Stream ID peer terkecil yang belum pernah dibuka
+	remoteOpen int
+}
+
+func (t *streamTable) init(isClient bool) {
+	t.streams = make(map[uint64]*Stream)
+	if isClient {
+		t.nextLocal, t.nextRemote = 0, 1
+	} else {
+		t.nextLocal, t.nextRemote = 1, 0
+	}
+}
+
+func newStream(s *Session, id uint64) *Stream {
+	return &Stream{
+		id:      id,
+		session: s,
+		sendMax: StreamWindowSize,
+		recvMax: StreamWindowSize,
+	}
+}
+
+func (t *streamTable) open(s *Session) *Stream {
+	st := newStream(s, t.nextLocal)
+	t.nextLocal += 2
+	t.streams[st.id] = st
+	return st
+}
+
+func (t *streamTable) isRemote(id uint64) bool {
+	return id%2 == t.nextRemote%2
+}
+
+// lookup mengembalikan stream untuk frame dengan ID id, membuka stream peer secara implisit
+// (termasuk semua ID peer yang lebih kecil, seperti QUIC) jika belum ada.
+func (t *streamTable) lookup(s *Session, id uint64) (*Stream, error) {
+	if st, ok := t.streams[id]; ok {
+		return st, nil
+	}
+	if !t.isRemote(id) || id < t.nextRemote {
+		return nil, nil // Stream lokal yang tidak dikenal atau stream yang sudah selesai
+	}
+	if (id-t.nextRemote)/2 >= uint64(MaxStreams-t.remoteOpen) {
+		return nil, ErrTooManyStreams
+	}
+	for ; t.nextRemote <= id; t.nextRemote += 2 {
+		st := newStream(s, t.nextRemote)
+		t.streams[st.id] = st
+		t.accept = append(t.accept, st)
+		t.remoteOpen++
+	}
+	return t.streams[id], nil
+}
+
+// handleFrames menerapkan frame stream dari satu paket, mengantrekan datagramnya, dan
+// menutup sesi jika peer mengirim FrameConnectionClose.
+func (t *streamTable) handleFrames(s *Session, frames []Frame) {
+	for _, f := range frames {
+		switch f.Type {
+		case FrameDatagram:
+			s.queueDatagram(f.Data)
+			continue
+		case FrameConnectionClose:
+			s.closeLocked(ErrPeerClosed)
+			continue
+		}
+		st, err := t.lookup(s, f.StreamID)
+		if err != nil {
+			log.Printf("[Session %s] Stream %d ditolak: %v", s.id, f.StreamID, err)
+			s.sendControl(Frame{Type: FrameReset, StreamID: f.StreamID})
+			continue
+		}
+		if st == nil || st.resetErr != nil {
+			continue
+		}
+		switch f.Type {
+		case FrameData:
+			end := f.Offset + uint64(len(f.Data))
+			if end > st.recvMax || (st.finReceived && end > st.finalOffset) {
+				// Peer melanggar flow control atau menulis setelah menutup stream
+				s.sendControl(Frame{Type: FrameReset, StreamID: st.id, ErrorCode: 1})
+				t.reset(st, fmt.Errorf("%w: pelanggaran flow control", ErrStreamReset))
+				continue
+			}
+			st.receive(f.Offset, f.Data)
+		case FrameClose:
+			if f.Offset < st.recvOffset || f.Offset > st.recvMax {
+				continue
+			}
+			st.finReceived = true
+			st.finalOffset = f.Offset
+		case FrameReset:
+			t.reset(st, fmt.Errorf("%w oleh peer (kode %d)", ErrStreamReset, f.ErrorCode))
+		case FrameWindow:
+			st.sendMax = max(st.sendMax, f.MaxData)
+		}
+	}
+}
+
+// receive menyimpan data stream dan memindahkan bagian yang sudah bersambung ke readable.
+// Hanya byte yang belum tercakup potongan lain yang disalin, sehingga data yang ditahan tidak
+// pernah melebihi jendela flow control berapa pun banyaknya frame yang tumpang tindih.
+func (st *Stream) receive(offset uint64, data []byte) {
+	end := offset + uint64(len(data))
+	if end <= st.recvOffset {
+		return // Duplikat
+	}
+	if offset < st.recvOffset {
+		data = data[st.recvOffset-offset:]
+		offset = st.recvOffset
+	}
+	if offset == st.recvOffset && len(st.chunks) == 0 {
+		st.readable = append(st.readable, data...)
+		st.recvOffset = end
+		return
+	}
+
+	start := offset
+	i := sort.Search(len(st.chunks), func(i int) bool { return st.chunks[i].end() > offset })
+	for offset < end {
+		if i < len(st.chunks) && st.chunks[i].offset <= offset {
+			offset = st.chunks[i].end()
+			i++
+			continue
+		}
+		pieceEnd := end
+		if i < len(st.chunks) {
+			pieceEnd = min(end, st.chunks[i].offset)
+		}
+		piece := streamChunk{offset: offset, data: slices.Clone(data[offset-start : pieceEnd-start])}
+		st.chunks = slices.Insert(st.chunks, i, piece)
+		i++
+		offset = pieceEnd
+	}
+
+	n := 0
+	for ; n < len(st.chunks) && st.chunks[n].offset == st.recvOffset; n++ {
+		st.readable = append(st.readable, st.chunks[n].data...)
+		st.recvOffset = st.chunks[n].end()
+	}
+	st.chunks = st.chunks[n:]
+}
+
+// release menghapus stream dari tabel setelah kedua arah selesai.
+func (t *streamTable) release(st *Stream) {
+	if st.sendClosed && st.eofRead {
+		t.remove(st)
+	}
+}
+
+func (t *streamTable) reset(st *Stream, err error) {
+	st.resetErr = err
+	st.chunks = nil
+	st.readable = nil
+	t.remove(st)
+}
+
+func (t *streamTable) remove(st *Stream) {
+	if _, ok := t.streams[st.id]; !ok {
+		return
+	}
+	delete(t.streams, st.id)
+	if t.isRemote(st.id) {
+		t.remoteOpen--
+	}
+}
+
+func (t *streamTable) closeAll(err error) {
+	for _, st := range t.streams {
+		st.resetErr = err
+	}
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// chunkBytes mengembalikan jumlah byte yang ditahan st di luar readable.
+func chunkBytes(st *Stream) int {
+	n := 0
+	for _, c := range st.chunks {
+		n += len(c.data)
+	}
+	return n
+}
+
+func TestStreamReceive(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	type piece struct{ start, end int }
+	tests := []struct {
+		name   string
+		pieces []piece
+	}{
+		{"berurutan", []piece{{0, 10}, {10, 20}, {20, 36}}},
+		{"terbalik", []piece{{20, 36}, {10, 20}, {0, 10}}},
+		{"duplikat", []piece{{10, 20}, {10, 20}, {0, 10}, {0, 10}, {20, 36}}},
+		{"tumpang tindih", []piece{{5, 15}, {10, 30}, {25, 36}, {0, 12}}},
+		{"menutupi potongan lain", []piece{{4, 6}, {10, 12}, {20, 22}, {2, 30}, {0, 36}}},
+	}
+	for _, tt := range tests {
+		st := newStream(nil, 1)
+		for _, p := range tt.pieces {
+			st.receive(uint64(p.start), data[p.start:p.end])
+			if st.recvOffset != uint64(len(st.readable)) {
+				t.Fatalf("%s: recvOffset %d tidak sama dengan %d byte readable", tt.name, st.recvOffset, len(st.readable))
+			}
+			for i := 1; i < len(st.chunks); i++ {
+				if st.chunks[i-1].end() > st.chunks[i].offset {
+					t.Fatalf("%s: potongan tumpang tindih: %v", tt.name, st.chunks)
+				}
+			}
+		}
+		if !bytes.Equal(st.readable, data) || len(st.chunks) != 0 {
+			t.Errorf("%s: readable %q, %d potongan tersisa", tt.name, st.readable, len(st.chunks))
+		}
+	}
+}
+
+func TestStreamReceiveBoundedByWindow(t *testing.T) {
+	st := newStream(nil, 1)
+	data := make([]byte, StreamWindowSize-1)
+	// Frame yang tumpang tindih di setiap offset hanya menambah byte yang belum tercakup
+	for offset := 1; offset < StreamWindowSize; offset += 4096 {
+		st.receive(uint64(offset), data[:StreamWindowSize-offset])
+	}
+	if held := chunkBytes(st); held > StreamWindowSize {
+		t.Fatalf("%d byte ditahan, melebihi jendela %d", held, StreamWindowSize)
+	}
+	st.receive(0, []byte{0})
+	if len(st.readable) != StreamWindowSize || len(st.chunks) != 0 {
+		t.Errorf("%d byte bersambung, %d potongan tersisa", len(st.readable), len(st.chunks))
+	}
+}
@@ -0,0 +1,244 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"syscall"
+	"time"
+)
+
+// TimingMode menentukan kapan datagram yang sudah disegel benar-benar dikirim.
+type TimingMode int
+
+const (
+	// TimingImmediate mengirim setiap datagram begitu disegel.
+	TimingImmediate TimingMode = iota
+	// TimingJitter menunda setiap datagram secara acak sampai MaxDelay tanpa mengubah urutannya.
+	TimingJitter
+	// TimingConstant mengirim tepat satu datagram berukuran PacketSize setiap Interval; slot
+	// yang tidak terisi data diisi chaff.
+	TimingConstant
+)
+
+const (
+	// DefaultJitterDelay adalah anggaran latensi mode jitter jika konfigurasi tidak mengaturnya.
+	DefaultJitterDelay = 20 * time.Millisecond
+	// DefaultConstantDelay adalah anggaran latensi antrean mode constant.
+	DefaultConstantDelay = 100 * time.Millisecond
+	// DefaultConstantInterval adalah jarak antar datagram mode constant.
+	DefaultConstantInterval = 20 * time.Millisecond
+	// minConstantPacketSize adalah ukuran datagram terkecil mode constant yang masih
+	// menyisakan ruang untuk ACK dan data.
+	minConstantPacketSize = 256
+)
+
+// Timing mengatur penyamaran waktu kirim satu sesi. Nilai nol berarti TimingImmediate.
+type Timing struct {
+	Mode       TimingMode
+	MaxDelay   time.Duration // Anggaran latensi tambahan yang boleh ditanggung aplikasi
+	Interval   time.Duration // Mode constant: jarak antar datagram
+	PacketSize int           // Mode constant: ukuran setiap datagram
+}
+
+// NewTiming membuat Timing dari nama mode di konfigurasi:
+//
+//   - "none" atau kosong: tanpa penundaan
+//   - "jitter": setiap datagram ditunda acak antara nol dan maxDelay
+//   - "constant": satu datagram berukuran size setiap interval, diisi chaff jika kosong;
+//     pengirim aplikasi ditahan jika antrean melebihi maxDelay
+//
+// Nilai nol berarti default mode tersebut.
+func NewTiming(mode string, maxDelay, interval time.Duration, size int) (Timing, error) {
+	if maxDelay < 0 || interval < 0 || size < 0 {
+		return Timing{}, fmt.Errorf("parameter timing tidak boleh negatif")
+	}
+	switch mode {
+	case "", "none":
+		return Timing{}, nil
+	case "jitter":
+		if maxDelay == 0 {
+			maxDelay = DefaultJitterDelay
+		}
+		return Timing{Mode: TimingJitter, MaxDelay: maxDelay}, nil
+	case "constant":
+		if maxDelay == 0 {
+			maxDelay = DefaultConstantDelay
+		}
+		if interval == 0 {
+			interval = DefaultConstantInterval
+		}
+		if size == 0 {
+			size = BasePLPMTU
+		}
+		if size < minConstantPacketSize || size > BasePLPMTU {
+			return Timing{}, fmt.Errorf("ukuran paket timing constant harus %d-%d byte: %d", minConstantPacketSize, BasePLPMTU, size)
+		}
+		return Timing{Mode: TimingConstant, MaxDelay: maxDelay, Interval: interval, PacketSize: size}, nil
+	default:
+		return Timing{}, fmt.Errorf("mode timing tidak dikenal: %q", mode)
+	}
+}
+
+// queuedPacket adalah datagram tersegel yang menunggu giliran dikirim.
+type queuedPacket struct {
+	packet []byte
+	at     time.Time // Mode jitter: waktu paling awal datagram boleh dikirim
+}
+
+// sendQueue menahan datagram tersegel di antara Session dan hook Output agar waktu kirimnya
+// tidak mengikuti waktu aplikasi menulis atau waktu paket peer tiba. Urutan datagram tidak
+// pernah berubah, sehingga rantai hash tetap tersambung di penerima.
+type sendQueue struct {
+	timing  Timing
+	packets []queuedPacket
+	release func() // Dijalankan timer; nil timer dibuat saat pertama kali dinyalakan
+	timer   *time.Timer
+	armed   bool
+	next    time.Time // Mode jitter: waktu kirim datagram terakhir; mode constant: slot berikutnya
+}
+
+// constant melaporkan apakah antrean berjalan dalam mode TimingConstant.
+func (q *sendQueue) constant() bool {
+	return q != nil && q.timing.Mode == TimingConstant
+}
+
+// hasRoom melaporkan apakah aplikasi boleh menambah datagram ke antrean. Mode constant
+// menahan pengirim setelah antrean setara anggaran latensinya; mode jitter tidak menumpuk
+// lebih dari yang diizinkan pacer.
+func (q *sendQueue) hasRoom() bool {
+	if !q.constant() {
+		return true
+	}
+	return len(q.packets) < max(1, int(q.timing.MaxDelay/q.timing.Interval))
+}
+
+// pop mengeluarkan datagram terdepan.
+func (q *sendQueue) pop() []byte {
+	packet := q.packets[0].packet
+	q.packets[0] = queuedPacket{}
+	q.packets = q.packets[1:]
+	return packet
+}
+
+// arm menyalakan timer antrean untuk berbunyi setelah d.
+func (q *sendQueue) arm(d time.Duration) {
+	q.armed = true
+	if q.timer == nil {
+		q.timer = time.AfterFunc(d, q.release)
+		return
+	}
+	q.timer.Reset(d)
+}
+
+// stop mematikan timer antrean.
+func (q *sendQueue) stop() {
+	if q != nil && q.timer != nil {
+		q.timer.Stop()
+		q.armed = false
+	}
+}
+
+// startQueue membuat antrean kirim untuk timing, atau nil untuk TimingImmediate. Jam mode
+// constant langsung berjalan sejak sesi dibuat.
+func (s *Session) startQueue(timing Timing, now time.Time) *sendQueue {
+	if timing.Mode == TimingImmediate {
+		return nil
+	}
+	q := &sendQueue{timing: timing, release: s.releaseQueued, next: now}
+	if timing.Mode == TimingConstant {
+		q.next = now.Add(timing.Interval)
+		q.arm(timing.Interval)
+	}
+	return q
+}
+
+// output mengirim datagram lewat antrean kirim, atau langsung ke hook Output jika
+// penyamaran waktu tidak aktif. Error dari datagram yang diantrekan hanya dicatat.
+func (s *Session) output(packet []byte, now time.Time) error {
+	q := s.queue
+	if q == nil {
+		return s.hooks.Output(packet)
+	}
+	switch q.timing.Mode {
+	case TimingJitter:
+		at := now.Add(time.Duration(rand.Int64N(int64(q.timing.MaxDelay) + 1)))
+		if at.Before(q.next) {
+			at = q.next
+		}
+		q.next = at
+		q.packets = append(q.packets, queuedPacket{packet: packet, at: at})
+		if !q.armed {
+			q.arm(at.Sub(now))
+		}
+	case TimingConstant:
+		q.packets = append(q.packets, queuedPacket{packet: packet})
+	}
+	return nil
+}
+
+// releaseQueued dijalankan timer antrean: mode jitter mengirim semua datagram yang sudah
+// waktunya, mode constant mengirim tepat satu datagram, chaff jika antrean kosong.
+func (s *Session) releaseQueued() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queue
+	q.armed = false
+	if s.closeErr != nil {
+		return
+	}
+	now := time.Now()
+	switch q.timing.Mode {
+	case TimingJitter:
+		for len(q.packets) > 0 && !q.packets[0].at.After(now) {
+			s.outputQueued(q.pop())
+		}
+		if len(q.packets) > 0 {
+			q.arm(q.packets[0].at.Sub(now))
+		}
+	case TimingConstant:
+		if len(q.packets) == 0 && !s.sendChaff(now) {
+			if s.ackPending {
+				s.transmitAck(now)
+			}
+			if len(q.packets) == 0 && s.lastSent != nil {
+				// Jendela peer penuh sehingga chaff dan ACK tidak punya nomor urut; datagram
+				// terakhir dikirim ulang agar slot tetap terisi tanpa memakai jendela peer.
+				// Peer menganggapnya duplikat, atau menerimanya jika aslinya hilang.
+				q.packets = append(q.packets, queuedPacket{packet: s.lastSent})
+			}
+		}
+		if len(q.packets) > 0 {
+			s.outputQueued(q.pop())
+		}
+		// Setiap slot mendapat tepat satu datagram; slot yang terlewat karena penjadwal
+		// terlambat dikejar alih-alih dilewati
+		q.next = q.next.Add(q.timing.Interval)
+		q.arm(max(q.next.Sub(now), 0))
+	}
+	s.cond.Broadcast()
+}
+
+// flushQueue mengirim semua datagram yang masih diantrekan tanpa menunggu dan menghentikan
+// timer antrean. Dipakai saat sesi ditutup.
+func (s *Session) flushQueue() {
+	q := s.queue
+	if q == nil {
+		return
+	}
+	q.stop()
+	for len(q.packets) > 0 {
+		s.outputQueued(q.pop())
+	}
+}
+
+// outputQueued mengirim satu datagram dari antrean. Probe PMTU yang terlalu besar dan chaff
+// yang dikirim jam mode constant sebelum alamat peer diketahui tidak dicatat; keduanya tak
+// andal, dan paket andal yang gagal dikirim ulang setelah RTO.
+func (s *Session) outputQueued(packet []byte) {
+	err := s.hooks.Output(packet)
+	if err != nil && !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, ErrNoReturnAddress) {
+		log.Printf("[Session %s] Gagal mengirim paket dari antrean: %v", s.id, err)
+	}
+}
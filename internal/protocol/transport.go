@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"net"
+	"time"
+)
+
+// PacketConn adalah satu port lokal yang menerima dan mengirim datagram. Method-nya sama
+// dengan *net.UDPConn, sehingga socket UDP biasa langsung memenuhinya.
+type PacketConn interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+	LocalAddr() net.Addr
+	// SetReadDeadline membuat ReadFromUDP yang sedang atau akan menunggu kembali dengan
+	// error net.Error yang Timeout() bernilai true setelah t.
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// Transport adalah jaringan tempat sesi SecureFlow berjalan: membuka port yang dipakai
+// untuk menerima dan mengirim datagram. UDPTransport memakai socket sungguhan;
+// MemoryNetwork menyediakan jaringan dalam memori dengan loss, reorder, duplikasi, dan
+// latensi untuk pengujian.
+type Transport interface {
+	// Listen membuka port lokal addr. Port 0 memilih port efemeral dan IP kosong berarti
+	// semua alamat lokal.
+	Listen(addr *net.UDPAddr) (PacketConn, error)
+}
+
+// DontFragment menyalakan bit Don't Fragment pada port yang dibuka Transport.Listen jika
+// port itu socket UDP, agar paket sesi yang dikirim lewat port tersebut tetap cocok untuk
+// probe PMTU. Port MemoryNetwork sudah menerapkan MTU link sendiri.
+func DontFragment(conn PacketConn) error {
+	if masked, ok := conn.(*MaskedConn); ok {
+		conn = masked.PacketConn
+	}
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		return SetDontFragment(udpConn)
+	}
+	return nil
+}
+
+// UDPTransport adalah Transport di atas socket UDP sistem operasi.
+type UDPTransport struct{}
+
+// Listen membuka socket UDP di addr.
+func (UDPTransport) Listen(addr *net.UDPAddr) (PacketConn, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
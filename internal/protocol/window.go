@@ -0,0 +1,242 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Ukuran jendela penerimaan, yaitu jumlah nomor urut di depan yang boleh ditahan di buffer
+// reorder. Jendela membatasi paket yang boleh belum dikonfirmasi, jadi harus lebih besar dari
+// bandwidth-delay product jalur agar jendela kongesti yang menentukan laju kirim.
+const (
+	// DefaultReceiveWindow dipakai jika konfigurasi tidak mengatur ukuran jendela.
+	DefaultReceiveWindow = 1024
+	// MinReceiveWindow adalah jendela terkecil yang boleh dipakai. Pengirim menganggap
+	// jendela peer sebesar ini sampai peer mengumumkan ukurannya.
+	MinReceiveWindow = 64
+	// MaxReceiveWindow membatasi memori buffer reorder dan connection ID per sesi.
+	MaxReceiveWindow = 8192
+)
+
+var (
+	ErrDuplicatePacket = errors.New("paket duplikat")
+	ErrOutOfWindow     = errors.New("nomor urut di luar jendela penerimaan")
+	ErrHashChain       = errors.New("rantai hash putus")
+)
+
+// ReceivedPacket adalah paket terautentikasi yang menunggu giliran di ReceiveWindow.
+type ReceivedPacket struct {
+	Seq      uint64
+	PrevHash [HashSize]byte // PrevHash dari header paket, setelah header protection dibuka
+	Hash     [HashSize]byte // BLAKE3 dari seluruh byte paket
+	Message  *DataMessage
+}
+
+// ReceiveWindow menyusun ulang paket yang datang tidak berurutan dan memverifikasi rantai
+// hash setelah urutannya bersambung. Paket di bawah Next() atau yang sudah ada di buffer
+// ditolak sebagai replay; paket yang terlalu jauh di depan ditolak agar memori terbatas.
+type ReceiveWindow struct {
+	size     uint64
+	next     uint64
+	lastHash [HashSize]byte
+	anchored bool // false setelah resinkronisasi sampai paket berikutnya menjadi jangkar baru
+	buffer   map[uint64]*ReceivedPacket
+	skipped  map[uint64]bool // Nomor urut di bawah next yang dilompati tanpa pernah diterima
+}
+
+// NewReceiveWindow membuat jendela sebesar size nomor urut yang mengharapkan nomor urut 0
+// dengan hash awal initialHash.
+func NewReceiveWindow(initialHash [HashSize]byte, size int) *ReceiveWindow {
+	return &ReceiveWindow{
+		size:     uint64(size),
+		lastHash: initialHash,
+		anchored: true,
+		buffer:   make(map[uint64]*ReceivedPacket),
+		skipped:  make(map[uint64]bool),
+	}
+}
+
+// Size mengembalikan ukuran jendela dalam nomor urut.
+func (w *ReceiveWindow) Size() int {
+	return int(w.size)
+}
+
+// Next mengembalikan nomor urut berikutnya yang ditunggu untuk diteruskan ke aplikasi.
+func (w *ReceiveWindow) Next() uint64 {
+	return w.next
+}
+
+// Buffered mengembalikan jumlah paket yang ditahan menunggu celah terisi.
+func (w *ReceiveWindow) Buffered() int {
+	return len(w.buffer)
+}
+
+// Insert memasukkan paket yang sudah lolos AEAD dan mengembalikan paket-paket yang kini
+// bersambung, sesuai urutan. ErrDuplicatePacket berarti paket sudah pernah diterima (ACK-nya
+// mungkin hilang). Jika pesan membawa ForwardSeq, celah di bawahnya dianggap
+// hilang permanen dan rantai hash disinkronkan ulang pada paket pertama sesudahnya. Paket tak
+// andal yang tiba setelah nomor urutnya dilompati diterima sekali tanpa diteruskan (tidak
+// mengembalikan paket dan error), agar frame dan ACK-nya tetap bisa diproses pemanggil.
+func (w *ReceiveWindow) Insert(p *ReceivedPacket) ([]*ReceivedPacket, error) {
+	if p.Message != nil && p.Message.ForwardSeq > p.Seq {
+		return nil, fmt.Errorf("ForwardSeq #%d melewati paket #%d", p.Message.ForwardSeq, p.Seq)
+	}
+	if p.Seq < w.next {
+		if w.skipped[p.Seq] {
+			delete(w.skipped, p.Seq)
+			return nil, nil
+		}
+		return nil, ErrDuplicatePacket
+	}
+	if p.Seq >= w.next+w.size {
+		return nil, fmt.Errorf("%w: #%d (berikutnya #%d)", ErrOutOfWindow, p.Seq, w.next)
+	}
+	if _, ok := w.buffer[p.Seq]; ok {
+		return nil, ErrDuplicatePacket
+	}
+	w.buffer[p.Seq] = p
+	var forward uint64
+	if p.Message != nil {
+		forward = p.Message.ForwardSeq
+	}
+	return w.drain(forward)
+}
+
+// drain meneruskan paket yang bersambung mulai dari next sambil memverifikasi rantai hash.
+// Celah di bawah forward dinyatakan hilang oleh pengirim: celah itu dilompati, paket yang
+// sudah ditahan di bawahnya tetap diteruskan, dan rantai hash dijangkarkan ulang sesudah
+// setiap celah.
+func (w *ReceiveWindow) drain(forward uint64) ([]*ReceivedPacket, error) {
+	var delivered []*ReceivedPacket
+	for {
+		p, ok := w.buffer[w.next]
+		if !ok {
+			if w.next >= forward {
+				return delivered, nil
+			}
+			w.skipped[w.next] = true
+			w.next++
+			w.anchored = false
+			w.pruneSkipped()
+			continue
+		}
+		delete(w.buffer, w.next)
+		if w.anchored && p.PrevHash != w.lastHash {
+			// Paket ini lolos AEAD tetapi tidak menyambung: keadaan pengirim rusak atau tidak
+			// jujur, sehingga pemanggil sebaiknya memutus sesi
+			return delivered, fmt.Errorf("%w pada paket #%d", ErrHashChain, p.Seq)
+		}
+		w.lastHash = p.Hash
+		w.anchored = true
+		w.next++
+		delivered = append(delivered, p)
+	}
+}
+
+// pruneSkipped melupakan nomor urut yang dilompati setelah berada lebih dari satu jendela di
+// bawah next. Connection ID-nya sudah tidak dikenali lagi sehingga paket itu tidak mungkin
+// tiba di sini.
+func (w *ReceiveWindow) pruneSkipped() {
+	if w.next < w.size {
+		return
+	}
+	for seq := range w.skipped {
+		if seq < w.next-w.size {
+			delete(w.skipped, seq)
+		}
+	}
+}
+
+// PeerWindow memperkirakan batas bawah ReceiveWindow.Next() milik peer dari ACK yang
+// diterima, agar pengirim tidak mengirim paket yang pasti ditolak peer karena berada di luar
+// jendela penerimaan dan jendela connection ID-nya. Setelah peer menerima sebuah paket,
+// Next() peer paling tidak sama dengan ForwardSeq paket itu; paket yang di-ACK secara
+// bersambung juga sudah dilewati.
+type PeerWindow struct {
+	size  uint64            // Ukuran jendela penerimaan peer
+	next  uint64            // Batas bawah Next() peer
+	sent  map[uint64]uint64 // Paket mulai dari next yang belum di-ACK → ForwardSeq-nya
+	end   uint64            // Nomor urut berikutnya yang akan dikirim
+	acked uint64            // Satu lewat nomor urut tertinggi yang pernah di-ACK peer
+}
+
+// NewPeerWindow membuat PeerWindow untuk sesi yang dimulai dari nomor urut 0. Jendela peer
+// dianggap MinReceiveWindow sampai peer mengumumkan ukurannya lewat SetSize.
+func NewPeerWindow() *PeerWindow {
+	return &PeerWindow{size: MinReceiveWindow, sent: make(map[uint64]uint64)}
+}
+
+// SetSize mencatat ukuran jendela yang diumumkan peer, dibatasi ke rentang yang valid.
+func (w *PeerWindow) SetSize(size uint64) {
+	w.size = min(max(size, MinReceiveWindow), MaxReceiveWindow)
+}
+
+// Size mengembalikan ukuran jendela penerimaan peer.
+func (w *PeerWindow) Size() int {
+	return int(w.size)
+}
+
+// AckReserve mengembalikan jumlah nomor urut di ujung jendela penerimaan peer yang hanya
+// boleh dipakai ACK murni. Tanpa cadangan ini, dua sisi yang sama-sama memenuhi jendela
+// dengan data tidak bisa lagi mengirim ACK yang membebaskan jendela lawannya.
+func (w *PeerWindow) AckReserve() uint64 {
+	return w.size / 4
+}
+
+// Confirmed mengembalikan nomor urut tertinggi yang pasti sudah diterima atau dilompati
+// peer, atau false jika belum ada.
+func (w *PeerWindow) Confirmed() (uint64, bool) {
+	return w.next - 1, w.next > 0
+}
+
+// OnSent mencatat paket seq yang membawa forward sebagai ForwardSeq.
+func (w *PeerWindow) OnSent(seq, forward uint64) {
+	w.sent[seq] = forward
+	w.end = seq + 1
+}
+
+// OnAck memajukan batas bawah dari rentang SACK peer. Hanya bagian rentang yang jatuh di
+// antara batas bawah dan paket terakhir yang diperiksa, sehingga biayanya tidak bergantung
+// pada lebar rentang yang sudah lama di-ACK.
+func (w *PeerWindow) OnAck(ranges []AckRange) {
+	start := w.next
+	for _, r := range ranges {
+		if r.End < w.next || r.Start >= w.end {
+			continue
+		}
+		for seq := max(r.Start, w.next); seq <= min(r.End, w.end-1); seq++ {
+			if forward, ok := w.sent[seq]; ok {
+				delete(w.sent, seq)
+				w.next = max(w.next, forward)
+				w.acked = max(w.acked, seq+1)
+			}
+		}
+	}
+	for w.next < w.end {
+		if _, waiting := w.sent[w.next]; waiting {
+			break
+		}
+		w.next++
+	}
+	for seq := start; seq < w.next; seq++ {
+		delete(w.sent, seq)
+	}
+}
+
+// InWindow mengembalikan true jika paket seq pasti masih berada di jendela penerimaan peer
+// dengan menyisakan reserve nomor urut di ujungnya.
+func (w *PeerWindow) InWindow(seq uint64, reserve uint64) bool {
+	return seq+reserve < w.next+w.size
+}
+
+// Blocked melaporkan apakah peer sudah menerima paket di atas batas bawah Next()-nya. Jika
+// nomor urut di bawahnya adalah ACK murni yang hilang dan tidak ada lagi paket yang membawa
+// ForwardSeq lebih baru, peer menahan paket itu selamanya di belakang celah.
+func (w *PeerWindow) Blocked() bool {
+	return w.acked > w.next
+}
+
+// Unconfirmed mengembalikan jumlah nomor urut terkirim yang belum pasti dilewati peer.
+func (w *PeerWindow) Unconfirmed() int {
+	return int(w.end - w.next)
+}
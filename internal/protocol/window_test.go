@@ -0,0 +1,182 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+// chainPackets membuat n paket mulai dari nomor urut 0 yang menyambung rantai hash dari hash nol.
+func chainPackets(n int) []*ReceivedPacket {
+	packets := make([]*ReceivedPacket, n)
+	var prev [HashSize]byte
+	for i := range packets {
+		hash := [HashSize]byte{byte(i + 1), 0xff}
+		packets[i] = &ReceivedPacket{Seq: uint64(i), PrevHash: prev, Hash: hash, Message: &DataMessage{Seq: uint64(i)}}
+		prev = hash
+	}
+	return packets
+}
+
+func deliveredSeqs(packets []*ReceivedPacket) []uint64 {
+	seqs := make([]uint64, len(packets))
+	for i, p := range packets {
+		seqs[i] = p.Seq
+	}
+	return seqs
+}
+
+func TestReceiveWindowReorder(t *testing.T) {
+	w := NewReceiveWindow([HashSize]byte{}, MinReceiveWindow)
+	packets := chainPackets(5)
+	steps := []struct {
+		seq       int
+		delivered []uint64
+		err       error
+	}{
+		{2, []uint64{}, nil},
+		{0, []uint64{0}, nil},
+		{2, nil, ErrDuplicatePacket},
+		{0, nil, ErrDuplicatePacket},
+		{1, []uint64{1, 2}, nil},
+		{4, []uint64{}, nil},
+		{3, []uint64{3, 4}, nil},
+	}
+	for _, step := range steps {
+		delivered, err := w.Insert(packets[step.seq])
+		if !errors.Is(err, step.err) {
+			t.Fatalf("Insert(#%d): error %v, diharapkan %v", step.seq, err, step.err)
+		}
+		if got := deliveredSeqs(delivered); step.err == nil && !equalSeqs(got, step.delivered) {
+			t.Fatalf("Insert(#%d) meneruskan %v, diharapkan %v", step.seq, got, step.delivered)
+		}
+	}
+	if w.Next() != 5 || w.Buffered() != 0 {
+		t.Errorf("Next %d, Buffered %d; diharapkan 5 dan 0", w.Next(), w.Buffered())
+	}
+}
+
+func TestReceiveWindowRejects(t *testing.T) {
+	w := NewReceiveWindow([HashSize]byte{}, MinReceiveWindow)
+	far := &ReceivedPacket{Seq: MinReceiveWindow, Message: &DataMessage{Seq: MinReceiveWindow}}
+	if _, err := w.Insert(far); !errors.Is(err, ErrOutOfWindow) {
+		t.Errorf("paket di luar jendela: error %v", err)
+	}
+	bad := &ReceivedPacket{Seq: 3, Message: &DataMessage{Seq: 3, ForwardSeq: 4}}
+	if _, err := w.Insert(bad); err == nil {
+		t.Error("ForwardSeq di atas nomor urut paket diterima")
+	}
+	forged := chainPackets(1)[0]
+	forged.PrevHash[0] ^= 1
+	if _, err := w.Insert(forged); !errors.Is(err, ErrHashChain) {
+		t.Errorf("paket yang tidak menyambung: error %v", err)
+	}
+}
+
+func TestReceiveWindowForwardSeqResync(t *testing.T) {
+	w := NewReceiveWindow([HashSize]byte{}, MinReceiveWindow)
+	packets := chainPackets(8)
+	w.Insert(packets[0])
+	w.Insert(packets[2]) // Ditahan di belakang celah #1
+
+	// Paket #5 menyatakan #1-#4 tidak akan dikirim ulang. #2 tetap diteruskan, dan rantai
+	// hash dijangkarkan ulang di #5 walaupun #3 dan #4 tidak pernah diterima.
+	p5 := packets[5]
+	p5.Message.ForwardSeq = 5
+	p5.PrevHash = [HashSize]byte{0xee}
+	delivered, err := w.Insert(p5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deliveredSeqs(delivered); !equalSeqs(got, []uint64{2, 5}) {
+		t.Fatalf("diteruskan %v, diharapkan [2 5]", got)
+	}
+	// Setelah dijangkarkan ulang, rantai kembali diperiksa
+	if delivered, err := w.Insert(packets[6]); err != nil || len(delivered) != 1 {
+		t.Fatalf("paket #6 yang menyambung: %v, %v", deliveredSeqs(delivered), err)
+	}
+
+	// Paket tak andal yang tiba setelah dilompati diterima sekali tanpa diteruskan
+	if delivered, err := w.Insert(packets[3]); err != nil || len(delivered) != 0 {
+		t.Errorf("paket #3 yang terlambat: %v, %v", deliveredSeqs(delivered), err)
+	}
+	if _, err := w.Insert(packets[3]); !errors.Is(err, ErrDuplicatePacket) {
+		t.Errorf("paket #3 kedua: error %v, diharapkan duplikat", err)
+	}
+}
+
+func TestPeerWindow(t *testing.T) {
+	w := NewPeerWindow()
+	if w.Size() != MinReceiveWindow {
+		t.Fatalf("ukuran awal %d, diharapkan %d", w.Size(), MinReceiveWindow)
+	}
+	if _, ok := w.Confirmed(); ok {
+		t.Error("Confirmed sebelum ada ACK")
+	}
+	for seq := range uint64(MinReceiveWindow) {
+		forward := uint64(0)
+		if seq == 10 {
+			forward = 10 // Paket #10 melompati #0-#9
+		}
+		w.OnSent(seq, forward)
+	}
+	if w.InWindow(MinReceiveWindow, 0) || !w.InWindow(MinReceiveWindow-1, 0) {
+		t.Error("batas jendela sebelum ACK salah")
+	}
+
+	// ACK #1-#3 belum memajukan batas bawah karena #0 belum di-ACK
+	w.OnAck([]AckRange{{1, 3}})
+	if w.Unconfirmed() != MinReceiveWindow || !w.Blocked() {
+		t.Errorf("setelah SACK 1-3: Unconfirmed %d, Blocked %v", w.Unconfirmed(), w.Blocked())
+	}
+	// ACK paket #10 memastikan peer sudah melewati #0-#10
+	w.OnAck([]AckRange{{10, 10}})
+	if confirmed, ok := w.Confirmed(); !ok || confirmed != 10 {
+		t.Errorf("Confirmed = %d, %v; diharapkan 10", confirmed, ok)
+	}
+	if !w.InWindow(MinReceiveWindow+10, 0) || w.InWindow(MinReceiveWindow+11, 0) {
+		t.Error("batas jendela tidak bergeser setelah ACK")
+	}
+
+	w.SetSize(1 << 40)
+	if w.Size() != MaxReceiveWindow {
+		t.Errorf("ukuran diumumkan terlalu besar menjadi %d, diharapkan %d", w.Size(), MaxReceiveWindow)
+	}
+	w.SetSize(1)
+	if w.Size() != MinReceiveWindow || w.AckReserve() != MinReceiveWindow/4 {
+		t.Errorf("ukuran diumumkan terlalu kecil menjadi %d", w.Size())
+	}
+}
+
+func TestConnIDWindowSlide(t *testing.T) {
+	key := [HashSize]byte{7}
+	w := NewConnIDWindow(key)
+	added, removed := w.Slide(ConnIDRange(0, MinReceiveWindow))
+	if len(added) != MinReceiveWindow || len(removed) != 0 {
+		t.Fatalf("slide awal: %d ditambah, %d dihapus", len(added), len(removed))
+	}
+	added, removed = w.Slide(ConnIDRange(MinReceiveWindow+5, MinReceiveWindow))
+	if len(added) != MinReceiveWindow+5 || len(removed) != 5 {
+		t.Fatalf("slide kedua: %d ditambah, %d dihapus", len(added), len(removed))
+	}
+	for seq, want := range map[uint64]bool{4: false, 5: true, 2*MinReceiveWindow + 4: true, 2*MinReceiveWindow + 5: false} {
+		got, ok := w.Lookup(DeriveConnID(key, seq))
+		if ok != want || (ok && got != seq) {
+			t.Errorf("Lookup #%d = %d, %v; diharapkan dikenali %v", seq, got, ok, want)
+		}
+	}
+	if len(w.IDs()) != 2*MinReceiveWindow {
+		t.Errorf("%d ID disimpan, diharapkan %d", len(w.IDs()), 2*MinReceiveWindow)
+	}
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,541 @@
+package secureflow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+const (
+	// maxHopSockets membatasi jumlah socket port hop yang dibuka Listener. Rentang yang lebih
+	// besar harus memakai mode redirect.
+	maxHopSockets = 4096
+	// sessionIdleTimeout adalah waktu tanpa paket valid sebelum sesi ditutup.
+	sessionIdleTimeout = 2 * time.Minute
+	reapInterval       = 10 * time.Second
+	// acceptBacklog adalah jumlah sesi baru yang boleh menunggu Accept. Handshake baru
+	// diabaikan selama antrean penuh.
+	acceptBacklog = 64
+	// reassemblyMemory adalah total byte fragmen pesan belum lengkap yang boleh ditahan semua
+	// sesi Listener bersama-sama.
+	reassemblyMemory = 256 << 20
+)
+
+// errAmplificationLimit menandai balasan handshake yang tidak dikirim karena batas
+// anti-amplifikasi.
+var errAmplificationLimit = errors.New("batas anti-amplifikasi terlampaui")
+
+// Listener menerima sesi SecureFlow di satu port handshake. Paket data semua sesi diterima
+// di sekumpulan socket bersama, satu per port di rentang PortHopping, dan diteruskan ke
+// sesinya lewat connection ID. Dalam mode redirect, rentang itu dialihkan firewall ke port
+// handshake sehingga hanya ada satu socket.
+type Listener struct {
+	config       *Config
+	transport    Transport
+	conn         PacketConn   // Port handshake
+	hops         []PacketConn // Port hop; kosong dalam mode redirect
+	identity     *crypto.StaticKeyPair
+	psk          [crypto.KeySize]byte
+	replayFilter *protocol.ReplayFilter
+	cookies      *protocol.CookieGuard
+	// Batas laju per IP/subnet untuk handshake dan paket data, serta batas anti-amplifikasi
+	// untuk balasan handshake ke alamat yang belum tervalidasi
+	handshakeLimit *protocol.RateLimiter
+	packetLimit    *protocol.RateLimiter
+	amplification  *protocol.AmplificationLimiter
+	reassembly     *protocol.ReassemblyBudget
+	// Paket yang dibuang tanpa dicatat satu per satu agar pemindai atau pemalsu alamat tidak
+	// bisa membanjiri log; reapIdle mencatat ringkasannya secara berkala
+	unknownConnIDs atomic.Int64
+	offSchedule    atomic.Int64
+
+	mu         sync.RWMutex                    // Selalu dikunci paling dalam, setelah kunci sesi
+	connIDs    map[protocol.ConnID]*serverConn // Lookup O(1) dari connection ID ke sesi
+	sessions   map[*serverConn]struct{}
+	socketsOff bool // Semua socket sudah ditutup
+
+	accept    chan *Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// serverConn adalah state server untuk satu klien.
+type serverConn struct {
+	*Conn
+	hops *protocol.HopSchedule // Jadwal port yang dipakai klien untuk sesi ini
+
+	// Dijaga kunci Session (hanya diakses dari hook)
+	returnPorts []uint16              // Port balasan terakhir yang diumumkan klien
+	returnHops  *protocol.HopSchedule // Jadwal indeks returnPorts untuk paket server→klien
+	// Alamat sumber yang teramati untuk setiap indeks returnPorts. Di balik NAT alamat ini
+	// berbeda dari port lokal yang diumumkan klien; nil berarti belum ada paket dari slot itu
+	returnAddrs []*net.UDPAddr
+	lastReturn  *net.UDPAddr // Alamat sumber paket terbaru klien
+	translated  bool         // Port sumber klien diubah NAT, jadi returnPorts tidak bisa dipakai langsung
+}
+
+// Listen mulai menerima handshake di addr (alamat port handshake). Kunci statis server
+// dimuat dari config.ServerKeyFile, atau dibuat jika file belum ada.
+func Listen(addr string, config *Config) (net.Listener, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	identity, err := crypto.LoadOrCreateStaticKey(config.ServerKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("gagal memuat kunci statis server: %w", err)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	hopRange := config.PortHopping
+	if !hopRange.Redirect && hopRange.End-hopRange.Start+1 > maxHopSockets {
+		return nil, fmt.Errorf("rentang port_hopping %d-%d melebihi %d port; pakai mode redirect", hopRange.Start, hopRange.End, maxHopSockets)
+	}
+	cookies, err := protocol.NewCookieGuard(config.CookieThreshold)
+	if err != nil {
+		return nil, err
+	}
+	transport := config.transport()
+	conn, err := transport.Listen(udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	limits := config.RateLimit.withDefaults()
+	l := &Listener{
+		config:         config,
+		transport:      transport,
+		conn:           conn,
+		identity:       identity,
+		psk:            crypto.DerivePSK(config.AuthKey),
+		replayFilter:   protocol.NewReplayFilter(),
+		cookies:        cookies,
+		handshakeLimit: protocol.NewRateLimiter(limits.HandshakesPerSecond, limits.HandshakesPerSecond*limits.SubnetFactor, limits.IPv4Prefix, limits.IPv6Prefix),
+		packetLimit:    protocol.NewRateLimiter(limits.PacketsPerSecond, limits.PacketsPerSecond*limits.SubnetFactor, limits.IPv4Prefix, limits.IPv6Prefix),
+		amplification:  protocol.NewAmplificationLimiter(limits.AmplificationFactor),
+		reassembly:     protocol.NewReassemblyBudget(reassemblyMemory),
+		connIDs:        make(map[protocol.ConnID]*serverConn),
+		sessions:       make(map[*serverConn]struct{}),
+		accept:         make(chan *Conn, acceptBacklog),
+		done:           make(chan struct{}),
+	}
+	if !hopRange.Redirect {
+		if err := l.listenHops(udpAddr.IP); err != nil {
+			l.closeSockets()
+			return nil, err
+		}
+	} else if err := protocol.DontFragment(conn); err != nil {
+		// Dalam mode redirect paket sesi dikirim dari port handshake
+		l.closeSockets()
+		return nil, err
+	}
+	go l.serve(conn)
+	for _, hop := range l.hops {
+		go l.serve(hop)
+	}
+	go l.reapIdle()
+	return l, nil
+}
+
+// listenHops membuka socket untuk setiap port di rentang PortHopping pada ip. Socket ini
+// dipakai bersama semua sesi, sehingga jumlahnya tetap berapa pun banyaknya klien.
+func (l *Listener) listenHops(ip net.IP) error {
+	for port := l.config.PortHopping.Start; port <= l.config.PortHopping.End; port++ {
+		hop, err := l.transport.Listen(&net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			return fmt.Errorf("gagal mendengarkan port hop %d: %w", port, err)
+		}
+		l.hops = append(l.hops, hop)
+		if err := protocol.DontFragment(hop); err != nil {
+			return fmt.Errorf("gagal menyalakan Don't Fragment di port hop %d: %w", port, err)
+		}
+	}
+	return nil
+}
+
+// hopConn mengembalikan socket untuk mengirim dari port hop. Dalam mode redirect hanya ada
+// socket port handshake.
+func (l *Listener) hopConn(port int) PacketConn {
+	if len(l.hops) == 0 {
+		return l.conn
+	}
+	return l.hops[port-l.config.PortHopping.Start]
+}
+
+// Accept menunggu sesi berikutnya yang menyelesaikan handshake dan mengembalikan *Conn.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close berhenti menerima handshake baru. Sesi yang sudah diterima tetap berjalan sampai
+// masing-masing ditutup; socket port handshake dan port hop ditutup setelah sesi terakhir
+// berakhir.
+func (l *Listener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = nil
+		l.mu.RLock()
+		idle := len(l.sessions) == 0
+		l.mu.RUnlock()
+		if idle {
+			l.closeSockets()
+		}
+	})
+	return err
+}
+
+// closeSockets menutup socket port handshake dan semua port hop.
+func (l *Listener) closeSockets() {
+	l.mu.Lock()
+	if l.socketsOff {
+		l.mu.Unlock()
+		return
+	}
+	l.socketsOff = true
+	l.mu.Unlock()
+	l.conn.Close()
+	for _, hop := range l.hops {
+		hop.Close()
+	}
+}
+
+// closed melaporkan apakah Close sudah dipanggil.
+func (l *Listener) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Addr mengembalikan alamat port handshake.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// PublicKey mengembalikan kunci publik statis server (hex) untuk di-pin klien.
+func (l *Listener) PublicKey() string {
+	return hex.EncodeToString(l.identity.Public[:])
+}
+
+// serve membaca conn sampai socket ditutup. Handshake hanya dilayani di port handshake,
+// sedangkan paket data diterima di port mana pun, termasuk port handshake dalam mode
+// redirect.
+func (l *Listener) serve(conn PacketConn) {
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	buffer := make([]byte, protocol.MaxPacketSize)
+	var backoff readBackoff
+	for {
+		n, remoteAddr, err := conn.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			if backoff.wait() {
+				log.Printf("[Port %d] Gagal membaca: %v", port, err)
+			}
+			continue
+		}
+		backoff.reset()
+		packet, err := protocol.Deserialize(buffer[:n])
+		if err != nil {
+			continue
+		}
+		switch {
+		case packet.Header.Type == protocol.DataMsgType:
+			if l.packetLimit.Allow(remoteAddr.IP, time.Now()) {
+				l.handlePacket(port, packet, buffer[:n], remoteAddr)
+			}
+		case packet.Header.Type == protocol.HandshakeMsgType && conn == l.conn && !l.closed():
+			l.handshake(packet.Payload, n, remoteAddr)
+		}
+	}
+}
+
+// handshake menyelesaikan handshake dari remoteAddr, yang paketnya berukuran size byte, dan
+// mengantrekan sesinya untuk Accept.
+func (l *Listener) handshake(payload []byte, size int, remoteAddr *net.UDPAddr) {
+	now := time.Now()
+	l.amplification.Received(remoteAddr, size, now)
+	if !l.handshakeLimit.Allow(remoteAddr.IP, now) {
+		return
+	}
+	// Handshake tanpa PSK yang benar dibuang diam-diam sebelum ada sesi atau port yang dialokasikan
+	hello, cookie := protocol.SplitClientHello(payload)
+	if protocol.VerifyClientHello(l.psk, hello, now) != nil {
+		return
+	}
+	// Saat dibanjiri handshake, klien harus membuktikan bahwa ia menerima paket di alamat
+	// sumbernya sebelum server menyimpan apa pun atau melakukan operasi kunci publik
+	if cookie == nil && l.cookies.UnderLoad(now) {
+		l.sendHandshake(remoteAddr, protocol.RetryMsgType, protocol.NewRetry(hello, l.cookies.Cookie(remoteAddr, now)), now)
+		return
+	}
+	if cookie != nil && l.cookies.Verify(cookie, remoteAddr, now) != nil {
+		return
+	}
+	if l.replayFilter.Check(hello, now) != nil {
+		// ClientHello yang dikirim ulang karena ServerHello hilang dijawab dengan balasan yang sama
+		if response, ok := l.replayFilter.Resend(hello, remoteAddr, now); ok {
+			l.sendHandshake(remoteAddr, protocol.HandshakeMsgType, response, now)
+		}
+		return
+	}
+	if len(l.accept) == cap(l.accept) {
+		log.Printf("Antrean Accept penuh, handshake dari %s diabaikan", remoteAddr)
+		return
+	}
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return
+	}
+	// Semua kunci sesi diturunkan dari handshake hibrida yang diautentikasi kunci statis server
+	response, keys, err := protocol.AcceptHandshake(hello, l.psk, l.identity, sessionID)
+	if err != nil {
+		log.Printf("Handshake dari %s ditolak: %v", remoteAddr, err)
+		return
+	}
+	// Sesi didaftarkan sebelum ServerHello dikirim agar paket pertama klien langsung dikenali
+	sc := l.newServerConn(sessionID, keys, remoteAddr)
+	l.mu.Lock()
+	for _, id := range sc.session.ConnIDs() {
+		l.connIDs[id] = sc
+	}
+	l.sessions[sc] = struct{}{}
+	l.mu.Unlock()
+	if err := l.sendHandshake(remoteAddr, protocol.HandshakeMsgType, response, now); err != nil {
+		log.Printf("Gagal mengirim balasan handshake ke %s: %v", remoteAddr, err)
+		sc.release()
+		return
+	}
+	l.replayFilter.Answer(hello, remoteAddr, response, now)
+	log.Printf("Handshake dengan %s berhasil. Kunci sesi hibrida dibuat.", remoteAddr)
+	l.accept <- sc.Conn
+}
+
+// sendHandshake mengirim balasan handshake ke remoteAddr jika tidak melewati batas
+// anti-amplifikasi. Alamat itu belum tervalidasi sampai klien mengirim paket data yang
+// valid, yang hanya bisa dibuat jika ServerHello benar-benar diterima di alamat tersebut.
+func (l *Listener) sendHandshake(remoteAddr *net.UDPAddr, msgType uint8, payload []byte, now time.Time) error {
+	if !l.amplification.Send(remoteAddr, protocol.PacketHeaderSize+len(payload), now) {
+		return errAmplificationLimit
+	}
+	return protocol.SendHandshake(l.conn, remoteAddr, msgType, payload)
+}
+
+// newServerConn membuat sesi server untuk klien yang baru menyelesaikan handshake.
+func (l *Listener) newServerConn(sessionID string, keys *crypto.KeySchedule, remoteAddr *net.UDPAddr) *serverConn {
+	hopRange := l.config.PortHopping
+	epoch := time.Now()
+	sc := &serverConn{
+		hops: protocol.NewHopSchedule(keys.HopSeed, hopRange.Start, hopRange.End, hopRange.interval(), epoch),
+	}
+	cc, _ := protocol.NewCongestionController(l.config.CongestionControl)
+	obfs, _ := l.config.obfuscation()
+	session := protocol.NewSession(sessionID, keys, false, cc, l.config.ReceiveWindow, obfs, protocol.SessionHooks{
+		// Paket dikirim dari port hop slot ini ke port balasan klien slot ini
+		Output: func(packet []byte) error {
+			now := time.Now()
+			to := sc.returnAddr(now)
+			if to == nil {
+				return protocol.ErrNoReturnAddress
+			}
+			_, err := l.hopConn(sc.hops.Current(now)).WriteToUDP(packet, to)
+			return err
+		},
+		OnReceive: func(msg *protocol.DataMessage, from net.Addr) {
+			udpAddr, ok := from.(*net.UDPAddr)
+			if !ok {
+				return
+			}
+			if len(msg.ReturnPorts) > 0 {
+				if len(msg.ReturnPorts) != len(sc.returnPorts) {
+					sc.returnHops = protocol.NewHopSchedule(keys.ReturnHopSeed, 0, len(msg.ReturnPorts)-1, hopRange.interval(), epoch)
+					sc.returnAddrs = make([]*net.UDPAddr, len(msg.ReturnPorts))
+				}
+				sc.returnPorts = msg.ReturnPorts
+			}
+			if sc.returnHops != nil {
+				sc.learnReturnAddr(udpAddr, hopRange.interval()/4, time.Now())
+			}
+		},
+		OnConnIDs: func(added, removed []protocol.ConnID) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, id := range removed {
+				delete(l.connIDs, id)
+			}
+			for _, id := range added {
+				l.connIDs[id] = sc
+			}
+		},
+	})
+	session.ShareReassemblyBudget(l.reassembly)
+
+	done := make(chan struct{})
+	sc.Conn = &Conn{
+		session: session,
+		local:   l.conn.LocalAddr(),
+		remote:  remoteAddr,
+		cleanup: func() {
+			close(done)
+			l.removeSession(sc)
+		},
+	}
+	go sc.tick(done)
+	return sc
+}
+
+// returnAddr mengembalikan alamat tujuan paket server→klien pada waktu now. Slot yang alamat
+// sumbernya belum teramati memakai port lokal yang diumumkan klien jika tidak ada NAT, atau
+// alamat sumber terbaru klien jika ada; klien menerima paket di port slot sebelumnya selama
+// masih dalam toleransi jadwal.
+func (sc *serverConn) returnAddr(now time.Time) *net.UDPAddr {
+	if sc.lastReturn == nil || sc.returnHops == nil {
+		return nil
+	}
+	index := sc.returnHops.Current(now)
+	if to := sc.returnAddrs[index]; to != nil {
+		return to
+	}
+	if sc.translated {
+		return sc.lastReturn
+	}
+	return &net.UDPAddr{IP: sc.lastReturn.IP, Port: int(sc.returnPorts[index]), Zone: sc.lastReturn.Zone}
+}
+
+// learnReturnAddr mencatat from sebagai alamat slot port balasan yang sedang berjalan. Klien
+// mengirim setiap paket dari socket port balasan slot saat itu, sehingga alamat sumber yang
+// teramati, termasuk hasil terjemahan NAT, adalah alamat tujuan paket server di slot yang
+// sama. Jadwal klien tertinggal sekitar satu RTT dari jadwal server, jadi paket yang tiba
+// dalam guard pertama sebuah slot mungkin dikirim pada slot sebelumnya dan hanya dipakai
+// sebagai alamat terbaru. Jika klien pindah alamat atau NAT memetakan ulang portnya, alamat
+// slot lain ikut dilupakan karena kemungkinan besar sudah tidak berlaku.
+func (sc *serverConn) learnReturnAddr(from *net.UDPAddr, guard time.Duration, now time.Time) {
+	addr := &net.UDPAddr{IP: from.IP, Port: from.Port, Zone: from.Zone}
+	moved := sc.lastReturn != nil && !sc.lastReturn.IP.Equal(addr.IP)
+	sc.lastReturn = addr
+	slot := sc.returnHops.Slot(now)
+	if slot > 0 && sc.returnHops.Slot(now.Add(-guard)) != slot {
+		if moved {
+			clear(sc.returnAddrs)
+		}
+		return
+	}
+	index := sc.returnHops.Port(slot)
+	if known := sc.returnAddrs[index]; moved || (known != nil && known.Port != addr.Port) {
+		clear(sc.returnAddrs)
+	}
+	sc.returnAddrs[index] = addr
+	if addr.Port != int(sc.returnPorts[index]) {
+		sc.translated = true
+	}
+}
+
+// removeSession menghapus sesi dan semua connection ID-nya dari tabel routing. Socket
+// ditutup jika Listener sudah ditutup dan ini sesi terakhir.
+func (l *Listener) removeSession(sc *serverConn) {
+	ids := sc.session.ConnIDs()
+	l.mu.Lock()
+	for _, id := range ids {
+		if l.connIDs[id] == sc {
+			delete(l.connIDs, id)
+		}
+	}
+	delete(l.sessions, sc)
+	idle := len(l.sessions) == 0
+	l.mu.Unlock()
+	if idle && l.closed() {
+		l.closeSockets()
+	}
+}
+
+// reapIdle menutup sesi yang terlalu lama tidak menerima paket valid dan mencatat ringkasan
+// paket yang dibuang sampai semua socket ditutup.
+func (l *Listener) reapIdle() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.mu.RLock()
+		if l.socketsOff {
+			l.mu.RUnlock()
+			return
+		}
+		l.logDropped()
+		var idle []*serverConn
+		for sc := range l.sessions {
+			if time.Since(sc.session.LastSeen()) > sessionIdleTimeout {
+				idle = append(idle, sc)
+			}
+		}
+		l.mu.RUnlock()
+		for _, sc := range idle {
+			log.Printf("[Session %s] Tidak ada paket selama %v, sesi ditutup.", sc.session.ID(), sessionIdleTimeout)
+			sc.release()
+		}
+	}
+}
+
+// logDropped mencatat ringkasan paket yang dibuang diam-diam sejak ringkasan terakhir.
+func (l *Listener) logDropped() {
+	if n := l.unknownConnIDs.Swap(0); n > 0 {
+		log.Printf("%d paket dengan connection ID tidak dikenal dibuang dalam %v terakhir.", n, reapInterval)
+	}
+	if n := l.offSchedule.Swap(0); n > 0 {
+		log.Printf("%d paket di luar jadwal hop dibuang dalam %v terakhir.", n, reapInterval)
+	}
+}
+
+// handlePacket memproses satu paket data yang diterima di port mana pun. Socket dipakai
+// bersama semua sesi, jadi port dicocokkan dengan jadwal hop sesi setelah lookup.
+func (l *Listener) handlePacket(port int, packet *protocol.SecurePacket, packetBytes []byte, remoteAddr *net.UDPAddr) {
+	// Sesi ditemukan lewat connection ID, jadi hanya satu dekripsi AEAD per paket
+	l.mu.RLock()
+	sc, found := l.connIDs[packet.Header.ConnID]
+	l.mu.RUnlock()
+	if !found {
+		l.unknownConnIDs.Add(1)
+		return
+	}
+	now := time.Now()
+	// Dalam mode redirect port tujuan asli sudah hilang setelah DNAT, jadi tidak bisa dicek
+	if !l.config.PortHopping.Redirect && !sc.hops.Accepts(port, now) {
+		l.offSchedule.Add(1)
+		return
+	}
+	err := sc.session.HandlePacket(packet, packetBytes, remoteAddr, now)
+	switch {
+	case err == nil:
+	case errors.Is(err, protocol.ErrDuplicatePacket):
+		// Retransmisi yang ACK-nya hilang atau chaff; ACK sudah dikirim ulang bila perlu
+	case sc.session.Err() != nil:
+		// Sesi ditutup oleh paket ini (rantai hash putus atau peer menutup sesi); Conn.tick
+		// melaporkan dan membersihkannya
+	default:
+		log.Printf("[Session %s] Paket dari %s ditolak: %v", sc.session.ID(), remoteAddr, err)
+	}
+}
+
+func generateSessionID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,296 @@
+package secureflow
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+// exchange mengirim satu pesan ke setiap arah antara a dan b.
+func exchange(t *testing.T, a, b *Conn) {
+	t.Helper()
+	for _, pair := range [][2]*Conn{{a, b}, {b, a}} {
+		if err := pair[0].WriteMessage([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		if message, err := pair[1].ReadMessage(); err != nil || string(message) != "ping" {
+			t.Fatalf("pesan %q, %v", message, err)
+		}
+	}
+}
+
+func TestListenerSharesHopSockets(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	ln := listen(t, network, testConfig(t))
+	hopRange := ln.config.PortHopping
+	if len(ln.hops) != hopRange.End-hopRange.Start+1 {
+		t.Fatalf("%d socket hop dibuka, diharapkan %d", len(ln.hops), hopRange.End-hopRange.Start+1)
+	}
+	for port := hopRange.Start; port <= hopRange.End; port++ {
+		if got := ln.hopConn(port).LocalAddr().(*net.UDPAddr).Port; got != port {
+			t.Errorf("hopConn(%d) memakai port %d", port, got)
+		}
+	}
+
+	// Dua sesi memakai socket yang sama; paket diteruskan ke sesinya lewat connection ID
+	first, firstAccepted := dial(t, network, ln, clientIP, testConfig(t))
+	second, secondAccepted := dial(t, network, ln, net.IPv4(10, 0, 0, 3), testConfig(t))
+	for range 3 {
+		exchange(t, first, firstAccepted)
+		exchange(t, second, secondAccepted)
+	}
+	ln.mu.RLock()
+	for id, sc := range ln.connIDs {
+		if sc.Conn != firstAccepted && sc.Conn != secondAccepted {
+			t.Errorf("connection ID %x dipetakan ke sesi yang tidak dikenal", id)
+		}
+	}
+	ln.mu.RUnlock()
+	if len(ln.hops) != hopRange.End-hopRange.Start+1 {
+		t.Errorf("jumlah socket hop berubah menjadi %d", len(ln.hops))
+	}
+}
+
+func TestListenerCountsDroppedPackets(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	config := testConfig(t)
+	ln := listen(t, network, config)
+	_, accepted := dial(t, network, ln, clientIP, testConfig(t))
+
+	// Connection ID acak di port hop hanya dihitung
+	scanner := (&Config{AuthKey: config.AuthKey, Transport: network.Host(net.IPv4(10, 0, 0, 9))}).transport()
+	conn, err := scanner.Listen(&net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	packet := &protocol.SecurePacket{
+		Header:  protocol.PacketHeader{Version: protocol.ProtocolVersion, Type: protocol.DataMsgType, ConnID: protocol.ConnID{0xde, 0xad}},
+		Nonce:   make([]byte, protocol.NonceSize),
+		Payload: make([]byte, 32),
+	}
+	data, err := packet.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		conn.WriteToUDP(data, &net.UDPAddr{IP: serverIP, Port: config.PortHopping.Start})
+	}
+	for deadline := time.Now().Add(time.Second); ln.unknownConnIDs.Load() < 5; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d paket connection ID tidak dikenal dihitung, diharapkan 5", ln.unknownConnIDs.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Connection ID sesi yang tiba di port di luar jadwalnya dibuang sebelum dekripsi
+	ln.mu.RLock()
+	var sc *serverConn
+	for id, candidate := range ln.connIDs {
+		if candidate.Conn == accepted {
+			sc, packet.Header.ConnID = candidate, id
+			break
+		}
+	}
+	ln.mu.RUnlock()
+	now := time.Now()
+	for port := config.PortHopping.Start; port <= config.PortHopping.End; port++ {
+		if !sc.hops.Accepts(port, now) {
+			ln.handlePacket(port, packet, data, &net.UDPAddr{IP: clientIP, Port: 40000})
+			break
+		}
+	}
+	if ln.offSchedule.Load() != 1 {
+		t.Errorf("%d paket di luar jadwal dihitung, diharapkan 1", ln.offSchedule.Load())
+	}
+	ln.logDropped()
+	if ln.unknownConnIDs.Load() != 0 || ln.offSchedule.Load() != 0 {
+		t.Error("logDropped tidak mereset hitungan")
+	}
+}
+
+func TestListenerRedirectUsesOneSocket(t *testing.T) {
+	config := testConfig(t)
+	config.PortHopping.Redirect = true
+	ln := listen(t, NewMemoryNetwork(1, LinkConditions{}), config)
+	if len(ln.hops) != 0 {
+		t.Errorf("%d socket hop dibuka dalam mode redirect", len(ln.hops))
+	}
+	if ln.hopConn(config.PortHopping.Start) != ln.conn {
+		t.Error("mode redirect tidak mengirim dari port handshake")
+	}
+}
+
+func TestListenerIgnoresInvalidClientHello(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	config := testConfig(t)
+	ln := listen(t, network, config)
+	keys, err := crypto.GenerateHybridKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	psk, now := crypto.DerivePSK(config.AuthKey), time.Now()
+	valid := protocol.NewClientHello(psk, keys.PublicBytes(), now)
+
+	// sendHello mengirim ClientHello dari host ip dan melaporkan apakah server membalas
+	sendHello := func(ip net.IP, hello []byte) bool {
+		t.Helper()
+		conn, err := (&Config{AuthKey: config.AuthKey, Transport: network.Host(ip)}).transport().Listen(&net.UDPAddr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := protocol.SendHandshake(conn, &net.UDPAddr{IP: serverIP, Port: 5000}, protocol.HandshakeMsgType, hello); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, _, err = conn.ReadFromUDP(make([]byte, protocol.MaxPacketSize))
+		return err == nil
+	}
+	tests := []struct {
+		name  string
+		ip    net.IP
+		hello []byte
+		reply bool
+	}{
+		{"PSK salah", clientIP, protocol.NewClientHello(crypto.DerivePSK("kunci-lain"), keys.PublicBytes(), now), false},
+		{"timestamp kedaluwarsa", clientIP, protocol.NewClientHello(psk, keys.PublicBytes(), now.Add(-protocol.MaxHandshakeAge-time.Minute)), false},
+		{"valid", clientIP, valid, true},
+		{"diputar ulang dari alamat lain", net.IPv4(10, 0, 0, 66), valid, false},
+	}
+	backlog := 0
+	for _, tt := range tests {
+		if reply := sendHello(tt.ip, tt.hello); reply != tt.reply {
+			t.Errorf("%s: dibalas %v, diharapkan %v", tt.name, reply, tt.reply)
+		}
+		if tt.reply {
+			backlog++
+		}
+		if len(ln.accept) != backlog {
+			t.Errorf("%s: %d sesi menunggu Accept, diharapkan %d", tt.name, len(ln.accept), backlog)
+		}
+	}
+}
+
+// natTransport meniru NAT yang menerjemahkan port: socket klien terlihat dari luar dengan
+// port lain dari port lokal yang dilaporkan LocalAddr. rebind memetakan ulang semua socket
+// ke port luar baru, seperti NAT yang kehilangan state-nya.
+type natTransport struct {
+	Transport
+	mu    sync.Mutex
+	conns []*natConn
+}
+
+// natConn adalah socket di balik natTransport.
+type natConn struct {
+	PacketConn
+	local *net.UDPAddr // Alamat di dalam NAT yang dilaporkan ke pemilik socket
+
+	mu      sync.Mutex
+	outside PacketConn // Socket dengan port luar yang sedang dipakai
+	closed  bool
+}
+
+func (t *natTransport) Listen(addr *net.UDPAddr) (PacketConn, error) {
+	outside, err := t.Transport.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	external := outside.LocalAddr().(*net.UDPAddr)
+	conn := &natConn{PacketConn: outside, outside: outside, local: &net.UDPAddr{IP: external.IP, Port: external.Port + 10000}}
+	t.mu.Lock()
+	t.conns = append(t.conns, conn)
+	t.mu.Unlock()
+	return conn, nil
+}
+
+// rebind memindahkan setiap socket ke port luar baru.
+func (t *natTransport) rebind() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, conn := range t.conns {
+		outside, err := t.Transport.Listen(&net.UDPAddr{})
+		if err != nil {
+			return err
+		}
+		conn.mu.Lock()
+		old := conn.outside
+		conn.outside = outside
+		conn.mu.Unlock()
+		old.Close()
+	}
+	return nil
+}
+
+func (c *natConn) current() PacketConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.outside
+}
+
+func (c *natConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *natConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	return c.current().WriteToUDP(b, addr)
+}
+
+func (c *natConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	for {
+		outside := c.current()
+		n, addr, err := outside.ReadFromUDP(b)
+		// Socket luar lama ditutup rebind; lanjut membaca dari socket yang baru
+		if errors.Is(err, net.ErrClosed) && c.current() != outside {
+			continue
+		}
+		return n, addr, err
+	}
+}
+
+func (c *natConn) Close() error {
+	return c.current().Close()
+}
+
+func TestServerRepliesThroughPortTranslatingNAT(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	server, client := testConfig(t), testConfig(t)
+	server.PortHopping.IntervalMS = 50
+	client.PortHopping.IntervalMS = 50
+	nat := &natTransport{Transport: network.Host(clientIP)}
+	client.Transport = nat
+	dialed, accepted := dial(t, network, listen(t, network, server), clientIP, client)
+
+	rng := rand.New(rand.NewSource(1))
+	upload, download := make([]byte, 128<<10), make([]byte, 128<<10)
+	rng.Read(upload)
+	rng.Read(download)
+	// Transfer melewati beberapa slot port balasan; di tengahnya NAT memetakan ulang semua
+	// port, sehingga server harus mengikuti alamat sumber baru tanpa ReturnPorts
+	results := []<-chan error{
+		transfer(dialed, accepted, upload, 8<<10, 20*time.Millisecond),
+		transfer(accepted, dialed, download, 8<<10, 20*time.Millisecond),
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := nat.rebind(); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(30 * time.Second)
+	for _, result := range results {
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Fatalf("transfer gagal: %v (jaringan: %+v)", err, network.Stats())
+			}
+		case <-timeout:
+			t.Fatalf("transfer tidak selesai (jaringan: %+v)", network.Stats())
+		}
+	}
+	exchange(t, dialed, accepted)
+}
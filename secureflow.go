@@ -0,0 +1,261 @@
+// Package secureflow menyediakan transport SecureFlow sebagai library: handshake hibrida
+// X25519 + ML-KEM yang diautentikasi PSK dan kunci statis server, enkripsi ChaCha20-Poly1305,
+// rantai hash BLAKE3, port hopping, retransmisi, congestion control, stream, dan datagram
+// tak andal.
+//
+// Dial dan Listen mengembalikan net.Conn dan net.Listener biasa. Fitur tambahan seperti
+// stream, datagram, dan batas pesan tersedia lewat *Conn:
+//
+//	conn, err := secureflow.Dial(ctx, "203.0.113.10:5000", config)
+//	if err != nil { ... }
+//	stream, err := conn.(*secureflow.Conn).OpenStream()
+package secureflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/crypto"
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+// PortHoppingConfig adalah rentang port tempat server mendengarkan port hop. Secara default
+// server membuka satu socket untuk setiap port di rentang. Dengan Redirect, server tidak
+// membuka rentang itu sama sekali; firewall harus mengalihkan seluruh rentang ke port
+// handshake, misalnya dengan nftables:
+//
+//	nft add rule ip nat prerouting udp dport 5001-5999 redirect to :5000
+type PortHoppingConfig struct {
+	Enabled  bool `json:"enabled"`
+	Start    int  `json:"start"`
+	End      int  `json:"end"`
+	Redirect bool `json:"redirect"`
+	// IntervalMS adalah lama satu slot jadwal hop dalam milidetik; nol berarti 10 detik.
+	// Klien dan server harus memakai rentang dan interval yang sama.
+	IntervalMS int `json:"interval_ms"`
+	// ReturnPorts adalah jumlah port yang dibuka klien untuk menerima paket server; server
+	// berpindah di antaranya dengan jadwal sendiri. Nol berarti 8. Hanya dipakai klien.
+	ReturnPorts int `json:"return_ports"`
+}
+
+// defaultReturnPorts adalah jumlah port balasan klien jika ReturnPorts nol.
+const defaultReturnPorts = 8
+
+// interval mengembalikan lama satu slot jadwal hop. Nol berarti default protocol.
+func (p PortHoppingConfig) interval() time.Duration {
+	return time.Duration(p.IntervalMS) * time.Millisecond
+}
+
+// returnPorts mengembalikan jumlah port balasan klien.
+func (p PortHoppingConfig) returnPorts() int {
+	if p.ReturnPorts == 0 {
+		return defaultReturnPorts
+	}
+	return p.ReturnPorts
+}
+
+// PaddingConfig mengatur padding di dalam AEAD agar ukuran datagram tidak membocorkan
+// ukuran pesan atau ketikan. Setiap sisi memakai kebijakannya sendiri untuk paket yang
+// dikirimnya; penerima selalu membuang padding.
+type PaddingConfig struct {
+	Mode    string `json:"mode"`    // "none" (default), "buckets", "mtu", atau "random"
+	Buckets []int  `json:"buckets"` // Mode buckets: ukuran datagram; kosong = 128, 256, 512, 1024
+	Min     int    `json:"min"`     // Mode random: padding minimum dalam byte
+	Max     int    `json:"max"`     // Mode random: padding maksimum dalam byte
+}
+
+// policy membuat PaddingPolicy dari konfigurasi.
+func (p PaddingConfig) policy() (protocol.PaddingPolicy, error) {
+	return protocol.NewPaddingPolicy(p.Mode, p.Buckets, p.Min, p.Max)
+}
+
+// ChaffConfig mengatur paket chaff (dummy) terenkripsi yang dikirim dengan jeda acak
+// (proses Poisson) di kedua arah. Lalu lintas asli memakai anggaran yang sama, sehingga
+// chaff hanya mengisi kekurangannya dan sesi diam tampak seperti sesi aktif.
+type ChaffConfig struct {
+	BytesPerSecond int `json:"bytes_per_second"` // Anggaran chaff; 0 = tanpa chaff
+}
+
+// TimingConfig mengatur penyamaran waktu kirim agar jeda antar paket tidak mengikuti
+// ketikan pengguna atau waktu balasan server. Mode "jitter" menunda setiap paket secara
+// acak; mode "constant" mengirim paket berukuran tetap pada jam tetap dan mengisi slot
+// kosong dengan chaff. MaxDelayMS adalah anggaran latensi yang rela ditanggung aplikasi.
+type TimingConfig struct {
+	Mode       string `json:"mode"`         // "none" (default), "jitter", atau "constant"
+	MaxDelayMS int    `json:"max_delay_ms"` // Penundaan maksimum; 0 = 20 (jitter) atau 100 (constant)
+	IntervalMS int    `json:"interval_ms"`  // Mode constant: jarak antar paket; 0 = 20
+	PacketSize int    `json:"packet_size"`  // Mode constant: ukuran setiap datagram; 0 = 1200
+}
+
+// timing membuat protocol.Timing dari konfigurasi.
+func (t TimingConfig) timing() (protocol.Timing, error) {
+	return protocol.NewTiming(t.Mode, time.Duration(t.MaxDelayMS)*time.Millisecond, time.Duration(t.IntervalMS)*time.Millisecond, t.PacketSize)
+}
+
+// RateLimitConfig mengatur token bucket server untuk handshake dan paket data per IP sumber
+// dan per subnet, serta batas anti-amplifikasi untuk alamat yang belum tervalidasi. Nilai
+// nol berarti default; laju negatif berarti tanpa batas.
+type RateLimitConfig struct {
+	HandshakesPerSecond float64 `json:"handshakes_per_second"` // Per IP; 0 = 10
+	PacketsPerSecond    float64 `json:"packets_per_second"`    // Paket data per IP; 0 = 50000
+	SubnetFactor        float64 `json:"subnet_factor"`         // Batas per subnet = batas per IP × faktor; 0 = 4
+	IPv4Prefix          int     `json:"ipv4_prefix"`           // Panjang prefix subnet IPv4; 0 = 24
+	IPv6Prefix          int     `json:"ipv6_prefix"`           // Panjang prefix subnet IPv6; 0 = 64
+	// AmplificationFactor adalah kelipatan maksimum byte yang dikirim server ke alamat yang
+	// belum tervalidasi dibanding byte yang diterimanya dari alamat itu; 0 = 3.
+	AmplificationFactor float64 `json:"amplification_factor"`
+}
+
+// withDefaults mengembalikan salinan r dengan nilai nol diganti default.
+func (r RateLimitConfig) withDefaults() RateLimitConfig {
+	defaults := RateLimitConfig{
+		HandshakesPerSecond: 10,
+		PacketsPerSecond:    50000,
+		SubnetFactor:        4,
+		IPv4Prefix:          24,
+		IPv6Prefix:          64,
+		AmplificationFactor: 3,
+	}
+	if r.HandshakesPerSecond == 0 {
+		r.HandshakesPerSecond = defaults.HandshakesPerSecond
+	}
+	if r.PacketsPerSecond == 0 {
+		r.PacketsPerSecond = defaults.PacketsPerSecond
+	}
+	if r.SubnetFactor == 0 {
+		r.SubnetFactor = defaults.SubnetFactor
+	}
+	if r.IPv4Prefix == 0 {
+		r.IPv4Prefix = defaults.IPv4Prefix
+	}
+	if r.IPv6Prefix == 0 {
+		r.IPv6Prefix = defaults.IPv6Prefix
+	}
+	if r.AmplificationFactor == 0 {
+		r.AmplificationFactor = defaults.AmplificationFactor
+	}
+	return r
+}
+
+// Config adalah konfigurasi bersama klien dan server. Field yang hanya dipakai satu sisi
+// diabaikan oleh sisi lainnya.
+type Config struct {
+	AuthKey           string `json:"auth_key"`           // Rahasia bersama untuk PSK handshake
+	ServerKeyFile     string `json:"server_key_file"`    // Server: kunci privat statis X25519 (hex)
+	ServerPublicKey   string `json:"server_public_key"`  // Klien: kunci statis server yang di-pin (hex), opsional
+	KnownHostsFile    string `json:"known_hosts_file"`   // Klien: penyimpanan trust-on-first-use jika tidak ada pin
+	CongestionControl string `json:"congestion_control"` // "bbr" (default) atau "cubic"
+	// ReceiveWindow adalah jumlah paket yang boleh ditahan sisi ini di buffer reorder, dan
+	// karenanya batas paket yang boleh belum dikonfirmasi oleh peer; 0 = 1024. Ukurannya
+	// diumumkan ke peer, jadi kedua sisi boleh berbeda.
+	ReceiveWindow   int               `json:"receive_window"`
+	Padding         PaddingConfig     `json:"padding"` // Ukuran datagram yang dikirim sisi ini
+	Chaff           ChaffConfig       `json:"chaff"`   // Paket chaff yang dikirim sisi ini
+	Timing          TimingConfig      `json:"timing"`  // Waktu kirim paket sisi ini
+	PortHopping     PortHoppingConfig `json:"port_hopping"`
+	CookieThreshold int               `json:"cookie_threshold"` // Server: handshake per detik sebelum cookie Retry diwajibkan; 0 = 32, negatif = selalu
+	RateLimit       RateLimitConfig   `json:"rate_limit"`       // Server: batas laju per IP/subnet dan anti-amplifikasi
+
+	// Transport adalah jaringan tempat sesi berjalan. Nil berarti socket UDP sistem operasi.
+	Transport Transport `json:"-"`
+}
+
+// Transport membuka port yang dipakai Dial dan Listen untuk menerima dan mengirim datagram.
+type Transport = protocol.Transport
+
+// PacketConn adalah satu port lokal milik Transport. *net.UDPConn memenuhinya.
+type PacketConn = protocol.PacketConn
+
+// LinkConditions mengatur loss, reorder, duplikasi, latensi, dan MTU MemoryNetwork.
+type LinkConditions = protocol.LinkConditions
+
+// MemoryNetwork adalah jaringan datagram dalam memori untuk pengujian deterministik. Setiap
+// host mendapat Transport sendiri lewat Host.
+type MemoryNetwork = protocol.MemoryNetwork
+
+// NewMemoryNetwork membuat jaringan memori dengan kondisi link dan seed acak seed.
+func NewMemoryNetwork(seed int64, link LinkConditions) *MemoryNetwork {
+	return protocol.NewMemoryNetwork(seed, link)
+}
+
+// LoadConfig membaca Config dari file JSON di path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// obfuscation mengembalikan penyamaran lalu lintas untuk setiap sesi.
+func (c *Config) obfuscation() (protocol.Obfuscation, error) {
+	if c.Chaff.BytesPerSecond < 0 {
+		return protocol.Obfuscation{}, fmt.Errorf("chaff.bytes_per_second tidak boleh negatif: %d", c.Chaff.BytesPerSecond)
+	}
+	padding, err := c.Padding.policy()
+	if err != nil {
+		return protocol.Obfuscation{}, err
+	}
+	timing, err := c.Timing.timing()
+	if err != nil {
+		return protocol.Obfuscation{}, err
+	}
+	return protocol.Obfuscation{Padding: padding, ChaffRate: c.Chaff.BytesPerSecond, Timing: timing}, nil
+}
+
+// transport mengembalikan Transport yang dipakai config, dibungkus penyamaran datagram
+// berkunci auth_key sehingga semua paket di jalur, termasuk handshake, tampak acak.
+func (c *Config) transport() Transport {
+	var transport Transport = protocol.UDPTransport{}
+	if c.Transport != nil {
+		transport = c.Transport
+	}
+	return protocol.NewMaskedTransport(transport, crypto.DeriveMaskKey(crypto.DerivePSK(c.AuthKey)))
+}
+
+// check memvalidasi field yang dipakai kedua sisi.
+func (c *Config) check() error {
+	if c == nil {
+		return fmt.Errorf("konfigurasi secureflow kosong")
+	}
+	if c.AuthKey == "" {
+		// PSK handshake dan kunci penyamaran datagram diturunkan dari auth_key; tanpa itu
+		// keduanya berasal dari konstanta publik
+		return fmt.Errorf("auth_key wajib diisi")
+	}
+	if _, err := protocol.NewCongestionController(c.CongestionControl); err != nil {
+		return err
+	}
+	if _, err := c.obfuscation(); err != nil {
+		return err
+	}
+	if c.PortHopping.Start <= 0 || c.PortHopping.End > 65535 || c.PortHopping.Start > c.PortHopping.End {
+		return fmt.Errorf("rentang port_hopping tidak valid: %d-%d", c.PortHopping.Start, c.PortHopping.End)
+	}
+	limits := c.RateLimit
+	if limits.SubnetFactor < 0 || (limits.SubnetFactor > 0 && limits.SubnetFactor < 1) {
+		return fmt.Errorf("rate_limit.subnet_factor harus minimal 1: %v", limits.SubnetFactor)
+	}
+	if limits.IPv4Prefix < 0 || limits.IPv4Prefix > 32 || limits.IPv6Prefix < 0 || limits.IPv6Prefix > 128 {
+		return fmt.Errorf("prefix rate_limit tidak valid: /%d dan /%d", limits.IPv4Prefix, limits.IPv6Prefix)
+	}
+	if limits.AmplificationFactor < 0 || (limits.AmplificationFactor > 0 && limits.AmplificationFactor < 1) {
+		return fmt.Errorf("rate_limit.amplification_factor harus minimal 1: %v", limits.AmplificationFactor)
+	}
+	if c.PortHopping.ReturnPorts < 0 || c.PortHopping.ReturnPorts > protocol.MaxReturnPorts {
+		return fmt.Errorf("port_hopping.return_ports harus 0-%d: %d", protocol.MaxReturnPorts, c.PortHopping.ReturnPorts)
+	}
+	if c.ReceiveWindow != 0 && (c.ReceiveWindow < protocol.MinReceiveWindow || c.ReceiveWindow > protocol.MaxReceiveWindow) {
+		return fmt.Errorf("receive_window harus %d-%d: %d", protocol.MinReceiveWindow, protocol.MaxReceiveWindow, c.ReceiveWindow)
+	}
+	if c.PortHopping.IntervalMS < 0 {
+		return fmt.Errorf("port_hopping.interval_ms tidak boleh negatif: %d", c.PortHopping.IntervalMS)
+	}
+	return nil
+}
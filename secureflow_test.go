@@ -0,0 +1,317 @@
+package secureflow
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eikarna/SecureFlow/internal/protocol"
+)
+
+var (
+	serverIP = net.IPv4(10, 0, 0, 1)
+	clientIP = net.IPv4(10, 0, 0, 2)
+)
+
+// testConfig mengembalikan konfigurasi minimal yang berjalan di MemoryNetwork.
+func testConfig(t *testing.T) *Config {
+	return &Config{
+		AuthKey:       "kunci-uji",
+		ServerKeyFile: filepath.Join(t.TempDir(), "server.key"),
+		PortHopping:   PortHoppingConfig{Enabled: true, Start: 6001, End: 6016, ReturnPorts: 4},
+	}
+}
+
+// listen menjalankan Listen di serverIP pada network.
+func listen(t *testing.T, network *MemoryNetwork, config *Config) *Listener {
+	t.Helper()
+	config.Transport = network.Host(serverIP)
+	ln, err := Listen("10.0.0.1:5000", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.(*Listener)
+}
+
+// dial membuka sesi dari host ip ke ln dan mengembalikan kedua ujungnya setelah paket pertama
+// klien tiba; server baru bisa membalas setelah paket itu membawa port balasan klien. Transport
+// yang sudah diatur di config dipakai apa adanya.
+func dial(t *testing.T, network *MemoryNetwork, ln *Listener, ip net.IP, config *Config) (*Conn, *Conn) {
+	t.Helper()
+	if config.Transport == nil {
+		config.Transport = network.Host(ip)
+	}
+	config.ServerPublicKey = ln.PublicKey()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dialed, err := Dial(ctx, "10.0.0.1:5000", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dialed.Close() })
+	accepted, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { accepted.Close() })
+	if err := dialed.(*Conn).WriteMessage([]byte("halo")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accepted.(*Conn).ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	return dialed.(*Conn), accepted.(*Conn)
+}
+
+// dialPair menjalankan Listen dan Dial di network dengan link bersih, lalu menerapkan link.
+// Kondisi link baru diterapkan setelah handshake agar jeda pengiriman ulang ClientHello tidak
+// ikut memperlambat setiap uji.
+func dialPair(t *testing.T, network *MemoryNetwork, link LinkConditions, server, client *Config) (*Conn, *Conn) {
+	t.Helper()
+	dialed, accepted := dial(t, network, listen(t, network, server), clientIP, client)
+	network.SetConditions(link)
+	return dialed, accepted
+}
+
+// transfer mengirim payload dari from ke to dalam chunk berukuran chunk dengan jeda pause
+// di antaranya, lalu memastikan to menerima byte yang sama persis.
+func transfer(from, to *Conn, payload []byte, chunk int, pause time.Duration) <-chan error {
+	result := make(chan error, 2)
+	go func() {
+		for offset := 0; offset < len(payload); offset += chunk {
+			if _, err := from.Write(payload[offset:min(offset+chunk, len(payload))]); err != nil {
+				result <- err
+				return
+			}
+			time.Sleep(pause)
+		}
+	}()
+	go func() {
+		received := make([]byte, len(payload))
+		if _, err := io.ReadFull(to, received); err != nil {
+			result <- err
+			return
+		}
+		if !bytes.Equal(received, payload) {
+			result <- io.ErrUnexpectedEOF
+			return
+		}
+		result <- nil
+	}()
+	return result
+}
+
+func TestTransferOverMemoryNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     LinkConditions
+		interval int // port_hopping.interval_ms; nol berarti default
+		chunk    int
+		pause    time.Duration
+	}{
+		{name: "bersih", chunk: 64 << 10},
+		{name: "loss", link: LinkConditions{Loss: 0.05, Latency: 2 * time.Millisecond}, chunk: 64 << 10},
+		{name: "reorder", link: LinkConditions{Reorder: 0.2, ReorderDelay: 5 * time.Millisecond, Latency: time.Millisecond}, chunk: 64 << 10},
+		{name: "duplikasi", link: LinkConditions{Duplicate: 0.2, Latency: time.Millisecond}, chunk: 64 << 10},
+		{name: "batas hop", link: LinkConditions{Loss: 0.02, Latency: time.Millisecond}, interval: 40, chunk: 8 << 10, pause: 10 * time.Millisecond},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := NewMemoryNetwork(int64(i+1), LinkConditions{})
+			server, client := testConfig(t), testConfig(t)
+			server.PortHopping.IntervalMS = tt.interval
+			client.PortHopping.IntervalMS = tt.interval
+			dialed, accepted := dialPair(t, network, tt.link, server, client)
+
+			rng := rand.New(rand.NewSource(int64(i)))
+			upload, download := make([]byte, 256<<10), make([]byte, 256<<10)
+			rng.Read(upload)
+			rng.Read(download)
+			// Kedua arah berjalan bersamaan agar ACK menumpang paket data dan sebaliknya
+			results := []<-chan error{
+				transfer(dialed, accepted, upload, tt.chunk, tt.pause),
+				transfer(accepted, dialed, download, tt.chunk, tt.pause),
+			}
+			start := time.Now()
+			timeout := time.After(30 * time.Second)
+			for _, result := range results {
+				select {
+				case err := <-result:
+					if err != nil {
+						t.Fatalf("transfer gagal: %v (jaringan: %+v)", err, network.Stats())
+					}
+				case <-timeout:
+					t.Fatalf("transfer tidak selesai (jaringan: %+v)", network.Stats())
+				}
+			}
+			// Pastikan kondisi link benar-benar terjadi selama transfer
+			stats := network.Stats()
+			if (tt.link.Loss > 0 && stats.Lost == 0) || (tt.link.Reorder > 0 && stats.Reordered == 0) || (tt.link.Duplicate > 0 && stats.Duplicated == 0) {
+				t.Errorf("kondisi link tidak teruji: %+v", stats)
+			}
+			if hop := time.Duration(tt.interval) * time.Millisecond; hop > 0 && time.Since(start) < 3*hop {
+				t.Errorf("transfer selesai dalam %v, kurang dari tiga slot hop", time.Since(start))
+			}
+			// Rantai hash yang putus menutup sesi, jadi sesi yang masih bisa bertukar pesan
+			// berarti setiap paket menyambung
+			if err := dialed.WriteMessage([]byte("selesai")); err != nil {
+				t.Fatal(err)
+			}
+			if message, err := accepted.ReadMessage(); err != nil || string(message) != "selesai" {
+				t.Fatalf("pesan penutup: %q, %v", message, err)
+			}
+		})
+	}
+}
+
+// sentPacket adalah satu datagram yang ditulis ke jaringan.
+type sentPacket struct {
+	at   time.Time
+	size int
+}
+
+// capturingTransport mencatat setiap datagram yang ditulis di semua port yang dibukanya.
+type capturingTransport struct {
+	Transport
+	mu   sync.Mutex
+	sent []sentPacket
+}
+
+type capturingConn struct {
+	PacketConn
+	transport *capturingTransport
+}
+
+func (t *capturingTransport) Listen(addr *net.UDPAddr) (PacketConn, error) {
+	conn, err := t.Transport.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return capturingConn{PacketConn: conn, transport: t}, nil
+}
+
+func (c capturingConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	c.transport.mu.Lock()
+	c.transport.sent = append(c.transport.sent, sentPacket{at: time.Now(), size: len(b)})
+	c.transport.mu.Unlock()
+	return c.PacketConn.WriteToUDP(b, addr)
+}
+
+// take mengembalikan datagram yang tercatat lalu mengosongkan catatan.
+func (t *capturingTransport) take() []sentPacket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sent := t.sent
+	t.sent = nil
+	return sent
+}
+
+func TestConstantTimingOverMemoryNetwork(t *testing.T) {
+	const (
+		interval = 10 * time.Millisecond
+		size     = 512
+		duration = 500 * time.Millisecond
+	)
+	network := NewMemoryNetwork(1, LinkConditions{})
+	ln := listen(t, network, testConfig(t))
+	client := testConfig(t)
+	client.Timing = TimingConfig{Mode: "constant", IntervalMS: int(interval / time.Millisecond), PacketSize: size}
+	capture := &capturingTransport{Transport: network.Host(clientIP)}
+	client.Transport = capture
+	dialed, accepted := dial(t, network, ln, clientIP, client)
+
+	// Paket handshake tidak melewati antrean kirim
+	capture.take()
+	start := time.Now()
+	// Tulisan aplikasi yang tidak teratur, termasuk pesan yang lebih besar dari satu slot,
+	// diselingi jeda kosong yang harus diisi chaff
+	rng := rand.New(rand.NewSource(1))
+	for time.Since(start) < duration {
+		message := make([]byte, rng.Intn(2*size))
+		if err := dialed.WriteMessage(message); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := accepted.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Duration(rng.Intn(60)) * time.Millisecond)
+	}
+	sent := capture.take()
+	elapsed := time.Since(start)
+
+	// Setiap datagram di jalur berukuran tetap ditambah salt penyamaran
+	for i, p := range sent {
+		if p.size != size+protocol.MaskSaltSize {
+			t.Fatalf("datagram %d berukuran %d byte, diharapkan %d", i, p.size, size+protocol.MaskSaltSize)
+		}
+	}
+	// Tidak ada slot yang dilewati atau diisi dua datagram
+	slots := int(elapsed / interval)
+	if len(sent) < slots*9/10 || len(sent) > slots+2 {
+		t.Errorf("%d datagram dalam %v, diharapkan sekitar %d", len(sent), elapsed, slots)
+	}
+	gaps := make([]time.Duration, 0, len(sent))
+	for i := 1; i < len(sent); i++ {
+		gaps = append(gaps, sent[i].at.Sub(sent[i-1].at))
+	}
+	slices.Sort(gaps)
+	if median := gaps[len(gaps)/2]; median < interval*8/10 || median > interval*12/10 {
+		t.Errorf("jarak median antar datagram %v, diharapkan %v", median, interval)
+	}
+	if longest := gaps[len(gaps)-1]; longest > 3*interval {
+		t.Errorf("jarak terpanjang antar datagram %v, ada slot yang kosong", longest)
+	}
+}
+
+func TestTransferSurvivesMTUDrop(t *testing.T) {
+	network := NewMemoryNetwork(1, LinkConditions{})
+	dialed, accepted := dialPair(t, network, LinkConditions{}, testConfig(t), testConfig(t))
+	// Tunggu probe PMTU menaikkan MTU kedua sisi di atas ukuran dasar
+	deadline := time.Now().Add(10 * time.Second)
+	for dialed.Stats().MTU <= protocol.BasePLPMTU || accepted.Stats().MTU <= protocol.BasePLPMTU {
+		if time.Now().After(deadline) {
+			t.Fatalf("MTU tidak naik: klien %d, server %d", dialed.Stats().MTU, accepted.Stats().MTU)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	upload, download := make([]byte, 512<<10), make([]byte, 512<<10)
+	rng.Read(upload)
+	rng.Read(download)
+	results := []<-chan error{
+		transfer(dialed, accepted, upload, 16<<10, 5*time.Millisecond),
+		transfer(accepted, dialed, download, 16<<10, 5*time.Millisecond),
+	}
+	// Jalur menyusut di tengah transfer: paket besar yang sudah terkirim harus dikirim ulang
+	// dalam paket yang muat
+	time.Sleep(50 * time.Millisecond)
+	network.SetConditions(LinkConditions{MTU: protocol.BasePLPMTU + protocol.MaskSaltSize})
+	timeout := time.After(30 * time.Second)
+	for _, result := range results {
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Fatalf("transfer gagal: %v (jaringan: %+v)", err, network.Stats())
+			}
+		case <-timeout:
+			t.Fatalf("transfer tidak selesai (jaringan: %+v)", network.Stats())
+		}
+	}
+	if network.Stats().Lost == 0 {
+		t.Error("tidak ada datagram yang dibuang karena MTU")
+	}
+	for _, conn := range []*Conn{dialed, accepted} {
+		if mtu := conn.Stats().MTU; mtu != protocol.BasePLPMTU {
+			t.Errorf("MTU %d setelah jalur menyusut, diharapkan %d", mtu, protocol.BasePLPMTU)
+		}
+	}
+}